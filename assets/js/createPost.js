@@ -1,17 +1,104 @@
 let button = document.querySelector(".upload-button");
 let deleteButton = document.querySelector("#deleteFile");
-console.log(button);
+let fileNameSpan = document.querySelector(".file-name");
+let captions = document.querySelector(".file-captions");
 button.addEventListener("change", (e) => {
-  fileNameSpan = document.querySelector(".file-name");
-  fileNameSpan.innerHTML = e.target.files[0].name;
-  console.log(e.target.files);
-  if (e.target.files.length > 0) {
+  const files = e.target.files;
+  fileNameSpan.textContent = files.length > 1 ? files.length + " images" : files.length === 1 ? files[0].name : "No file chosen";
+  // A caption input for each image, in the order the files are sent
+  captions.innerHTML = "";
+  for (const file of files) {
+    const row = document.createElement("div");
+    row.className = "file-caption";
+    const name = document.createElement("span");
+    name.textContent = file.name;
+    const input = document.createElement("input");
+    input.type = "text";
+    input.name = "captions";
+    input.maxLength = 200;
+    input.placeholder = "Caption (optional)";
+    row.append(name, input);
+    captions.append(row);
+  }
+  if (files.length > 0) {
     deleteButton.style.display = "block";
   }
 });
 
 deleteButton.addEventListener("click", (e) => {
-  fileNameSpan.innerHTML = "No file chosen";
+  fileNameSpan.textContent = "No file chosen";
   button.value = "";
+  captions.innerHTML = "";
   deleteButton.style.display = "none";
 });
+
+// A poll has up to 10 options, the inputs are added on demand
+const maxPollOptions = 10;
+const pollOptions = document.querySelector(".poll-options");
+const addPollOption = document.querySelector("#addPollOption");
+addPollOption.addEventListener("click", () => {
+  const count = pollOptions.querySelectorAll("input").length;
+  if (count >= maxPollOptions) {
+    return;
+  }
+  const input = document.createElement("input");
+  input.type = "text";
+  input.name = "poll_options";
+  input.maxLength = 100;
+  input.placeholder = "Option";
+  pollOptions.append(input);
+  input.focus();
+  if (count + 1 >= maxPollOptions) {
+    addPollOption.style.display = "none";
+  }
+});
+
+// The title, content and categories are saved as a draft a moment after each change
+const autosaveDelay = 2000;
+const postForm = document.querySelector(".form-section");
+const draftId = document.querySelector("#draftId");
+const autosaveStatus = document.querySelector("#autosaveStatus");
+let autosaveTimer;
+let autosaving = false;
+
+function autosave() {
+  if (autosaving) {
+    autosaveTimer = setTimeout(autosave, autosaveDelay);
+    return;
+  }
+  // Only the text is sent, the images are uploaded with the form
+  const data = new URLSearchParams();
+  data.append("draft_id", draftId.value);
+  data.append("title", postForm.elements["title"].value);
+  data.append("content", postForm.elements["content"].value);
+  for (const category of postForm.querySelectorAll("input[name=categories]:checked")) {
+    data.append("categories", category.value);
+  }
+  autosaving = true;
+  fetch("/drafts/autosave", { method: "POST", body: data })
+    .then((response) => (response.ok ? response.json() : Promise.reject(response.status)))
+    .then((saved) => {
+      if (saved.draftId) {
+        draftId.value = saved.draftId;
+        autosaveStatus.textContent = "Draft saved at " + saved.savedAt;
+      }
+    })
+    .catch(() => {
+      autosaveStatus.textContent = "Draft not saved";
+    })
+    .finally(() => {
+      autosaving = false;
+    });
+}
+
+postForm.addEventListener("input", (e) => {
+  if (e.target.name !== "title" && e.target.name !== "content" && e.target.name !== "categories") {
+    return;
+  }
+  clearTimeout(autosaveTimer);
+  autosaveTimer = setTimeout(autosave, autosaveDelay);
+});
+
+postForm.addEventListener("submit", () => {
+  clearTimeout(autosaveTimer);
+});
@@ -31,11 +31,22 @@ document.querySelectorAll(".comment-text").forEach((textarea) => {
 // Remove display none from edit-post button when textarea content changes
 let postText = document.querySelector(".post-text");
 
-postText.addEventListener("input", function () {
-  const editButton = this.closest(".post-content").querySelector(".edit-post");
-  if (editButton) {
-    editButton.style.display = "inline-block";
-  }
+if (postText) {
+  postText.addEventListener("input", function () {
+    const editButton = this.closest(".post-content").querySelector(".edit-post");
+    if (editButton) {
+      editButton.style.display = "inline-block";
+    }
+  });
+}
+
+// The editors start folded, size them once they are opened
+document.querySelectorAll(".markdown-source").forEach((details) => {
+  details.addEventListener("toggle", () => {
+    const textarea = details.querySelector("textarea");
+    textarea.style.height = "auto";
+    textarea.style.height = textarea.scrollHeight + "px";
+  });
 });
 document.querySelectorAll("form").forEach((form) => {
   form.addEventListener("submit", (event) => {
@@ -46,3 +57,28 @@ document.querySelectorAll("form").forEach((form) => {
     }
   });
 });
+
+// Quote a comment in the comment form, the quote links back to it
+const maxQuoteLength = 200;
+document.querySelectorAll(".quote-comment").forEach((button) => {
+  button.addEventListener("click", () => {
+    const form = document.querySelector("#comment-form");
+    if (!form) {
+      return;
+    }
+    // Quotes of quotes are left out, only the words of the comment are kept
+    let text = button.dataset.content
+      .split("\n")
+      .filter((line) => !line.startsWith(">"))
+      .join("\n")
+      .trim();
+    if (text.length > maxQuoteLength) {
+      text = text.slice(0, maxQuoteLength) + "…";
+    }
+    const quote = "> [!quote " + button.dataset.commentId + "]\n" + text.split("\n").map((line) => "> " + line).join("\n") + "\n\n";
+    form.value = (form.value.trim() ? form.value.trim() + "\n\n" : "") + quote;
+    form.focus();
+    form.setSelectionRange(form.value.length, form.value.length);
+    form.dispatchEvent(new Event("input"));
+  });
+});
@@ -15,6 +15,10 @@ document.addEventListener("DOMContentLoaded", () => {
         tabs[1].classList.add("active");
       } else if (path === "/liked") {
         tabs[2].classList.add("active");
+      } else if (path === "/saved") {
+        tabs[3].classList.add("active");
+      } else if (path === "/following") {
+        tabs[4].classList.add("active");
       } else {
         tabs[0].classList.add("active"); // Default to "All posts"
       }
@@ -25,72 +29,56 @@ document.addEventListener("DOMContentLoaded", () => {
 });
 
 function addCategory() {
-  // Add the selected category to the selected categories
+  // Filter by one more category, the server puts the posts pinned in it first
   const selectedOption = select.options[select.selectedIndex];
-  if (selectedOption) {
-    const categoryElement = document.createElement("div");
-    categoryElement.className = "category-box";
-    categoryElement.innerHTML = `<span class="remove-btn">×</span> ${selectedOption.text}`;
-    categoryElement.id = `selected-${selectedOption.value}`;
-    categoryElement.onclick = function () {
-      removeCategory(selectedOption.value, selectedOption.text);
-    };
-    selectedCategories.appendChild(categoryElement);
-    select.remove(select.selectedIndex);
-    sortOptions();
+  if (selectedOption && selectedOption.value) {
+    applyFilters([...selectedIds(), selectedOption.value]);
   }
 }
 
-function removeCategory(value, text) {
-  // Remove the category from the selected categories and add it back to the select element.
-  const categoryElement = document.getElementById(`selected-${value}`);
-  if (categoryElement) {
-    categoryElement.remove();
-  }
-  const option = document.createElement("option");
-  option.value = value;
-  option.text = text;
-  select.add(option);
-  sortOptions();
+function removeCategory(value) {
+  // Stop filtering by a category
+  applyFilters(selectedIds().filter((id) => id !== value));
 }
 select.onchange = addCategory;
 
+function selectedIds() {
+  // Ids of the categories the page is filtered by
+  return Array.from(selectedCategories.children).map((category) =>
+    category.id.replace("selected-", "")
+  );
+}
+
+function applyFilters(ids) {
+  // Reload the page filtered by the given categories, from its first page
+  const params = new URLSearchParams(window.location.search);
+  params.delete("category");
+  params.delete("page");
+  ids.forEach((id) => params.append("category", id));
+  window.location.search = params.toString();
+}
+
 function sortOptions() {
-  // Sort the options in the select element
-  const options = Array.from(select.options).slice(1); // Ignore first option
+  // Sort the options in the select element, without the categories already selected
+  const ids = selectedIds();
+  const options = Array.from(select.options)
+    .slice(1) // Ignore first option
+    .filter((option) => !ids.includes(option.value));
   options.sort((a, b) => a.text.localeCompare(b.text));
   select.innerHTML = '<option value="">Select one or more categories</option>';
   options.forEach((option) => select.add(option));
-  displayPosts();
 }
 
+Array.from(selectedCategories.children).forEach((category) => {
+  category.onclick = function () {
+    removeCategory(category.id.replace("selected-", ""));
+  };
+});
+
 const btnResetFilters = document.getElementById("btn-reset-filters");
 // Reset all selected categories
 if (btnResetFilters) {
   btnResetFilters.onclick = function () {
-    Array.from(selectedCategories.children).forEach((category) => {
-      removeCategory(
-        category.id.replace("selected-", ""),
-        category.textContent.replace("×", "").trim()
-      );
-    });
+    applyFilters([]);
   };
 }
-
-function displayPosts() {
-  // Get all posts and categories to filter by  (post-item and category-box)
-  const posts = document.querySelectorAll(".post-item");
-  const arrayCategories = Array.from(selectedCategories.children).map(
-    (category) => category.textContent.replace("×", "").trim()
-  );
-
-  posts.forEach((post) => {
-    const categories = Array.from(post.querySelectorAll(".category-box")).map(
-      (category) => category.textContent
-    );
-    const isDisplayed = arrayCategories.every((category) =>
-      categories.includes(category)
-    );
-    post.style.display = isDisplayed ? "block" : "none";
-  });
-}
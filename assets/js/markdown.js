@@ -0,0 +1,40 @@
+// Add a Preview button under every Markdown editor, rendered by the server exactly as it will be posted
+document.querySelectorAll("textarea[data-preview]").forEach((textarea) => {
+  const button = document.createElement("button");
+  button.type = "button";
+  button.className = "button preview-button";
+  button.textContent = "Preview";
+
+  const preview = document.createElement("div");
+  preview.className = "markdown-body markdown-preview";
+  preview.hidden = true;
+
+  textarea.after(button, preview);
+
+  button.addEventListener("click", async () => {
+    if (!preview.hidden) {
+      preview.hidden = true;
+      button.textContent = "Preview";
+      return;
+    }
+    const body = new URLSearchParams({ content: textarea.value });
+    try {
+      const response = await fetch("/markdown/preview", { method: "POST", body });
+      if (!response.ok) {
+        throw new Error(response.status);
+      }
+      // The server already sanitized the HTML
+      preview.innerHTML = await response.text();
+    } catch (error) {
+      preview.textContent = "The preview is not available right now.";
+    }
+    preview.hidden = false;
+    button.textContent = "Hide preview";
+  });
+
+  // An outdated preview is hidden as soon as the content changes
+  textarea.addEventListener("input", () => {
+    preview.hidden = true;
+    button.textContent = "Preview";
+  });
+});
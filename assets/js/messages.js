@@ -0,0 +1,28 @@
+// New messages are pushed by the server while the inbox or a conversation is open
+const events = new EventSource("/messages/events");
+const conversation = document.getElementById("conversation");
+
+events.addEventListener("message", (event) => {
+  const message = JSON.parse(event.data);
+  if (!conversation || conversation.dataset.id !== message.conversationId) {
+    // The inbox and the unread counts are rendered by the server
+    window.location.reload();
+    return;
+  }
+  const item = document.createElement("div");
+  item.className = "global-box message";
+  const header = document.createElement("div");
+  header.className = "activity-card-header";
+  const author = document.createElement("span");
+  author.textContent = message.username;
+  const date = document.createElement("span");
+  date.className = "activity-card-date";
+  date.textContent = message.date;
+  header.append(author, date);
+  const content = document.createElement("p");
+  content.className = "message-content";
+  content.textContent = message.content;
+  item.append(header, content);
+  document.querySelector(".message-list").appendChild(item);
+  item.scrollIntoView({ behavior: "smooth" });
+});
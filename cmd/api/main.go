@@ -41,15 +41,16 @@ func main() {
 	//shared.GoogleClientSecret = dotenv.GetEnv("googleClientSecret")
 	//shared.GoogleClientID = dotenv.GetEnv("googleClientID")
 	//
-	server := server.NewServer()
-
-	go gracefulShutdown(server)
-
+	// The .env is loaded first, the server reads its configuration from it
 	err := shared.LoadEnv(".env")
 	if err != nil {
 		log.Fatalf("error loading .env file: %v", err)
 	}
 
+	server := server.NewServer()
+
+	go gracefulShutdown(server)
+
 	fmt.Println("Server started on port", server.Addr)
 	fmt.Println("https://localhost:8080")
 	// err := server.ListenAndServe()
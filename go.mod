@@ -6,5 +6,14 @@ require github.com/mattn/go-sqlite3 v1.14.24
 
 require (
 	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.7.8
 	golang.org/x/crypto v0.28.0
+	golang.org/x/image v0.18.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	golang.org/x/net v0.26.0 // indirect
 )
@@ -49,12 +49,23 @@ func (s *service) GetActivities(user models.User) ([]models.Activity, error) {
 }
 
 func (s *service) CreateActivity(activity models.Activity) error {
-	// Create a new activity
-	query := "INSERT INTO Activity (activity_id, user_id, action_user_id, action_type, post_id, comment_id, creation_date, details, is_read) VALUES (?,?,?,?,?,?,?,?,?)"
-	_, err := s.db.Exec(query, activity.ActivityId, activity.UserId, activity.ActionUserId, activity.ActionType, activity.PostId, activity.CommentId, activity.CreationDate, activity.Details, &activity.IsRead)
+	// Create a new activity, none is created for a user who blocked or muted the one acting
+	query := `INSERT INTO Activity (activity_id, user_id, action_user_id, action_type, post_id, comment_id, creation_date, details, is_read)
+		SELECT ?,?,?,?,?,?,?,?,? WHERE NOT EXISTS (SELECT 1 FROM User_Block WHERE user_id=? AND target_id=?)`
+	_, err := s.db.Exec(query, activity.ActivityId, activity.UserId, activity.ActionUserId, activity.ActionType, activity.PostId, activity.CommentId, activity.CreationDate, activity.Details, &activity.IsRead,
+		activity.UserId, activity.ActionUserId)
 	return err
 }
 
+func (s *service) HasReactionActivity(actionUserId, postId, commentId, emoji string) (bool, error) {
+	// Whether a user was already notified of this reaction, its details start with the emoji
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM Activity WHERE action_type=? AND action_user_id=? AND post_id=? AND comment_id=?
+		AND substr(details, 1, length(?) + 1) = ? || ' ')`
+	err := s.db.QueryRow(query, string(models.GET_REACTION), actionUserId, postId, commentId, emoji, emoji).Scan(&exists)
+	return exists, err
+}
+
 func (s *service) UpdateActivity(activity models.Activity) error {
 	// Update an existing activity
 	query := "UPDATE Activity SET user_id=?, action_user_id=?, action_type=?, post_id=?, comment_id=?, creation_date=?, details=?, is_read=? WHERE activity_id=?"
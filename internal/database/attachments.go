@@ -0,0 +1,105 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+)
+
+func (s *service) GetAttachments(postId string) ([]models.Attachment, error) {
+	// Get the images of a post in gallery order
+	rows, err := s.db.Query(`SELECT attachment_id, post_id, image_url, caption, position, creation_date
+		FROM Attachment WHERE post_id=? ORDER BY position, creation_date`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var attachments []models.Attachment
+	for rows.Next() {
+		var attachment models.Attachment
+		err = rows.Scan(&attachment.AttachmentId, &attachment.PostId, &attachment.ImageURL, &attachment.Caption, &attachment.Position, &attachment.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *service) GetAttachment(attachmentId string) (models.Attachment, error) {
+	// Get an image of a post, an empty Attachment is returned if it doesn't exist
+	row := s.db.QueryRow(`SELECT attachment_id, post_id, image_url, caption, position, creation_date
+		FROM Attachment WHERE attachment_id=?`, attachmentId)
+	var attachment models.Attachment
+	err := row.Scan(&attachment.AttachmentId, &attachment.PostId, &attachment.ImageURL, &attachment.Caption, &attachment.Position, &attachment.CreationDate)
+	if err == sql.ErrNoRows {
+		return models.Attachment{}, nil
+	}
+	return attachment, err
+}
+
+func (s *service) AddAttachment(attachment models.Attachment) error {
+	// Add an image to a post
+	query := "INSERT INTO Attachment (attachment_id, post_id, image_url, caption, position, creation_date) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := s.db.Exec(query, attachment.AttachmentId, attachment.PostId, attachment.ImageURL, attachment.Caption, attachment.Position, attachment.CreationDate)
+	return err
+}
+
+func (s *service) EditAttachmentCaption(attachmentId, caption string) error {
+	// Change the caption shown under an image
+	_, err := s.db.Exec("UPDATE Attachment SET caption=? WHERE attachment_id=?", caption, attachmentId)
+	return err
+}
+
+func (s *service) ReorderAttachments(postId string, attachmentIds []string) error {
+	// Number the images of a post in the given order
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for position, attachmentId := range attachmentIds {
+		_, err = tx.Exec("UPDATE Attachment SET position=? WHERE attachment_id=? AND post_id=?", position, attachmentId, postId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) DeleteAttachment(attachmentId string) error {
+	// Remove an image from its post
+	_, err := s.db.Exec("DELETE FROM Attachment WHERE attachment_id=?", attachmentId)
+	return err
+}
+
+func (s *service) MoveAttachmentImage(postId, imageURL, newImageURL string) error {
+	// Point the attachments of a post showing an image to another copy of it
+	_, err := s.db.Exec("UPDATE Attachment SET image_url=? WHERE post_id=? AND image_url=?", newImageURL, postId, imageURL)
+	return err
+}
+
+func (s *service) CountImageUses(imageURL string) (int, error) {
+	// Count the attachments showing an uploaded image, files are shared by identical uploads
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Attachment WHERE image_url=?", imageURL).Scan(&count)
+	return count, err
+}
+
+func (s *service) GetImageURLs() ([]string, error) {
+	// Get every uploaded image still shown by a post
+	rows, err := s.db.Query("SELECT DISTINCT image_url FROM Attachment")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var imageURLs []string
+	for rows.Next() {
+		var imageURL string
+		err = rows.Scan(&imageURL)
+		if err != nil {
+			return nil, err
+		}
+		imageURLs = append(imageURLs, imageURL)
+	}
+	return imageURLs, rows.Err()
+}
@@ -15,7 +15,10 @@ func (s *service) CreateUser(User models.User) error {
 
 func (s *service) GetUsers() ([]models.User, error) {
 	// Get all users
-	query := "SELECT * FROM User"
+	query := `
+		SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider,
+			COALESCE((SELECT k.post_karma + k.comment_karma FROM User_Karma k WHERE k.user_id = User.user_id), 0)
+		FROM User WHERE deletion_date IS NULL`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
@@ -24,7 +27,7 @@ func (s *service) GetUsers() ([]models.User, error) {
 	users := []models.User{}
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider); err != nil {
+		if err := rows.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider, &user.Karma); err != nil {
 			return nil, err
 		}
 		users = append(users, user)
@@ -34,7 +37,7 @@ func (s *service) GetUsers() ([]models.User, error) {
 
 func (s *service) GetUser(email, password string) (models.User, error) {
 	// Get user by email and password
-	query := "SELECT * FROM User WHERE email=?"
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE email=? AND deletion_date IS NULL"
 	row := s.db.QueryRow(query, email)
 	var user models.User
 	if err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider); err != nil {
@@ -53,7 +56,7 @@ func (s *service) GetUser(email, password string) (models.User, error) {
 
 func (s *service) FindUsername(username string) (bool, error) {
 	// Check if username exists
-	query := "SELECT * FROM User WHERE username=?"
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE username=?"
 	row := s.db.QueryRow(query, username)
 	var user models.User
 	err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider)
@@ -65,7 +68,7 @@ func (s *service) FindUsername(username string) (bool, error) {
 
 func (s *service) FindEmailUser(email string) (bool, error) {
 	// Check if email exists
-	query := "SELECT * FROM User WHERE email=?"
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE email=?"
 	row := s.db.QueryRow(query, email)
 	var user models.User
 	err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider)
@@ -77,7 +80,7 @@ func (s *service) FindEmailUser(email string) (bool, error) {
 
 func (s *service) FindUserByEmail(email string) (models.User, error) {
 	// Find user by email
-	query := "SELECT * FROM User WHERE email=?"
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE email=? AND deletion_date IS NULL"
 	row := s.db.QueryRow(query, email)
 	var user models.User
 	err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider)
@@ -89,7 +92,7 @@ func (s *service) FindUserByEmail(email string) (models.User, error) {
 
 func (s *service) FindUserCookie(cookie string) (models.User, error) {
 	// Find user by cookie
-	query := "SELECT * FROM User WHERE session_id=?"
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE session_id=? AND deletion_date IS NULL"
 	row := s.db.QueryRow(query, cookie)
 	var user models.User
 	if err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider); err != nil {
@@ -97,15 +100,84 @@ func (s *service) FindUserCookie(cookie string) (models.User, error) {
 	}
 	return user, nil
 }
-func (s *service) DeleteUser(id string) error {
-	// Delete user
-	err := s.DeletePostsFromUser(id)
+func (s *service) deleteUser(id string) error {
+	// Delete a user with their posts, votes and everything else they own, in a single transaction
+	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
+	err = deletePostsFromUser(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Bookmark WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Bookmark_Folder WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Subscription WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Follow WHERE follower_id=? OR followed_id=?", id, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM User_Block WHERE user_id=? OR target_id=?", id, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Message_Report WHERE user_id=? OR message_id IN (SELECT message_id FROM Message WHERE user_id=?)", id, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Message WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Participant WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = deleteVotes(tx, "l.user_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM User_Karma WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM User_Badge WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Reaction WHERE user_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 	userQuery := "DELETE FROM User WHERE user_id=?"
-	_, err = s.db.Exec(userQuery, id)
-	return err
+	_, err = tx.Exec(userQuery, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
 
 func (s *service) UpdateUser(user models.User) error {
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"time"
+)
+
+func (s *service) EnsureBadge(badge models.Badge) error {
+	// Create the badge of a rule unless it already exists
+	_, err := s.db.Exec("INSERT OR IGNORE INTO Badge (badge_id, code, name, description, creation_date) VALUES (?, ?, ?, ?, ?)",
+		badge.BadgeId, badge.Code, badge.Name, badge.Description, badge.CreationDate)
+	return err
+}
+
+func (s *service) AddBadge(badge models.Badge) error {
+	// Create a badge, its name is unique
+	_, err := s.db.Exec("INSERT INTO Badge (badge_id, code, name, description, creation_date) VALUES (?, ?, ?, ?, ?)",
+		badge.BadgeId, badge.Code, badge.Name, badge.Description, badge.CreationDate)
+	return err
+}
+
+func (s *service) GetBadges() ([]models.Badge, error) {
+	// Get every badge with the number of users holding it, the ones of the rules first
+	rows, err := s.db.Query(`
+		SELECT b.badge_id, b.code, b.name, b.description, b.creation_date,
+			(SELECT COUNT(*) FROM User_Badge ub WHERE ub.badge_id = b.badge_id)
+		FROM Badge b
+		ORDER BY b.code = '', b.creation_date`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var badges []models.Badge
+	for rows.Next() {
+		var badge models.Badge
+		err = rows.Scan(&badge.BadgeId, &badge.Code, &badge.Name, &badge.Description, &badge.CreationDate, &badge.NbOfAwards)
+		if err != nil {
+			return nil, err
+		}
+		badges = append(badges, badge)
+	}
+	return badges, rows.Err()
+}
+
+func (s *service) GetUserBadges(userId string) ([]models.Badge, error) {
+	// Get the badges of a user, first awarded first
+	rows, err := s.db.Query(`
+		SELECT b.badge_id, b.code, b.name, b.description, b.creation_date, ub.creation_date
+		FROM User_Badge ub JOIN Badge b ON ub.badge_id = b.badge_id
+		WHERE ub.user_id = ?
+		ORDER BY ub.creation_date`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var badges []models.Badge
+	for rows.Next() {
+		var badge models.Badge
+		err = rows.Scan(&badge.BadgeId, &badge.Code, &badge.Name, &badge.Description, &badge.CreationDate, &badge.AwardDate)
+		if err != nil {
+			return nil, err
+		}
+		badge.FormattedAwardDate = badge.AwardDate.Format("Jan 2, 2006")
+		badges = append(badges, badge)
+	}
+	return badges, rows.Err()
+}
+
+func (s *service) AwardBadge(userId, badgeId, awardedBy string) (bool, error) {
+	// Give a badge to a user, false when he already has it
+	result, err := s.db.Exec("INSERT OR IGNORE INTO User_Badge (user_id, badge_id, awarded_by, creation_date) VALUES (?, ?, ?, ?)",
+		userId, badgeId, awardedBy, time.Now())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) GetBadgeStats(userId string) (models.BadgeStats, error) {
+	// Count what the rules of the badges look at for a user, his own likes don't count
+	var stats models.BadgeStats
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Post WHERE user_id = ? AND status = 'published' AND deletion_date IS NULL),
+			(SELECT COUNT(*) FROM User_Like l
+				LEFT JOIN Post p ON l.comment_id = '' AND l.post_id = p.post_id
+				LEFT JOIN Comment c ON l.comment_id = c.comment_id
+				WHERE l.isLiked AND l.user_id != ? AND COALESCE(c.user_id, p.user_id) = ?),
+			(SELECT COUNT(*) FROM Report WHERE user_id = ? AND status = 'accepted')
+				+ (SELECT COUNT(*) FROM Message_Report WHERE user_id = ? AND status = 'accepted'),
+			(SELECT COUNT(*) FROM Request WHERE user_id = ? AND status = 'accepted')`,
+		userId, userId, userId, userId, userId, userId).Scan(&stats.Posts, &stats.LikesReceived, &stats.AcceptedReports, &stats.AcceptedRequests)
+	return stats, err
+}
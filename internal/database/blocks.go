@@ -0,0 +1,53 @@
+package database
+
+import (
+	"forum-go/internal/models"
+)
+
+func (s *service) AddBlock(block models.Block) error {
+	// Block or mute a user, doing it twice changes nothing
+	_, err := s.db.Exec("INSERT OR IGNORE INTO User_Block (block_id, user_id, target_id, kind, creation_date) VALUES (?, ?, ?, ?, ?)",
+		block.BlockId, block.UserId, block.TargetId, block.Kind, block.CreationDate)
+	return err
+}
+
+func (s *service) RemoveBlock(userId, targetId, kind string) (bool, error) {
+	// Unblock or unmute a user, false when he was not
+	result, err := s.db.Exec("DELETE FROM User_Block WHERE user_id=? AND target_id=? AND kind=?", userId, targetId, kind)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) GetBlocks(userId string) ([]models.Block, error) {
+	// Get the users a user blocked or muted, by username, the users in the trash are left out
+	rows, err := s.db.Query(`
+		SELECT b.block_id, b.target_id, u.username, b.kind, b.creation_date
+		FROM User_Block b
+		JOIN User u ON b.target_id = u.user_id
+		WHERE b.user_id = ? AND u.deletion_date IS NULL
+		ORDER BY u.username`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocks []models.Block
+	for rows.Next() {
+		block := models.Block{UserId: userId}
+		err = rows.Scan(&block.BlockId, &block.TargetId, &block.TargetUsername, &block.Kind, &block.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, rows.Err()
+}
+
+func (s *service) IsBlocked(userId, targetId string) (bool, error) {
+	// Check a user blocked another, muting him is not enough
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM User_Block WHERE user_id=? AND target_id=? AND kind=?", userId, targetId, models.BLOCK_BLOCK).Scan(&n)
+	return n > 0, err
+}
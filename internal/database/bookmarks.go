@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+)
+
+func (s *service) AddBookmark(bookmark models.Bookmark) error {
+	// Save a post or a comment for a user, an empty folder id keeps it out of the folders
+	folderId := sql.NullString{String: bookmark.FolderId, Valid: bookmark.FolderId != ""}
+	_, err := s.db.Exec("INSERT INTO Bookmark (bookmark_id, user_id, post_id, comment_id, folder_id, creation_date) VALUES (?, ?, ?, ?, ?, ?)",
+		bookmark.BookmarkId, bookmark.UserId, bookmark.PostId, bookmark.CommentId, folderId, bookmark.CreationDate)
+	return err
+}
+
+func (s *service) DeleteBookmark(userId, postId, commentId string) (bool, error) {
+	// Remove a saved post or comment, false when it was not saved
+	result, err := s.db.Exec("DELETE FROM Bookmark WHERE user_id=? AND post_id=? AND comment_id=?", userId, postId, commentId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) MoveBookmark(userId, postId, commentId, folderId string) (bool, error) {
+	// Put a saved post or comment in another folder, an empty folder id takes it out of its folder
+	result, err := s.db.Exec("UPDATE Bookmark SET folder_id=? WHERE user_id=? AND post_id=? AND comment_id=?",
+		sql.NullString{String: folderId, Valid: folderId != ""}, userId, postId, commentId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) GetBookmarks(userId string) ([]models.Bookmark, error) {
+	// Get what a user saved, last saved first, a saved comment comes with its content and post title
+	rows, err := s.db.Query(`
+		SELECT b.bookmark_id, b.post_id, b.comment_id, COALESCE(b.folder_id, ''), b.creation_date,
+			p.title, COALESCE(c.content, ''), c.creation_date, COALESCE(c.user_id, ''), COALESCE(u.username, '')
+		FROM Bookmark b
+		JOIN Post p ON b.post_id = p.post_id
+		LEFT JOIN Comment c ON b.comment_id = c.comment_id
+		LEFT JOIN User u ON c.user_id = u.user_id
+		WHERE b.user_id = ? AND p.status = 'published' AND p.deletion_date IS NULL
+			AND (b.comment_id = '' OR (c.deletion_date IS NULL AND u.deletion_date IS NULL))
+		ORDER BY b.creation_date DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var bookmarks []models.Bookmark
+	for rows.Next() {
+		bookmark := models.Bookmark{UserId: userId}
+		comment := &bookmark.Comment
+		var commentDate sql.NullTime
+		err = rows.Scan(&bookmark.BookmarkId, &bookmark.PostId, &bookmark.CommentId, &bookmark.FolderId, &bookmark.CreationDate,
+			&comment.PostTitle, &comment.Content, &commentDate, &comment.UserID, &comment.Username)
+		if err != nil {
+			return nil, err
+		}
+		comment.CommentId = bookmark.CommentId
+		comment.PostID = bookmark.PostId
+		if commentDate.Valid {
+			comment.CreationDate = commentDate.Time
+			comment.FormattedCreationDate = comment.CreationDate.Format("02/01/06 - 15:04")
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+	return bookmarks, rows.Err()
+}
+
+func (s *service) GetBookmarkFolders(userId string) ([]models.BookmarkFolder, error) {
+	// Get the bookmark folders of a user by name, with the number of bookmarks in each
+	rows, err := s.db.Query(`
+		SELECT f.folder_id, f.name, f.creation_date,
+			(SELECT COUNT(*) FROM Bookmark b WHERE b.folder_id = f.folder_id)
+		FROM Bookmark_Folder f
+		WHERE f.user_id = ?
+		ORDER BY f.name`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var folders []models.BookmarkFolder
+	for rows.Next() {
+		folder := models.BookmarkFolder{UserId: userId}
+		err = rows.Scan(&folder.FolderId, &folder.Name, &folder.CreationDate, &folder.NbOfBookmarks)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, rows.Err()
+}
+
+func (s *service) AddBookmarkFolder(folder models.BookmarkFolder) error {
+	// Create a bookmark folder, its name is unique for its user
+	_, err := s.db.Exec("INSERT INTO Bookmark_Folder (folder_id, user_id, name, creation_date) VALUES (?, ?, ?, ?)",
+		folder.FolderId, folder.UserId, folder.Name, folder.CreationDate)
+	return err
+}
+
+func (s *service) DeleteBookmarkFolder(userId, folderId string) (bool, error) {
+	// Delete a bookmark folder of a user, its bookmarks are kept out of any folder
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE Bookmark SET folder_id=NULL WHERE user_id=? AND folder_id=?", userId, folderId)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	result, err := tx.Exec("DELETE FROM Bookmark_Folder WHERE user_id=? AND folder_id=?", userId, folderId)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
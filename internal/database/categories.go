@@ -51,6 +51,13 @@ func (s *service) DeleteCategory(id string) error {
 		return err
 	}
 
+	// Nobody follows a deleted category
+	_, err = tx.Exec("DELETE FROM Subscription WHERE category_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Delete from Category
 	query = "DELETE FROM Category WHERE category_id=?"
 	_, err = tx.Exec(query, id)
@@ -1,13 +1,15 @@
 package database
 
 import (
+	"database/sql"
 	"forum-go/internal/models"
 )
 
 func (s *service) GetComments(post models.Post) ([]models.Comment, error) {
-	// Query to get all comments for a post
+	// Query to get all comments for a post, a deleted one keeps its place with no content
 	rows, err := s.db.Query(`
-        SELECT c.comment_id, c.content, c.creation_date, c.user_id, c.post_id, u.username
+        SELECT c.comment_id, c.content, c.creation_date, c.user_id, c.post_id, u.username, c.deletion_date, u.deletion_date,
+            COALESCE((SELECT k.post_karma + k.comment_karma FROM User_Karma k WHERE k.user_id = u.user_id), 0)
         FROM Comment c
         JOIN User u ON c.user_id = u.user_id
         WHERE c.post_id = ?
@@ -20,10 +22,19 @@ func (s *service) GetComments(post models.Post) ([]models.Comment, error) {
 	comments := make([]models.Comment, 0)
 	for rows.Next() {
 		var comment models.Comment
-		err := rows.Scan(&comment.CommentId, &comment.Content, &comment.CreationDate, &comment.UserID, &comment.PostID, &comment.Username)
+		var userDeletionDate sql.NullTime
+		err := rows.Scan(&comment.CommentId, &comment.Content, &comment.CreationDate, &comment.UserID, &comment.PostID, &comment.Username, &comment.DeletionDate, &userDeletionDate, &comment.UserKarma)
 		if err != nil {
 			return nil, err
 		}
+		if !comment.DeletionDate.Valid {
+			// The comments of a deleted user are removed with him
+			comment.DeletionDate = userDeletionDate
+		}
+		if comment.DeletionDate.Valid {
+			comment.Content = ""
+			comment.Username = ""
+		}
 		// Format creation date
 		comment.FormattedCreationDate = comment.CreationDate.Format("02/01/06 - 15:04")
 		comments = append(comments, comment)
@@ -40,6 +51,18 @@ func (s *service) GetComments(post models.Post) ([]models.Comment, error) {
 	return comments, nil
 }
 
+func (s *service) GetComment(id string) (models.Comment, error) {
+	// Get a comment by id with the username of its author
+	row := s.db.QueryRow(`
+        SELECT c.comment_id, c.content, c.creation_date, c.user_id, c.post_id, u.username
+        FROM Comment c
+        JOIN User u ON c.user_id = u.user_id
+        WHERE c.comment_id = ? AND c.deletion_date IS NULL AND u.deletion_date IS NULL`, id)
+	var comment models.Comment
+	err := row.Scan(&comment.CommentId, &comment.Content, &comment.CreationDate, &comment.UserID, &comment.PostID, &comment.Username)
+	return comment, err
+}
+
 func (s *service) AddComment(comment models.Comment) error {
 	// Query insert all fields in comment table
 	query := "INSERT INTO Comment (comment_id,content, creation_date, user_id, post_id) VALUES (?,?,?,?,?)"
@@ -47,13 +70,19 @@ func (s *service) AddComment(comment models.Comment) error {
 	return err
 }
 
-func (s *service) DeleteComment(id string) error {
+func (s *service) deleteComment(id string) error {
 	// Start a transaction
 	tx, err := s.db.Begin()
 	if err != nil {
 		return err
 	}
 
+	err = deleteVotes(tx, "l.comment_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
 	// Delete comment post by id
 	query := "DELETE FROM Comment WHERE comment_id=?"
 	_, err = tx.Exec(query, id)
@@ -61,6 +90,16 @@ func (s *service) DeleteComment(id string) error {
 		tx.Rollback()
 		return err
 	}
+	_, err = tx.Exec("DELETE FROM Bookmark WHERE comment_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Reaction WHERE comment_id=?", id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	// Commit the transaction
 	err = tx.Commit()
@@ -32,33 +32,178 @@ type Service interface {
 	FindUserByEmail(email string) (models.User, error)
 	FindUsername(username string) (bool, error)
 	UpdateUser(user models.User) error
-	DeleteUser(id string) error
 
 	FindUserCookie(cookie string) (models.User, error)
 
+	// Password section
+	CreatePasswordReset(reset models.PasswordReset) error
+	GetPasswordReset(tokenHash string) (models.PasswordReset, error)
+	UsePasswordReset(resetId string, now time.Time) (bool, error)
+	UpdatePassword(userId, passwordHash string) error
+
+	// Two factor section
+	GetUserById(id string) (models.User, error)
+	GetTotp(userId string) (models.UserTotp, error)
+	SaveTotp(totp models.UserTotp) error
+	UpdateTotpStep(userId string, step int64) error
+	DeleteTotp(userId string) error
+	ReplaceRecoveryCodes(userId string, codeHashes []string) error
+	UseRecoveryCode(userId, codeHash string) (bool, error)
+	CountRecoveryCodes(userId string) (int, error)
+	CreateLoginChallenge(challenge models.LoginChallenge) error
+	GetLoginChallenge(challengeId string) (models.LoginChallenge, error)
+	IncrementChallengeAttempts(challengeId string) error
+	DeleteLoginChallenge(challengeId string) error
+
+	// Login throttling section
+	GetLoginThrottle(key string) (models.LoginThrottle, error)
+	RecordLoginFailure(key string, since time.Time) (models.LoginThrottle, error)
+	LockLoginThrottle(key string, until time.Time) error
+	ResetLoginThrottle(key string) error
+	GetLockedAccounts() ([]models.LoginThrottle, error)
+
+	// OAuth section
+	CreateOAuthState(state models.OAuthState) error
+	ConsumeOAuthState(state string) (models.OAuthState, error)
+	GetIdentity(provider, subject string) (models.UserIdentity, error)
+	GetUserIdentities(userId string) ([]models.UserIdentity, error)
+	CreateIdentity(identity models.UserIdentity) error
+	DeleteIdentity(identityId string) error
+	SetUserProvider(userId, provider string) error
+
+	// Profile section
+	FindUserByUsername(username string) (models.User, error)
+	GetProfile(userId string) (models.Profile, error)
+	SaveProfile(profile models.Profile) error
+	GetUserPosts(userId string, limit, offset int) ([]models.Post, error)
+	CountUserPosts(userId string) (int, error)
+	GetUserComments(userId string, limit, offset int) ([]models.Comment, error)
+	CountUserComments(userId string) (int, error)
+	GetKarma(userId string) (models.Karma, error)
+	GetPublicActivities(userId string, actionTypes []string, limit int) ([]models.Activity, error)
+	GetAvatar(userId string) (models.Avatar, error)
+	GetAvatars() ([]models.Avatar, error)
+	SaveAvatar(avatar models.Avatar) error
+	DeleteAvatar(userId string) error
+
+	// Settings section
+	GetSetting(key string) (string, error)
+	SetSetting(key, value string) error
+
 	GetPosts() ([]models.Post, error)
 	GetPost(id string) (models.Post, error)
+	FindPostByRef(ref string) (models.Post, error)
 	AddPost(post models.Post, categories []models.Category) error
 	DeletePost(id string) error
-	DeletePostsFromUser(userID string) error
 	EditPost(id, title string) error
 
+	// Draft section
+	GetDrafts(userId string) ([]models.Post, error)
+	UpdateDraft(post models.Post, categories []models.Category) error
+	ReplacePoll(postId string, poll *models.Poll) error
+	PublishPost(id string, now time.Time) (bool, error)
+	GetScheduledPosts(now time.Time) ([]models.Post, error)
+
+	// Post state section
+	ChangePostState(change models.PostStateChange) error
+	GetPostStateChanges(postId string) ([]models.PostStateChange, error)
+
+	// Trash section
+	Trash(kind, id, deletedBy string) (bool, error)
+	Restore(kind, id string) (bool, error)
+	GetTrash() ([]models.TrashItem, error)
+	PurgeTrash(before time.Time) (int, error)
+
+	// Bookmark section
+	AddBookmark(bookmark models.Bookmark) error
+	DeleteBookmark(userId, postId, commentId string) (bool, error)
+	MoveBookmark(userId, postId, commentId, folderId string) (bool, error)
+	GetBookmarks(userId string) ([]models.Bookmark, error)
+	GetBookmarkFolders(userId string) ([]models.BookmarkFolder, error)
+	AddBookmarkFolder(folder models.BookmarkFolder) error
+	DeleteBookmarkFolder(userId, folderId string) (bool, error)
+
+	// Subscription section
+	Subscribe(subscription models.Subscription) error
+	Unsubscribe(userId, postId, categoryId string) (bool, error)
+	GetSubscriptions(userId string) ([]models.Subscription, error)
+	GetSubscribers(postId string, categoryIds []string) ([]string, error)
+
+	// Reaction section
+	React(reaction models.Reaction) (bool, error)
+	GetReactions(postId, userId string) ([]models.ReactionCount, error)
+
+	// Badge section
+	EnsureBadge(badge models.Badge) error
+	AddBadge(badge models.Badge) error
+	GetBadges() ([]models.Badge, error)
+	GetUserBadges(userId string) ([]models.Badge, error)
+	AwardBadge(userId, badgeId, awardedBy string) (bool, error)
+	GetBadgeStats(userId string) (models.BadgeStats, error)
+
+	// Follow section
+	FollowUser(follow models.Follow) error
+	UnfollowUser(followerId, followedId string) (bool, error)
+	IsFollowing(followerId, followedId string) (bool, error)
+	CountFollows(userId string) (int, int, error)
+	GetFollowedUsers(followerId string) ([]string, error)
+
+	// Block section
+	AddBlock(block models.Block) error
+	RemoveBlock(userId, targetId, kind string) (bool, error)
+	GetBlocks(userId string) ([]models.Block, error)
+	IsBlocked(userId, targetId string) (bool, error)
+
+	// Message section
+	CreateConversation(conversation models.Conversation, userIds []string) error
+	FindConversation(userId, otherId string) (string, error)
+	GetConversations(userId string) ([]models.Conversation, error)
+	GetConversation(conversationId, userId string) (models.Conversation, error)
+	AddMessage(message models.Message) error
+	MarkConversationRead(conversationId, userId string, date time.Time) error
+	CountUnreadMessages(userId string) (int, error)
+	CountConversationsSince(userId string, since time.Time) (int, error)
+	GetMessage(messageId string) (models.Message, error)
+	RemoveMessage(messageId string) (bool, error)
+	ReportMessage(report models.MessageReport) error
+	GetMessageReports() ([]models.MessageReport, error)
+	UpdateMessageReportStatus(reportId, status string) error
+
+	// Poll section
+	AddPoll(poll models.Poll) error
+	GetPoll(postId, userId string) (*models.Poll, error)
+	VotePoll(pollId, userId string, optionIds []string) error
+	GetPollsToClose(now time.Time) ([]models.Poll, error)
+	MarkPollClosed(pollId string) error
+
+	// Attachment section
+	GetAttachments(postId string) ([]models.Attachment, error)
+	GetAttachment(attachmentId string) (models.Attachment, error)
+	AddAttachment(attachment models.Attachment) error
+	EditAttachmentCaption(attachmentId, caption string) error
+	ReorderAttachments(postId string, attachmentIds []string) error
+	DeleteAttachment(attachmentId string) error
+	MoveAttachmentImage(postId, imageURL, newImageURL string) error
+	CountImageUses(imageURL string) (int, error)
+	GetImageURLs() ([]string, error)
+
 	// Comment section
 	AddComment(comment models.Comment) error
-	DeleteComment(id string) error
 	EditComment(id, content string) error
 	GetComments(post models.Post) ([]models.Comment, error)
+	GetComment(id string) (models.Comment, error)
 
 	GetCategories() ([]models.Category, error)
 	AddCategory(name string) error
 	DeleteCategory(id string) error
 	EditCategory(id, name string) error
-	Vote(postId, commentId, userId string, isLike bool) error
+	Vote(postId, commentId, userId string, isLike bool, karma int) error
 	DeleteLikes(postId string) error
 	DeleteCommentLikes(commentId string) error
 
 	GetActivities(user models.User) ([]models.Activity, error)
 	CreateActivity(activity models.Activity) error
+	HasReactionActivity(actionUserId, postId, commentId, emoji string) (bool, error)
 	UpdateActivity(activity models.Activity) error
 	ReadActivites(userId string) error
 	//admin section
@@ -114,6 +259,10 @@ func New() Service {
 		log.Fatal("Error executing SQL script:", err)
 
 	}
+	err = migrate(db)
+	if err != nil {
+		log.Fatal("Error migrating database:", err)
+	}
 
 	fmt.Println("Database initialized successfully!")
 
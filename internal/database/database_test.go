@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) *service {
+	// Fresh in-memory database with the schema and the migrations of the forum
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a new database, keep a single one
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	schema, err := os.ReadFile("../../query.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(string(schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &service{db: db}
+}
+
+func addTestUser(t *testing.T, s *service, username string) string {
+	// Create a local user and return its id
+	user := models.User{UserId: username + "-id", Email: username + "@forum.test", Username: username, Role: "user", CreationDate: time.Now(), Provider: "local"}
+	err := s.CreateUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.UserId
+}
+
+func addTestPost(t *testing.T, s *service, userId, title string) string {
+	// Create a published post and return its id
+	post := models.Post{PostId: title + "-id", Title: title, Content: title, UserID: userId, CreationDate: time.Now()}
+	err := s.AddPost(post, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post.PostId
+}
+
+func addTestComment(t *testing.T, s *service, userId, postId, content string) string {
+	// Create a comment on a post and return its id
+	comment := models.Comment{CommentId: content + "-id", Content: content, CreationDate: time.Now(), UserID: userId, PostID: postId}
+	err := s.AddComment(comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return comment.CommentId
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"time"
+)
+
+func (s *service) GetDrafts(userId string) ([]models.Post, error) {
+	// Get the drafts and scheduled posts of a user, last edited first
+	rows, err := s.db.Query(`
+		SELECT post_id, title, content, status, publish_date, creation_date, update_date
+		FROM Post
+		WHERE user_id = ? AND status != 'published' AND deletion_date IS NULL
+		ORDER BY COALESCE(update_date, creation_date) DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var drafts []models.Post
+	for rows.Next() {
+		draft := models.Post{UserID: userId}
+		err = rows.Scan(&draft.PostId, &draft.Title, &draft.Content, &draft.Status, &draft.PublishDate, &draft.CreationDate, &draft.UpdateDate)
+		if err != nil {
+			return nil, err
+		}
+		edited := draft.CreationDate
+		if draft.UpdateDate.Valid {
+			edited = draft.UpdateDate.Time
+		}
+		draft.FormattedCreationDate = edited.Format("Jan 02, 2006 - 15:04")
+		if draft.PublishDate.Valid {
+			draft.FormattedPublishDate = draft.PublishDate.Time.Format("Jan 02, 2006 - 15:04")
+		}
+		drafts = append(drafts, draft)
+	}
+	return drafts, rows.Err()
+}
+
+func (s *service) UpdateDraft(post models.Post, categories []models.Category) error {
+	// Save a draft again with its categories, a published post is never changed here
+	slug, err := uniqueSlug(s.db, post.Title, post.PostId)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE Post SET title=?, slug=?, content=?, status=?, publish_date=?, update_date=? WHERE post_id=? AND status != 'published'",
+		post.Title, slug, post.Content, post.Status, post.PublishDate, time.Now(), post.PostId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Post_Category WHERE post_id=?", post.PostId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, category := range categories {
+		_, err = tx.Exec("INSERT INTO Post_Category (post_id,category_id) VALUES (?,?)", post.PostId, category.CategoryId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) ReplacePoll(postId string, poll *models.Poll) error {
+	// Replace the poll of a draft, nil removes it
+	err := deletePolls(s.db, postId)
+	if err != nil || poll == nil {
+		return err
+	}
+	return s.AddPoll(*poll)
+}
+
+func (s *service) PublishPost(id string, now time.Time) (bool, error) {
+	// Publish a draft dated now, false when it was already published
+	result, err := s.db.Exec("UPDATE Post SET status='published', creation_date=?, publish_date=NULL WHERE post_id=? AND status != 'published' AND deletion_date IS NULL", now, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) GetScheduledPosts(now time.Time) ([]models.Post, error) {
+	// Get the scheduled posts whose publish date has come
+	rows, err := s.db.Query("SELECT post_id, title, content, user_id, publish_date FROM Post WHERE status = 'scheduled' AND publish_date <= ? AND deletion_date IS NULL", now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		err = rows.Scan(&post.PostId, &post.Title, &post.Content, &post.UserID, &post.PublishDate)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"forum-go/internal/models"
+)
+
+func (s *service) FollowUser(follow models.Follow) error {
+	// Follow a user, following him twice changes nothing
+	_, err := s.db.Exec("INSERT OR IGNORE INTO Follow (follow_id, follower_id, followed_id, creation_date) VALUES (?, ?, ?, ?)",
+		follow.FollowId, follow.FollowerId, follow.FollowedId, follow.CreationDate)
+	return err
+}
+
+func (s *service) UnfollowUser(followerId, followedId string) (bool, error) {
+	// Stop following a user, false when he was not followed
+	result, err := s.db.Exec("DELETE FROM Follow WHERE follower_id=? AND followed_id=?", followerId, followedId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) IsFollowing(followerId, followedId string) (bool, error) {
+	// Check a user follows another
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Follow WHERE follower_id=? AND followed_id=?", followerId, followedId).Scan(&n)
+	return n > 0, err
+}
+
+func (s *service) CountFollows(userId string) (int, int, error) {
+	// Count the followers of a user and the users he follows, the users in the trash are left out
+	var followers, following int
+	err := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM Follow f JOIN User u ON f.follower_id = u.user_id WHERE f.followed_id = ? AND u.deletion_date IS NULL),
+			(SELECT COUNT(*) FROM Follow f JOIN User u ON f.followed_id = u.user_id WHERE f.follower_id = ? AND u.deletion_date IS NULL)`,
+		userId, userId).Scan(&followers, &following)
+	return followers, following, err
+}
+
+func (s *service) GetFollowedUsers(followerId string) ([]string, error) {
+	// Get the ids of the users a user follows
+	rows, err := s.db.Query("SELECT f.followed_id FROM Follow f JOIN User u ON f.followed_id = u.user_id WHERE f.follower_id = ? AND u.deletion_date IS NULL", followerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIds []string
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+)
+
+// Votes counted when a post or a comment goes to the trash or comes back from it
+var karmaConditions = map[string]string{
+	models.TRASH_POST:    "l.post_id = ? AND l.comment_id = ''",
+	models.TRASH_COMMENT: "l.comment_id = ?",
+}
+
+func shiftKarma(db execer, sign int, condition string, args ...interface{}) error {
+	// Add, or remove with a sign of -1, the karma of the votes matching a condition on l
+	// to the authors of their post or comment, content in the trash counts for nothing
+	query := `
+		INSERT INTO User_Karma (user_id, post_karma, comment_karma)
+		SELECT author, ? * SUM(post), ? * SUM(comment) FROM (
+			SELECT p.user_id AS author, l.karma AS post, 0 AS comment
+			FROM User_Like l JOIN Post p ON l.post_id = p.post_id
+			WHERE l.comment_id = '' AND p.deletion_date IS NULL AND ` + condition + `
+			UNION ALL
+			SELECT c.user_id, 0, l.karma
+			FROM User_Like l JOIN Comment c ON l.comment_id = c.comment_id
+			WHERE c.deletion_date IS NULL AND ` + condition + `
+		) WHERE true GROUP BY author
+		ON CONFLICT(user_id) DO UPDATE SET
+			post_karma = post_karma + excluded.post_karma,
+			comment_karma = comment_karma + excluded.comment_karma`
+	params := []interface{}{sign, sign}
+	params = append(params, args...)
+	params = append(params, args...)
+	_, err := db.Exec(query, params...)
+	return err
+}
+
+func deleteVotes(db execer, condition string, args ...interface{}) error {
+	// Take back the karma of the votes matching a condition on l, then delete them.
+	// Both must happen in the transaction of the caller, or a retry takes the karma back twice
+	err := shiftKarma(db, -1, condition, args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM User_Like WHERE like_id IN (SELECT l.like_id FROM User_Like l WHERE "+condition+")", args...)
+	return err
+}
+
+func addKarma(db execer, userId string, isComment bool, karma int) error {
+	// Add the karma of a vote to the author of the voted post or comment
+	if karma == 0 {
+		return nil
+	}
+	postKarma, commentKarma := karma, 0
+	if isComment {
+		postKarma, commentKarma = 0, karma
+	}
+	_, err := db.Exec(`
+		INSERT INTO User_Karma (user_id, post_karma, comment_karma) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			post_karma = post_karma + excluded.post_karma,
+			comment_karma = comment_karma + excluded.comment_karma`, userId, postKarma, commentKarma)
+	return err
+}
+
+func (s *service) GetKarma(userId string) (models.Karma, error) {
+	// Karma stored for a user, votes on his own content and on the trash don't count
+	var karma models.Karma
+	err := s.db.QueryRow("SELECT post_karma, comment_karma FROM User_Karma WHERE user_id = ?", userId).Scan(&karma.Posts, &karma.Comments)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	karma.Total = karma.Posts + karma.Comments
+	return karma, err
+}
@@ -0,0 +1,90 @@
+package database
+
+import "testing"
+
+func wantKarma(t *testing.T, s *service, userId, step string, posts, comments int) {
+	// Fail when the stored karma of a user is not the expected one after a step
+	t.Helper()
+	karma, err := s.GetKarma(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if karma.Posts != posts || karma.Comments != comments || karma.Total != posts+comments {
+		t.Errorf("%s: karma = %+v, want %d for posts and %d for comments", step, karma, posts, comments)
+	}
+}
+
+func TestVoteKarma(t *testing.T) {
+	s := newTestService(t)
+	alice := addTestUser(t, s, "alice")
+	bob := addTestUser(t, s, "bob")
+	postId := addTestPost(t, s, alice, "hello")
+	commentId := addTestComment(t, s, alice, postId, "first")
+	steps := []struct {
+		name      string
+		userId    string
+		commentId string
+		isLike    bool
+		karma     int
+		posts     int
+		comments  int
+	}{
+		{"like", bob, "", true, 2, 2, 0},
+		{"flip to dislike", bob, "", false, -1, -1, 0},
+		{"unvote", bob, "", false, -1, 0, 0},
+		{"like a comment", bob, commentId, true, 1, 0, 1},
+		{"unvote a comment", bob, commentId, true, 1, 0, 0},
+		{"own post", alice, "", true, 2, 0, 0},
+	}
+	for _, step := range steps {
+		err := s.Vote(postId, step.commentId, step.userId, step.isLike, step.karma)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantKarma(t, s, alice, step.name, step.posts, step.comments)
+	}
+}
+
+func TestDeleteUserKarmaOnce(t *testing.T) {
+	s := newTestService(t)
+	alice := addTestUser(t, s, "alice")
+	bob := addTestUser(t, s, "bob")
+	postId := addTestPost(t, s, alice, "hello")
+	bobPost := addTestPost(t, s, bob, "bye")
+	err := s.Vote(postId, "", bob, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Vote(bobPost, "", alice, true, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failure at the last statement leaves the votes and their karma as they were
+	_, err = s.db.Exec("CREATE TRIGGER fail_delete BEFORE DELETE ON User BEGIN SELECT RAISE(ABORT, 'failed'); END")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.deleteUser(bob) == nil {
+		t.Fatal("deleteUser succeeded despite the trigger")
+	}
+	wantKarma(t, s, alice, "failed delete", 2, 0)
+	post, err := s.GetPost(bobPost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.PostId != bobPost {
+		t.Error("failed delete removed the posts of the user")
+	}
+
+	// The retry takes the karma back once
+	_, err = s.db.Exec("DROP TRIGGER fail_delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.deleteUser(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKarma(t, s, alice, "deleted", 0, 0)
+}
@@ -6,19 +6,44 @@ import (
 	"forum-go/internal/shared"
 )
 
-func (s *service) Vote(postID, commentID, userID string, isLike bool) error {
-	// Check if user has already liked or disliked the post
+func (s *service) Vote(postID, commentID, userID string, isLike bool, karma int) error {
+	// Like or dislike a post or a comment, voting the same twice takes the vote back.
+	// The author gets the karma of the vote, nothing on his own content, and his
+	// karma only moves while the content is out of the trash
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	isComment := commentID != "''" && commentID != ""
 	var row *sql.Row
+	if isComment {
+		row = tx.QueryRow("SELECT user_id, deletion_date IS NULL FROM Comment WHERE comment_id=?", commentID)
+	} else {
+		row = tx.QueryRow("SELECT user_id, deletion_date IS NULL FROM Post WHERE post_id=?", postID)
+	}
+	var authorID string
+	var online bool
+	if err := row.Scan(&authorID, &online); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return err
+	}
+	if authorID == userID {
+		karma = 0
+	}
+
+	// Check if user has already liked or disliked the post
 	var userlike models.UserLike
-	if commentID != "''" && commentID != "" {
-		query := "SELECT * FROM User_like WHERE comment_id=? AND user_id=?"
-		row = s.db.QueryRow(query, commentID, userID)
+	var previous int
+	if isComment {
+		query := "SELECT like_id, isLiked, user_id, post_id, comment_id, karma FROM User_like WHERE comment_id=? AND user_id=?"
+		row = tx.QueryRow(query, commentID, userID)
 	} else {
-		query := "SELECT * FROM User_like WHERE post_id=? AND user_id=? AND comment_id = ''"
-		row = s.db.QueryRow(query, postID, userID)
+		query := "SELECT like_id, isLiked, user_id, post_id, comment_id, karma FROM User_like WHERE post_id=? AND user_id=? AND comment_id = ''"
+		row = tx.QueryRow(query, postID, userID)
 	}
-	if err := row.Scan(&userlike.LikeId, &userlike.IsLike, &userlike.UserId, &userlike.PostId, &userlike.CommentId); err != nil {
+	if err := row.Scan(&userlike.LikeId, &userlike.IsLike, &userlike.UserId, &userlike.PostId, &userlike.CommentId, &previous); err != nil {
 		if err != sql.ErrNoRows {
+			tx.Rollback()
 			return err
 		}
 		userlike.LikeId = ""
@@ -27,26 +52,34 @@ func (s *service) Vote(postID, commentID, userID string, isLike bool) error {
 	if userlike.LikeId == "" {
 		// If user has not liked or disliked the post, insert the like
 		userlike.LikeId = shared.ParseUUID(shared.GenerateUUID())
-		query := "INSERT INTO User_like (like_id, user_id, post_id, comment_id, isLiked) VALUES (?,?,?,?,?)"
-		_, err := s.db.Exec(query, userlike.LikeId, userID, postID, commentID, isLike)
-		return err
-	}
-
-	if userlike.IsLike == isLike {
+		query := "INSERT INTO User_like (like_id, user_id, post_id, comment_id, isLiked, karma) VALUES (?,?,?,?,?,?)"
+		_, err = tx.Exec(query, userlike.LikeId, userID, postID, commentID, isLike, karma)
+	} else if userlike.IsLike == isLike {
 		// If user has already liked or disliked the post, delete the like
-		_, err := s.db.Exec("DELETE FROM User_like WHERE like_id=?", userlike.LikeId)
+		_, err = tx.Exec("DELETE FROM User_like WHERE like_id=?", userlike.LikeId)
+		karma = 0
+	} else {
+		// If user has already liked or disliked the post, update the like
+		query := "UPDATE User_like SET isLiked=?, karma=? WHERE like_id=?"
+		_, err = tx.Exec(query, isLike, karma, userlike.LikeId)
+	}
+	if err != nil {
+		tx.Rollback()
 		return err
-
 	}
-	// If user has already liked or disliked the post, update the like
-	query := "UPDATE User_like SET isLiked=? WHERE like_id=?"
-	_, err := s.db.Exec(query, isLike, userlike.LikeId)
-	return err
+	if online {
+		err = addKarma(tx, authorID, isComment, karma-previous)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 func (s *service) GetPostLikes(postID string) ([]models.UserLike, error) {
 	// Query to get all likes for a post
-	query := "SELECT * FROM User_like WHERE post_id=? AND comment_id = ''"
+	query := "SELECT like_id, isLiked, user_id, post_id, comment_id FROM User_like WHERE post_id=? AND comment_id = ''"
 	rows, err := s.db.Query(query, postID)
 	if err != nil {
 		return nil, err
@@ -68,7 +101,7 @@ func (s *service) GetPostLikes(postID string) ([]models.UserLike, error) {
 }
 func (s *service) GetCommentLikes(commentID string) ([]models.UserLike, error) {
 	// Query to get all likes for a comment
-	query := "SELECT * FROM User_like WHERE comment_id=?"
+	query := "SELECT like_id, isLiked, user_id, post_id, comment_id FROM User_like WHERE comment_id=?"
 	rows, err := s.db.Query(query, commentID)
 	if err != nil {
 		return nil, err
@@ -103,14 +136,29 @@ func (s *service) GetLikesCount(userlikes []models.UserLike) (int, int) {
 }
 
 func (s *service) DeleteLikes(postID string) error {
-	// Delete all likes for a post
-	query := "DELETE FROM User_like WHERE post_id=?"
-	_, err := s.db.Exec(query, postID)
-	return err
+	// Delete all likes for a post and the karma they gave
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = deleteVotes(tx, "l.post_id = ?", postID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
+
 func (s *service) DeleteCommentLikes(commentID string) error {
-	// Delete all likes for a comment
-	query := "DELETE FROM User_like WHERE comment_id=?"
-	_, err := s.db.Exec(query, commentID)
-	return err
+	// Delete all likes for a comment and the karma they gave
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = deleteVotes(tx, "l.comment_id = ?", commentID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,227 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"time"
+)
+
+// Conversations of a participant, with the other participant, the last message and the number of unread messages
+const conversationsQuery = `
+	SELECT c.conversation_id, c.creator_id, c.creation_date, c.update_date, o.user_id, o.username,
+		COALESCE((SELECT m.content FROM Message m WHERE m.conversation_id = c.conversation_id AND m.deletion_date IS NULL
+			ORDER BY m.creation_date DESC LIMIT 1), ''),
+		(SELECT COUNT(*) FROM Message m WHERE m.conversation_id = c.conversation_id AND m.user_id != p.user_id
+			AND m.deletion_date IS NULL AND (p.last_read_date IS NULL OR m.creation_date > p.last_read_date))
+	FROM Participant p
+	JOIN Conversation c ON p.conversation_id = c.conversation_id
+	JOIN Participant po ON po.conversation_id = c.conversation_id AND po.user_id != p.user_id
+	JOIN User o ON po.user_id = o.user_id
+	WHERE p.user_id = ? AND o.deletion_date IS NULL`
+
+func scanConversation(row interface{ Scan(...any) error }) (models.Conversation, error) {
+	var conversation models.Conversation
+	err := row.Scan(&conversation.ConversationId, &conversation.CreatorId, &conversation.CreationDate, &conversation.UpdateDate,
+		&conversation.Other.UserId, &conversation.Other.Username, &conversation.LastMessage, &conversation.NbOfUnread)
+	conversation.FormattedUpdateDate = conversation.UpdateDate.Format("02/01/06 - 15:04")
+	return conversation, err
+}
+
+func (s *service) CreateConversation(conversation models.Conversation, userIds []string) error {
+	// Create a conversation between users
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO Conversation (conversation_id, creator_id, creation_date, update_date) VALUES (?, ?, ?, ?)",
+		conversation.ConversationId, conversation.CreatorId, conversation.CreationDate, conversation.UpdateDate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, userId := range userIds {
+		_, err = tx.Exec("INSERT INTO Participant (conversation_id, user_id) VALUES (?, ?)", conversation.ConversationId, userId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) FindConversation(userId, otherId string) (string, error) {
+	// Get the conversation between two users, an empty id when they have none
+	var conversationId string
+	err := s.db.QueryRow(`
+		SELECT p.conversation_id FROM Participant p
+		JOIN Participant po ON p.conversation_id = po.conversation_id
+		WHERE p.user_id = ? AND po.user_id = ? LIMIT 1`, userId, otherId).Scan(&conversationId)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return conversationId, err
+}
+
+func (s *service) GetConversations(userId string) ([]models.Conversation, error) {
+	// Get the inbox of a user, the conversations with the latest messages first
+	rows, err := s.db.Query(conversationsQuery+" ORDER BY c.update_date DESC", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var conversations []models.Conversation
+	for rows.Next() {
+		conversation, err := scanConversation(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, rows.Err()
+}
+
+func (s *service) GetConversation(conversationId, userId string) (models.Conversation, error) {
+	// Get a conversation of a user with its messages, an empty Conversation when he is not part of it
+	conversation, err := scanConversation(s.db.QueryRow(conversationsQuery+" AND c.conversation_id = ?", userId, conversationId))
+	if err == sql.ErrNoRows {
+		return models.Conversation{}, nil
+	}
+	if err != nil {
+		return models.Conversation{}, err
+	}
+	rows, err := s.db.Query(`
+		SELECT m.message_id, m.user_id, u.username, m.content, m.creation_date, m.deletion_date
+		FROM Message m
+		JOIN User u ON m.user_id = u.user_id
+		WHERE m.conversation_id = ?
+		ORDER BY m.creation_date`, conversationId)
+	if err != nil {
+		return models.Conversation{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		message := models.Message{ConversationId: conversationId}
+		err = rows.Scan(&message.MessageId, &message.UserId, &message.Username, &message.Content, &message.CreationDate, &message.DeletionDate)
+		if err != nil {
+			return models.Conversation{}, err
+		}
+		message.FormattedCreationDate = message.CreationDate.Format("02/01/06 - 15:04")
+		conversation.Messages = append(conversation.Messages, message)
+	}
+	return conversation, rows.Err()
+}
+
+func (s *service) AddMessage(message models.Message) error {
+	// Add a message to a conversation, which moves to the top of the inboxes
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO Message (message_id, conversation_id, user_id, content, creation_date) VALUES (?, ?, ?, ?, ?)",
+		message.MessageId, message.ConversationId, message.UserId, message.Content, message.CreationDate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE Conversation SET update_date=? WHERE conversation_id=?", message.CreationDate, message.ConversationId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE Participant SET last_read_date=? WHERE conversation_id=? AND user_id=?", message.CreationDate, message.ConversationId, message.UserId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *service) MarkConversationRead(conversationId, userId string, date time.Time) error {
+	// Mark the messages of a conversation sent until a date as read by a participant
+	_, err := s.db.Exec("UPDATE Participant SET last_read_date=? WHERE conversation_id=? AND user_id=?", date, conversationId, userId)
+	return err
+}
+
+func (s *service) CountUnreadMessages(userId string) (int, error) {
+	// Count the unread messages of a user in all his conversations, the ones of users in the trash are left out
+	var n int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM Message m
+		JOIN Participant p ON m.conversation_id = p.conversation_id AND p.user_id = ?
+		JOIN User u ON m.user_id = u.user_id
+		WHERE m.user_id != p.user_id AND m.deletion_date IS NULL AND u.deletion_date IS NULL
+			AND (p.last_read_date IS NULL OR m.creation_date > p.last_read_date)`, userId).Scan(&n)
+	return n, err
+}
+
+func (s *service) CountConversationsSince(userId string, since time.Time) (int, error) {
+	// Count the conversations a user started since a date
+	var n int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Conversation WHERE creator_id=? AND creation_date > ?", userId, since).Scan(&n)
+	return n, err
+}
+
+func (s *service) GetMessage(messageId string) (models.Message, error) {
+	// Get a message, an empty Message when it does not exist
+	var message models.Message
+	err := s.db.QueryRow("SELECT message_id, conversation_id, user_id, content, creation_date, deletion_date FROM Message WHERE message_id=?", messageId).
+		Scan(&message.MessageId, &message.ConversationId, &message.UserId, &message.Content, &message.CreationDate, &message.DeletionDate)
+	if err == sql.ErrNoRows {
+		return models.Message{}, nil
+	}
+	return message, err
+}
+
+func (s *service) RemoveMessage(messageId string) (bool, error) {
+	// Hide a message from its conversation, false when it already was
+	result, err := s.db.Exec("UPDATE Message SET deletion_date=? WHERE message_id=? AND deletion_date IS NULL", time.Now(), messageId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) ReportMessage(report models.MessageReport) error {
+	// Report a message to the admins
+	_, err := s.db.Exec("INSERT INTO Message_Report (report_id, message_id, user_id, reason, status, creation_date) VALUES (?, ?, ?, ?, ?, ?)",
+		report.ReportId, report.MessageId, report.UserId, report.Reason, report.Status, report.CreationDate)
+	return err
+}
+
+func (s *service) GetMessageReports() ([]models.MessageReport, error) {
+	// Get the reports of messages, last first, with the reported message and its author
+	rows, err := s.db.Query(`
+		SELECT r.report_id, r.message_id, r.user_id, ru.username, r.reason, r.status, r.creation_date,
+			m.conversation_id, m.user_id, mu.username, m.content, m.creation_date, m.deletion_date
+		FROM Message_Report r
+		JOIN User ru ON r.user_id = ru.user_id
+		JOIN Message m ON r.message_id = m.message_id
+		JOIN User mu ON m.user_id = mu.user_id
+		ORDER BY r.creation_date DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reports []models.MessageReport
+	for rows.Next() {
+		var report models.MessageReport
+		message := &report.Message
+		err = rows.Scan(&report.ReportId, &report.MessageId, &report.UserId, &report.Username, &report.Reason, &report.Status, &report.CreationDate,
+			&message.ConversationId, &message.UserId, &message.Username, &message.Content, &message.CreationDate, &message.DeletionDate)
+		if err != nil {
+			return nil, err
+		}
+		message.MessageId = report.MessageId
+		message.FormattedCreationDate = message.CreationDate.Format("02/01/06 - 15:04")
+		report.FormattedCreationDate = report.CreationDate.Format("2006-01-02 15:04:05")
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
+
+func (s *service) UpdateMessageReportStatus(reportId, status string) error {
+	// Accept or reject the report of a message
+	_, err := s.db.Exec("UPDATE Message_Report SET status=? WHERE report_id=?", status, reportId)
+	return err
+}
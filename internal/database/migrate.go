@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Columns added to tables after their creation. CREATE TABLE IF NOT EXISTS
+// leaves existing databases untouched, so they are added by migrate.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"OAuth_State", "user_id", "CHAR(32)"},
+	{"Post", "slug", "VARCHAR(100)"},
+	{"Post", "status", "VARCHAR(20) NOT NULL DEFAULT 'published'"},
+	{"Post", "publish_date", "DATETIME"},
+	{"Post", "pinned", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Post", "pinned_category_id", "CHAR(32)"},
+	{"Post", "locked", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Post", "archived", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"Post", "deletion_date", "DATETIME"},
+	{"Post", "deleted_by", "CHAR(32)"},
+	{"Comment", "deletion_date", "DATETIME"},
+	{"Comment", "deleted_by", "CHAR(32)"},
+	{"User", "deletion_date", "DATETIME"},
+	{"User", "deleted_by", "CHAR(32)"},
+	{"User_Like", "karma", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// Indexes on added columns, created once the columns exist
+var addedIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS Post_status ON Post(status, publish_date)",
+}
+
+func migrate(db *sql.DB) error {
+	// Add the missing columns to the tables of an existing database
+	hasKarma, err := hasColumn(db, "User_Like", "karma")
+	if err != nil {
+		return err
+	}
+	for _, c := range addedColumns {
+		exists, err := hasColumn(db, c.table, c.column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition))
+		if err != nil {
+			return err
+		}
+	}
+	for _, index := range addedIndexes {
+		_, err := db.Exec(index)
+		if err != nil {
+			return err
+		}
+	}
+	if !hasKarma {
+		err = fillKarma(db)
+		if err != nil {
+			return err
+		}
+	}
+	err = moveImagesToAttachments(db)
+	if err != nil {
+		return err
+	}
+	return fillPostSlugs(db)
+}
+
+func moveImagesToAttachments(db *sql.DB) error {
+	// Posts used to hold a single image in Post.image_url, it becomes their first attachment
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO Attachment (attachment_id, post_id, image_url, caption, position, creation_date)
+		SELECT lower(hex(randomblob(16))), post_id, image_url, '', 0, creation_date
+		FROM Post WHERE image_url IS NOT NULL AND image_url != ''`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE Post SET image_url = '' WHERE image_url IS NOT NULL AND image_url != ''")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func fillKarma(db *sql.DB) error {
+	// Votes cast before the karma was stored are worth one point, or none on the content of their voter
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE User_Like SET karma = CASE WHEN isLiked THEN 1 ELSE -1 END
+		WHERE user_id != COALESCE(
+			(SELECT c.user_id FROM Comment c WHERE c.comment_id = User_Like.comment_id),
+			(SELECT p.user_id FROM Post p WHERE p.post_id = User_Like.post_id AND User_Like.comment_id = ''),
+			user_id)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = shiftKarma(tx, 1, "1 = 1")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func fillPostSlugs(db *sql.DB) error {
+	// Posts created before slugs existed get one from their title
+	rows, err := db.Query("SELECT post_id, title FROM Post WHERE slug IS NULL OR slug = '' ORDER BY creation_date")
+	if err != nil {
+		return err
+	}
+	type untitled struct{ id, title string }
+	var posts []untitled
+	for rows.Next() {
+		var post untitled
+		if err := rows.Scan(&post.id, &post.title); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	for _, post := range posts {
+		slug, err := uniqueSlug(db, post.title, post.id)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec("UPDATE Post SET slug = ? WHERE post_id = ?", slug, post.id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS Post_slug ON Post(slug)")
+	return err
+}
+
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"time"
+)
+
+func (s *service) CreateOAuthState(state models.OAuthState) error {
+	// Store the state of a login started on a provider, expired ones are cleaned up on the way
+	_, err := s.db.Exec("DELETE FROM OAuth_State WHERE expire_date < ?", time.Now())
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO OAuth_State (state, provider, nonce, code_verifier, expire_date, user_id) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err = s.db.Exec(query, state.State, state.Provider, state.Nonce, state.CodeVerifier, state.ExpireDate, sql.NullString{String: state.UserId, Valid: state.UserId != ""})
+	return err
+}
+
+func (s *service) ConsumeOAuthState(state string) (models.OAuthState, error) {
+	// Get a login state and delete it so it can only be used once
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.OAuthState{}, err
+	}
+	defer tx.Rollback()
+	var oauthState models.OAuthState
+	var userId sql.NullString
+	row := tx.QueryRow("SELECT state, provider, nonce, code_verifier, expire_date, user_id FROM OAuth_State WHERE state=?", state)
+	err = row.Scan(&oauthState.State, &oauthState.Provider, &oauthState.Nonce, &oauthState.CodeVerifier, &oauthState.ExpireDate, &userId)
+	if err != nil {
+		return models.OAuthState{}, err
+	}
+	oauthState.UserId = userId.String
+	_, err = tx.Exec("DELETE FROM OAuth_State WHERE state=?", state)
+	if err != nil {
+		return models.OAuthState{}, err
+	}
+	return oauthState, tx.Commit()
+}
+
+func (s *service) GetIdentity(provider, subject string) (models.UserIdentity, error) {
+	// Get the link of a provider account
+	query := "SELECT identity_id, user_id, provider, subject, IFNULL(email, ''), creation_date FROM User_Identity WHERE provider=? AND subject=?"
+	row := s.db.QueryRow(query, provider, subject)
+	var identity models.UserIdentity
+	err := row.Scan(&identity.IdentityId, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreationDate)
+	return identity, err
+}
+
+func (s *service) GetUserIdentities(userId string) ([]models.UserIdentity, error) {
+	// Get the provider accounts linked to a user
+	query := "SELECT identity_id, user_id, provider, subject, IFNULL(email, ''), creation_date FROM User_Identity WHERE user_id=? ORDER BY creation_date"
+	rows, err := s.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		err := rows.Scan(&identity.IdentityId, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (s *service) CreateIdentity(identity models.UserIdentity) error {
+	// Link a provider account to a user
+	query := "INSERT INTO User_Identity (identity_id, user_id, provider, subject, email, creation_date) VALUES (?, ?, ?, ?, ?, ?)"
+	_, err := s.db.Exec(query, identity.IdentityId, identity.UserId, identity.Provider, identity.Subject, identity.Email, identity.CreationDate)
+	return err
+}
+
+func (s *service) DeleteIdentity(identityId string) error {
+	// Unlink a provider account
+	_, err := s.db.Exec("DELETE FROM User_Identity WHERE identity_id=?", identityId)
+	return err
+}
+
+func (s *service) SetUserProvider(userId, provider string) error {
+	// Change the provider an account was created with
+	_, err := s.db.Exec("UPDATE User SET provider=? WHERE user_id=?", provider, userId)
+	return err
+}
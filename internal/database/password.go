@@ -0,0 +1,45 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"time"
+)
+
+func (s *service) CreatePasswordReset(reset models.PasswordReset) error {
+	// Insert a new password reset token, previous unused tokens of the user are discarded
+	_, err := s.db.Exec("DELETE FROM Password_Reset WHERE user_id=? AND used=0", reset.UserId)
+	if err != nil {
+		return err
+	}
+	query := "INSERT INTO Password_Reset (reset_id, user_id, token_hash, expire_date, used, creation_date) VALUES (?,?,?,?,?,?)"
+	_, err = s.db.Exec(query, reset.ResetId, reset.UserId, reset.TokenHash, reset.ExpireDate, reset.Used, reset.CreationDate)
+	return err
+}
+
+func (s *service) GetPasswordReset(tokenHash string) (models.PasswordReset, error) {
+	// Get a password reset token by its hash
+	query := "SELECT reset_id, user_id, token_hash, expire_date, used, creation_date FROM Password_Reset WHERE token_hash=?"
+	row := s.db.QueryRow(query, tokenHash)
+	var reset models.PasswordReset
+	if err := row.Scan(&reset.ResetId, &reset.UserId, &reset.TokenHash, &reset.ExpireDate, &reset.Used, &reset.CreationDate); err != nil {
+		return models.PasswordReset{}, err
+	}
+	return reset, nil
+}
+
+func (s *service) UsePasswordReset(resetId string, now time.Time) (bool, error) {
+	// Mark a password reset token as used so it can't be replayed, false when it was already used or has expired
+	result, err := s.db.Exec("UPDATE Password_Reset SET used=1 WHERE reset_id=? AND used=0 AND expire_date>?", resetId, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) UpdatePassword(userId, passwordHash string) error {
+	// Update the password of a user and invalidate all of his sessions
+	query := "UPDATE User SET password=?, session_id=NULL, session_expire=NULL WHERE user_id=?"
+	_, err := s.db.Exec(query, passwordHash, userId)
+	return err
+}
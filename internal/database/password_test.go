@@ -0,0 +1,40 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"testing"
+	"time"
+)
+
+func TestUsePasswordResetOnce(t *testing.T) {
+	s := newTestService(t)
+	userId := addTestUser(t, s, "alice")
+	now := time.Now()
+	reset := models.NewPasswordReset(userId, "hash", now.Add(time.Hour))
+	expired := models.NewPasswordReset(userId, "old-hash", now.Add(-time.Minute))
+	for _, r := range []models.PasswordReset{reset, expired} {
+		_, err := s.db.Exec("INSERT INTO Password_Reset (reset_id, user_id, token_hash, expire_date, used, creation_date) VALUES (?,?,?,?,?,?)",
+			r.ResetId, r.UserId, r.TokenHash, r.ExpireDate, r.Used, r.CreationDate)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name    string
+		resetId string
+		want    bool
+	}{
+		{"first use", reset.ResetId, true},
+		{"replayed", reset.ResetId, false},
+		{"expired", expired.ResetId, false},
+	}
+	for _, tt := range tests {
+		used, err := s.UsePasswordReset(tt.resetId, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used != tt.want {
+			t.Errorf("%s: used = %v, want %v", tt.name, used, tt.want)
+		}
+	}
+}
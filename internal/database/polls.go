@@ -0,0 +1,167 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"forum-go/internal/models"
+	"time"
+)
+
+// ErrAlreadyVoted is returned when a user votes twice in the same poll.
+var ErrAlreadyVoted = errors.New("already voted in this poll")
+
+// ErrInvalidOption is returned when a vote names an option of another poll.
+var ErrInvalidOption = errors.New("invalid poll option")
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *service) AddPoll(poll models.Poll) error {
+	// Add a poll to a post with its options
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO Poll (poll_id, post_id, question, multiple, close_date, creation_date) VALUES (?, ?, ?, ?, ?, ?)",
+		poll.PollId, poll.PostId, poll.Question, poll.Multiple, poll.CloseDate, poll.CreationDate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, option := range poll.Options {
+		_, err = tx.Exec("INSERT INTO Poll_Option (option_id, poll_id, label, position) VALUES (?, ?, ?, ?)",
+			option.OptionId, poll.PollId, option.Label, option.Position)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) GetPoll(postId, userId string) (*models.Poll, error) {
+	// Get the poll of a post with its results and the choices of userId, nil if the post has none
+	poll := &models.Poll{}
+	err := s.db.QueryRow("SELECT poll_id, post_id, question, multiple, close_date, closed_notified, creation_date FROM Poll WHERE post_id=?", postId).
+		Scan(&poll.PollId, &poll.PostId, &poll.Question, &poll.Multiple, &poll.CloseDate, &poll.ClosedNotified, &poll.CreationDate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow("SELECT COUNT(*), COALESCE(SUM(user_id = ?), 0) FROM Poll_Ballot WHERE poll_id=?", userId, poll.PollId).
+		Scan(&poll.NbOfVoters, &poll.HasVoted)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`
+		SELECT o.option_id, o.poll_id, o.label, o.position,
+			(SELECT COUNT(*) FROM Poll_Vote v WHERE v.option_id = o.option_id),
+			EXISTS (SELECT 1 FROM Poll_Vote v WHERE v.option_id = o.option_id AND v.user_id = ?)
+		FROM Poll_Option o
+		WHERE o.poll_id = ?
+		ORDER BY o.position`, userId, poll.PollId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var option models.PollOption
+		err = rows.Scan(&option.OptionId, &option.PollId, &option.Label, &option.Position, &option.Votes, &option.Chosen)
+		if err != nil {
+			return nil, err
+		}
+		if poll.NbOfVoters > 0 {
+			option.Percent = option.Votes * 100 / poll.NbOfVoters
+		}
+		poll.Options = append(poll.Options, option)
+	}
+	if poll.CloseDate.Valid {
+		poll.FormattedCloseDate = poll.CloseDate.Time.Format("Jan 02, 2006 - 15:04")
+	}
+	return poll, rows.Err()
+}
+
+func (s *service) VotePoll(pollId, userId string, optionIds []string) error {
+	// Record the ballot of a user, the database refuses a second one
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	var voted int
+	err = tx.QueryRow("SELECT COUNT(*) FROM Poll_Ballot WHERE poll_id=? AND user_id=?", pollId, userId).Scan(&voted)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if voted > 0 {
+		tx.Rollback()
+		return ErrAlreadyVoted
+	}
+	_, err = tx.Exec("INSERT INTO Poll_Ballot (poll_id, user_id, creation_date) VALUES (?, ?, ?)", pollId, userId, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, optionId := range optionIds {
+		result, err := tx.Exec("INSERT INTO Poll_Vote (poll_id, user_id, option_id) SELECT poll_id, ?, option_id FROM Poll_Option WHERE option_id=? AND poll_id=?",
+			userId, optionId, pollId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, _ := result.RowsAffected(); n != 1 {
+			tx.Rollback()
+			return ErrInvalidOption
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) GetPollsToClose(now time.Time) ([]models.Poll, error) {
+	// Get the polls past their close date whose author wasn't told yet
+	rows, err := s.db.Query(`
+		SELECT pl.poll_id, pl.post_id, pl.question, pl.multiple, pl.close_date, pl.closed_notified, pl.creation_date, p.title, p.user_id
+		FROM Poll pl
+		JOIN Post p ON pl.post_id = p.post_id
+		WHERE pl.close_date IS NOT NULL AND pl.close_date <= ? AND pl.closed_notified = 0 AND p.status = 'published' AND p.deletion_date IS NULL`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var polls []models.Poll
+	for rows.Next() {
+		var poll models.Poll
+		err = rows.Scan(&poll.PollId, &poll.PostId, &poll.Question, &poll.Multiple, &poll.CloseDate, &poll.ClosedNotified, &poll.CreationDate, &poll.PostTitle, &poll.PostUserID)
+		if err != nil {
+			return nil, err
+		}
+		polls = append(polls, poll)
+	}
+	return polls, rows.Err()
+}
+
+func (s *service) MarkPollClosed(pollId string) error {
+	// Remember the author was told the poll closed
+	_, err := s.db.Exec("UPDATE Poll SET closed_notified=1 WHERE poll_id=?", pollId)
+	return err
+}
+
+func deletePolls(db execer, postId string) error {
+	// Delete the poll of a post, its ballots and options go with it
+	queries := []string{
+		"DELETE FROM Poll_Vote WHERE poll_id IN (SELECT poll_id FROM Poll WHERE post_id=?)",
+		"DELETE FROM Poll_Ballot WHERE poll_id IN (SELECT poll_id FROM Poll WHERE post_id=?)",
+		"DELETE FROM Poll_Option WHERE poll_id IN (SELECT poll_id FROM Poll WHERE post_id=?)",
+		"DELETE FROM Poll WHERE post_id=?",
+	}
+	for _, query := range queries {
+		_, err := db.Exec(query, postId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"database/sql"
 	"forum-go/internal/models"
+	"forum-go/internal/shared"
 	"strings"
 )
 
@@ -16,6 +17,13 @@ func (s *service) GetPosts() ([]models.Post, error) {
 			p.user_id, 
 			p.creation_date, 
 			p.update_date, 
+			COALESCE((SELECT a.image_url FROM Attachment a WHERE a.post_id = p.post_id ORDER BY a.position LIMIT 1), ''), 
+			(SELECT COUNT(*) FROM Attachment a WHERE a.post_id = p.post_id), 
+			(SELECT COUNT(*) FROM Bookmark b WHERE b.post_id = p.post_id AND b.comment_id = ''), 
+			p.pinned, 
+			COALESCE(p.pinned_category_id, ''), 
+			p.locked, 
+			p.archived, 
 			GROUP_CONCAT(c.category_id) AS category_ids, 
 			GROUP_CONCAT(c.name) AS category_names 
 		FROM 
@@ -24,9 +32,14 @@ func (s *service) GetPosts() ([]models.Post, error) {
 			Post_Category pc ON p.post_id = pc.post_id
 		LEFT JOIN 
 			Category c ON pc.category_id = c.category_id
+		JOIN 
+			User u ON p.user_id = u.user_id
+		WHERE 
+			p.status = 'published' AND p.deletion_date IS NULL AND u.deletion_date IS NULL
 		GROUP BY 
 			p.post_id
 		ORDER BY 
+			(p.pinned AND p.pinned_category_id IS NULL) DESC, 
 			p.creation_date DESC;`)
 	if err != nil {
 		return nil, err
@@ -46,7 +59,7 @@ func (s *service) GetPosts() ([]models.Post, error) {
 		var categoryIDs, categoryNames string
 		var categoryId sql.NullString
 		var categoryName sql.NullString
-		err := rows.Scan(&post.PostId, &post.Title, &post.Content, &post.UserID, &post.CreationDate, &post.UpdateDate, &categoryId, &categoryName)
+		err := rows.Scan(&post.PostId, &post.Title, &post.Content, &post.UserID, &post.CreationDate, &post.UpdateDate, &post.ImageURL, &post.NbOfAttachments, &post.NbOfBookmarks, &post.Pinned, &post.PinnedCategoryId, &post.Locked, &post.Archived, &categoryId, &categoryName)
 		if err != nil {
 			return nil, err
 		}
@@ -86,7 +99,11 @@ func (s *service) GetPosts() ([]models.Post, error) {
 		if err != nil {
 			return nil, err
 		}
-		post.NbOfComments = len(post.Comments)
+		for _, comment := range post.Comments {
+			if !comment.DeletionDate.Valid {
+				post.NbOfComments++
+			}
+		}
 
 		userLikes, err := s.GetPostLikes(post.PostId)
 		if err != nil {
@@ -107,14 +124,17 @@ func (s *service) GetPost(id string) (models.Post, error) {
 	imageUrl := sql.NullString{}
 	user := models.User{}
 	query := `
-		SELECT p.post_id, p.title, p.content, p.user_id, p.creation_date, p.update_date,p.image_url, 
+		SELECT p.post_id, p.title, COALESCE(p.slug, ''), p.content, p.user_id, p.creation_date, p.update_date,p.image_url, p.status, p.publish_date,
+			   p.pinned, COALESCE(p.pinned_category_id, ''), p.locked, p.archived,
+			   (SELECT COUNT(*) FROM Bookmark b WHERE b.post_id = p.post_id AND b.comment_id = ''),
 			   u.user_id, u.username, u.email,
+			   COALESCE((SELECT k.post_karma + k.comment_karma FROM User_Karma k WHERE k.user_id = u.user_id), 0),
 			   c.category_id, c.name
 		FROM Post p 
 		JOIN User u ON p.user_id = u.user_id 
 		LEFT JOIN Post_Category pc ON p.post_id = pc.post_id
 		LEFT JOIN Category c ON pc.category_id = c.category_id
-		WHERE p.post_id = ?`
+		WHERE p.post_id = ? AND p.deletion_date IS NULL AND u.deletion_date IS NULL`
 	rows, err := s.db.Query(query, id)
 	if err != nil {
 		return post, err
@@ -127,8 +147,10 @@ func (s *service) GetPost(id string) (models.Post, error) {
 		var categoryID sql.NullString
 		var categoryName sql.NullString
 		err := rows.Scan(
-			&post.PostId, &post.Title, &post.Content, &post.UserID, &post.CreationDate, &post.UpdateDate, &imageUrl,
-			&user.UserId, &user.Username, &user.Email,
+			&post.PostId, &post.Title, &post.Slug, &post.Content, &post.UserID, &post.CreationDate, &post.UpdateDate, &imageUrl, &post.Status, &post.PublishDate,
+			&post.Pinned, &post.PinnedCategoryId, &post.Locked, &post.Archived,
+			&post.NbOfBookmarks,
+			&user.UserId, &user.Username, &user.Email, &user.Karma,
 			&categoryID, &categoryName,
 		)
 		if err != nil {
@@ -149,6 +171,14 @@ func (s *service) GetPost(id string) (models.Post, error) {
 	if err != nil {
 		return post, err
 	}
+	post.Attachments, err = s.GetAttachments(post.PostId)
+	if err != nil {
+		return post, err
+	}
+	post.NbOfAttachments = len(post.Attachments)
+	if len(post.Attachments) > 0 {
+		post.ImageURL = post.Attachments[0].ImageURL
+	}
 	userlikes, err := s.GetPostLikes(post.PostId)
 	if err != nil {
 		return post, err
@@ -167,8 +197,15 @@ func (s *service) GetPost(id string) (models.Post, error) {
 
 func (s *service) AddPost(post models.Post, categories []models.Category) error {
 	// Insert a new post
-	query := "INSERT INTO Post (post_id,title,content,user_id,creation_date,image_url) VALUES (?,?,?,?,?,?)"
-	_, err := s.db.Exec(query, post.PostId, post.Title, post.Content, post.UserID, post.CreationDate, post.ImageURL)
+	slug, err := uniqueSlug(s.db, post.Title, post.PostId)
+	if err != nil {
+		return err
+	}
+	if post.Status == "" {
+		post.Status = models.POST_PUBLISHED
+	}
+	query := "INSERT INTO Post (post_id,title,slug,content,user_id,creation_date,image_url,status,publish_date) VALUES (?,?,?,?,?,?,?,?,?)"
+	_, err = s.db.Exec(query, post.PostId, post.Title, slug, post.Content, post.UserID, post.CreationDate, post.ImageURL, post.Status, post.PublishDate)
 	if err != nil {
 		return err
 	}
@@ -180,19 +217,115 @@ func (s *service) AddPost(post models.Post, categories []models.Category) error
 			return err
 		}
 	}
+	for _, attachment := range post.Attachments {
+		// Insert post images
+		err = s.AddAttachment(attachment)
+		if err != nil {
+			return err
+		}
+	}
+	if post.Poll != nil {
+		err = s.AddPoll(*post.Poll)
+		if err != nil {
+			return err
+		}
+	}
 
 	return err
 }
 
+func (s *service) FindPostByRef(ref string) (models.Post, error) {
+	// Get a post by its id or its slug, with its author and number of comments
+	query := `
+		SELECT p.post_id, p.title, COALESCE(p.slug, ''), u.username,
+			(SELECT COUNT(*) FROM Comment c WHERE c.post_id = p.post_id AND c.deletion_date IS NULL)
+		FROM Post p
+		JOIN User u ON p.user_id = u.user_id
+		WHERE (p.post_id = ? OR p.slug = ?) AND p.status = 'published' AND p.deletion_date IS NULL AND u.deletion_date IS NULL
+		LIMIT 1`
+	var post models.Post
+	err := s.db.QueryRow(query, ref, ref).Scan(&post.PostId, &post.Title, &post.Slug, &post.User.Username, &post.NbOfComments)
+	return post, err
+}
+
+func uniqueSlug(db *sql.DB, title, postId string) (string, error) {
+	// Posts sharing a title are told apart by the start of their id
+	slug := shared.Slugify(title)
+	if slug == "" {
+		return postId, nil
+	}
+	var taken int
+	err := db.QueryRow("SELECT COUNT(*) FROM Post WHERE slug = ? AND post_id != ?", slug, postId).Scan(&taken)
+	if err != nil {
+		return "", err
+	}
+	if taken > 0 {
+		suffix := strings.ReplaceAll(postId, "-", "")
+		slug += "-" + suffix[:min(8, len(suffix))]
+	}
+	return slug, nil
+}
+
 func (s *service) DeletePost(id string) error {
-	// Start a transaction
+	// Delete a post for good with everything attached to it, in a single transaction
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = deletePost(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func deletePost(db execer, id string) error {
+	// Delete a post and the rows pointing to it, the votes take their karma back with them
+	_, err := db.Exec("DELETE FROM Attachment WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	err = deletePolls(db, id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Post_State_Change WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	err = deleteVotes(db, "l.post_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Comment WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Post_Category WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Bookmark WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Subscription WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM Reaction WHERE post_id=?", id)
+	if err != nil {
+		return err
+	}
 	query := "DELETE FROM Post WHERE post_id=?"
-	_, err := s.db.Exec(query, id)
+	_, err = db.Exec(query, id)
 	return err
 }
-func (s *service) DeletePostsFromUser(userID string) error {
-	// Retrieve all post IDs for the user
-	rows, err := s.db.Query("SELECT post_id FROM Post WHERE user_id=?", userID)
+
+func deletePostsFromUser(tx *sql.Tx, userID string) error {
+	// Delete all the posts of a user within the transaction deleting the user
+	rows, err := tx.Query("SELECT post_id FROM Post WHERE user_id=?", userID)
 	if err != nil {
 		return err
 	}
@@ -206,40 +339,17 @@ func (s *service) DeletePostsFromUser(userID string) error {
 		}
 		postIDs = append(postIDs, postID)
 	}
-
-	// Start a transaction
-	tx, err := s.db.Begin()
-	if err != nil {
+	if err := rows.Err(); err != nil {
 		return err
 	}
+	rows.Close()
 
-	// Delete comments and post categories for each post
 	for _, postID := range postIDs {
-		_, err := tx.Exec("DELETE FROM Comment WHERE post_id=?", postID)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-		_, err = tx.Exec("DELETE FROM Post_Category WHERE post_id=?", postID)
+		err = deletePost(tx, postID)
 		if err != nil {
-			tx.Rollback()
 			return err
 		}
 	}
-
-	// Delete posts
-	_, err = tx.Exec("DELETE FROM Post WHERE user_id=?", userID)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	// Commit transaction
-	err = tx.Commit()
-	if err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"strings"
+)
+
+func (s *service) FindUserByUsername(username string) (models.User, error) {
+	// Get a user by his username
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE username=? AND deletion_date IS NULL ORDER BY creation_date LIMIT 1"
+	row := s.db.QueryRow(query, username)
+	var user models.User
+	err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider)
+	return user, err
+}
+
+func (s *service) GetProfile(userId string) (models.Profile, error) {
+	// Get the public profile of a user, an empty Profile is returned if he never filled it
+	row := s.db.QueryRow("SELECT user_id, bio, location, links, update_date FROM User_Profile WHERE user_id=?", userId)
+	var profile models.Profile
+	var links string
+	err := row.Scan(&profile.UserId, &profile.Bio, &profile.Location, &links, &profile.UpdateDate)
+	if err == sql.ErrNoRows {
+		return models.Profile{UserId: userId}, nil
+	}
+	if links != "" {
+		profile.Links = strings.Split(links, "\n")
+	}
+	return profile, err
+}
+
+func (s *service) SaveProfile(profile models.Profile) error {
+	// Create or update the public profile of a user
+	query := "INSERT OR REPLACE INTO User_Profile (user_id, bio, location, links, update_date) VALUES (?, ?, ?, ?, ?)"
+	_, err := s.db.Exec(query, profile.UserId, profile.Bio, profile.Location, strings.Join(profile.Links, "\n"), profile.UpdateDate)
+	return err
+}
+
+func (s *service) GetUserPosts(userId string, limit, offset int) ([]models.Post, error) {
+	// Get a page of the posts of a user with their counts, newest first
+	query := `
+		SELECT p.post_id, p.title, p.creation_date,
+			(SELECT COUNT(*) FROM Comment c WHERE c.post_id = p.post_id AND c.deletion_date IS NULL),
+			(SELECT COUNT(*) FROM User_Like l WHERE l.post_id = p.post_id AND l.comment_id = '' AND l.isLiked),
+			(SELECT COUNT(*) FROM User_Like l WHERE l.post_id = p.post_id AND l.comment_id = '' AND NOT l.isLiked)
+		FROM Post p
+		WHERE p.user_id = ? AND p.status = 'published' AND p.deletion_date IS NULL
+		ORDER BY p.creation_date DESC
+		LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, userId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var posts []models.Post
+	for rows.Next() {
+		post := models.Post{UserID: userId}
+		err := rows.Scan(&post.PostId, &post.Title, &post.CreationDate, &post.NbOfComments, &post.Likes, &post.Dislikes)
+		if err != nil {
+			return nil, err
+		}
+		post.FormattedCreationDate = post.CreationDate.Format("Jan 02, 2006 - 15:04:05")
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+func (s *service) CountUserPosts(userId string) (int, error) {
+	// Count the posts of a user
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Post WHERE user_id=? AND status='published' AND deletion_date IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+func (s *service) GetUserComments(userId string, limit, offset int) ([]models.Comment, error) {
+	// Get a page of the comments of a user with the title of their post, newest first
+	query := `
+		SELECT c.comment_id, c.content, c.creation_date, c.post_id, p.title,
+			(SELECT COUNT(*) FROM User_Like l WHERE l.comment_id = c.comment_id AND l.isLiked),
+			(SELECT COUNT(*) FROM User_Like l WHERE l.comment_id = c.comment_id AND NOT l.isLiked)
+		FROM Comment c
+		JOIN Post p ON c.post_id = p.post_id
+		WHERE c.user_id = ? AND c.deletion_date IS NULL AND p.deletion_date IS NULL
+		ORDER BY c.creation_date DESC
+		LIMIT ? OFFSET ?`
+	rows, err := s.db.Query(query, userId, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comments []models.Comment
+	for rows.Next() {
+		comment := models.Comment{UserID: userId}
+		err := rows.Scan(&comment.CommentId, &comment.Content, &comment.CreationDate, &comment.PostID, &comment.PostTitle, &comment.Likes, &comment.Dislikes)
+		if err != nil {
+			return nil, err
+		}
+		comment.FormattedCreationDate = comment.CreationDate.Format("02/01/06 - 15:04")
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+func (s *service) CountUserComments(userId string) (int, error) {
+	// Count the comments of a user
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Comment c JOIN Post p ON c.post_id = p.post_id WHERE c.user_id=? AND c.deletion_date IS NULL AND p.deletion_date IS NULL", userId).Scan(&count)
+	return count, err
+}
+
+func (s *service) GetPublicActivities(userId string, actionTypes []string, limit int) ([]models.Activity, error) {
+	// Get the latest actions of a user among the given types
+	if len(actionTypes) == 0 {
+		return nil, nil
+	}
+	args := []interface{}{userId}
+	for _, actionType := range actionTypes {
+		args = append(args, actionType)
+	}
+	args = append(args, limit)
+	query := `
+		SELECT activity_id, user_id, action_user_id, action_type, post_id, IFNULL(comment_id, ''), creation_date, IFNULL(details, '')
+		FROM Activity a
+		WHERE user_id = action_user_id AND user_id = ? AND action_type IN (?` + strings.Repeat(", ?", len(actionTypes)-1) + `)
+			AND NOT EXISTS (SELECT 1 FROM Post p WHERE p.post_id = a.post_id AND p.deletion_date IS NOT NULL)
+			AND NOT EXISTS (SELECT 1 FROM Comment c WHERE c.comment_id = a.comment_id AND c.deletion_date IS NOT NULL)
+		ORDER BY creation_date DESC
+		LIMIT ?`
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var activities []models.Activity
+	for rows.Next() {
+		var activity models.Activity
+		err := rows.Scan(&activity.ActivityId, &activity.UserId, &activity.ActionUserId, &activity.ActionType, &activity.PostId, &activity.CommentId, &activity.CreationDate, &activity.Details)
+		if err != nil {
+			return nil, err
+		}
+		activity.FormattedCreationDate = activity.CreationDate.Format("Jan 02, 2006 - 15:04:05")
+		activities = append(activities, activity)
+	}
+	return activities, rows.Err()
+}
+
+func (s *service) GetAvatar(userId string) (models.Avatar, error) {
+	// Get the uploaded avatar of a user, an empty Avatar is returned if there is none
+	row := s.db.QueryRow("SELECT user_id, version, update_date FROM User_Avatar WHERE user_id=?", userId)
+	var avatar models.Avatar
+	err := row.Scan(&avatar.UserId, &avatar.Version, &avatar.UpdateDate)
+	if err == sql.ErrNoRows {
+		return models.Avatar{}, nil
+	}
+	return avatar, err
+}
+
+func (s *service) GetAvatars() ([]models.Avatar, error) {
+	// Get the uploaded avatar of every user
+	rows, err := s.db.Query("SELECT user_id, version, update_date FROM User_Avatar")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var avatars []models.Avatar
+	for rows.Next() {
+		var avatar models.Avatar
+		err = rows.Scan(&avatar.UserId, &avatar.Version, &avatar.UpdateDate)
+		if err != nil {
+			return nil, err
+		}
+		avatars = append(avatars, avatar)
+	}
+	return avatars, rows.Err()
+}
+
+func (s *service) SaveAvatar(avatar models.Avatar) error {
+	// Create or replace the avatar of a user
+	query := "INSERT OR REPLACE INTO User_Avatar (user_id, version, update_date) VALUES (?, ?, ?)"
+	_, err := s.db.Exec(query, avatar.UserId, avatar.Version, avatar.UpdateDate)
+	return err
+}
+
+func (s *service) DeleteAvatar(userId string) error {
+	// Remove the avatar of a user, he gets his identicon back
+	_, err := s.db.Exec("DELETE FROM User_Avatar WHERE user_id=?", userId)
+	return err
+}
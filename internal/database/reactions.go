@@ -0,0 +1,44 @@
+package database
+
+import (
+	"forum-go/internal/models"
+)
+
+func (s *service) React(reaction models.Reaction) (bool, error) {
+	// Add a reaction to a post or a comment, reacting the same twice takes it back; true when it was added
+	result, err := s.db.Exec("DELETE FROM Reaction WHERE user_id=? AND post_id=? AND comment_id=? AND emoji=?",
+		reaction.UserId, reaction.PostId, reaction.CommentId, reaction.Emoji)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n > 0 {
+		return false, err
+	}
+	_, err = s.db.Exec("INSERT INTO Reaction (reaction_id, user_id, post_id, comment_id, emoji, creation_date) VALUES (?, ?, ?, ?, ?, ?)",
+		reaction.ReactionId, reaction.UserId, reaction.PostId, reaction.CommentId, reaction.Emoji, reaction.CreationDate)
+	return err == nil, err
+}
+
+func (s *service) GetReactions(postId, userId string) ([]models.ReactionCount, error) {
+	// Count the reactions to a post and to its comments by emoji, with the ones of a user marked
+	rows, err := s.db.Query(`
+		SELECT comment_id, emoji, COUNT(*), MAX(user_id = ?)
+		FROM Reaction
+		WHERE post_id = ?
+		GROUP BY comment_id, emoji`, userId, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var counts []models.ReactionCount
+	for rows.Next() {
+		var count models.ReactionCount
+		err = rows.Scan(&count.CommentId, &count.Emoji, &count.Count, &count.Reacted)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"testing"
+)
+
+func TestHasReactionActivity(t *testing.T) {
+	s := newTestService(t)
+	alice := addTestUser(t, s, "alice")
+	bob := addTestUser(t, s, "bob")
+	postId := addTestPost(t, s, alice, "hello")
+	err := s.CreateActivity(models.NewActivity(alice, bob, string(models.GET_REACTION), postId, "", "❤️ hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		userId    string
+		commentId string
+		emoji     string
+		want      bool
+	}{
+		{"same reaction", bob, "", "❤️", true},
+		{"other emoji", bob, "", "🔥", false},
+		{"other user", alice, "", "❤️", false},
+		{"on a comment", bob, "comment-id", "❤️", false},
+	}
+	for _, tt := range tests {
+		notified, err := s.HasReactionActivity(tt.userId, postId, tt.commentId, tt.emoji)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notified != tt.want {
+			t.Errorf("%s: notified = %v, want %v", tt.name, notified, tt.want)
+		}
+	}
+}
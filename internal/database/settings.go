@@ -0,0 +1,19 @@
+package database
+
+import "database/sql"
+
+func (s *service) GetSetting(key string) (string, error) {
+	// Get a forum setting, an empty string is returned if it has never been set
+	var value string
+	err := s.db.QueryRow("SELECT value FROM Setting WHERE setting_key=?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *service) SetSetting(key, value string) error {
+	// Insert or update a forum setting
+	_, err := s.db.Exec("INSERT OR REPLACE INTO Setting (setting_key, value) VALUES (?,?)", key, value)
+	return err
+}
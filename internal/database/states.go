@@ -0,0 +1,81 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"forum-go/internal/models"
+)
+
+// Column and value each state change sets
+var postStateColumns = map[string]struct {
+	column string
+	value  bool
+}{
+	models.POST_PINNED:     {"pinned", true},
+	models.POST_UNPINNED:   {"pinned", false},
+	models.POST_LOCKED:     {"locked", true},
+	models.POST_UNLOCKED:   {"locked", false},
+	models.POST_ARCHIVED:   {"archived", true},
+	models.POST_UNARCHIVED: {"archived", false},
+}
+
+func (s *service) ChangePostState(change models.PostStateChange) error {
+	// Change the state of a post and record who did it
+	state, ok := postStateColumns[change.State]
+	if !ok {
+		return fmt.Errorf("unknown post state %q", change.State)
+	}
+	categoryId := sql.NullString{String: change.CategoryId, Valid: change.CategoryId != ""}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("UPDATE Post SET %s=? WHERE post_id=?", state.column), state.value, change.PostId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if state.column == "pinned" {
+		// Unpinning forgets the category too
+		_, err = tx.Exec("UPDATE Post SET pinned_category_id=? WHERE post_id=?", categoryId, change.PostId)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = tx.Exec("INSERT INTO Post_State_Change (change_id, post_id, user_id, state, category_id, reason, creation_date) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		change.ChangeId, change.PostId, change.UserId, change.State, categoryId, change.Reason, change.CreationDate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *service) GetPostStateChanges(postId string) ([]models.PostStateChange, error) {
+	// Get the state changes of a post with the moderators who made them, newest first
+	rows, err := s.db.Query(`
+		SELECT sc.change_id, sc.post_id, sc.user_id, COALESCE(u.username, ''), sc.state,
+			COALESCE(sc.category_id, ''), COALESCE(c.name, ''), sc.reason, sc.creation_date
+		FROM Post_State_Change sc
+		LEFT JOIN User u ON sc.user_id = u.user_id
+		LEFT JOIN Category c ON sc.category_id = c.category_id
+		WHERE sc.post_id = ?
+		ORDER BY sc.creation_date DESC`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var changes []models.PostStateChange
+	for rows.Next() {
+		var change models.PostStateChange
+		err = rows.Scan(&change.ChangeId, &change.PostId, &change.UserId, &change.Username, &change.State,
+			&change.CategoryId, &change.CategoryName, &change.Reason, &change.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		change.FormattedCreationDate = change.CreationDate.Format("Jan 02, 2006 - 15:04")
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
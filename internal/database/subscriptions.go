@@ -0,0 +1,75 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"strings"
+)
+
+func (s *service) Subscribe(subscription models.Subscription) error {
+	// Follow a thread or a category, following it twice changes nothing
+	_, err := s.db.Exec("INSERT OR IGNORE INTO Subscription (subscription_id, user_id, post_id, category_id, creation_date) VALUES (?, ?, ?, ?, ?)",
+		subscription.SubscriptionId, subscription.UserId, subscription.PostId, subscription.CategoryId, subscription.CreationDate)
+	return err
+}
+
+func (s *service) Unsubscribe(userId, postId, categoryId string) (bool, error) {
+	// Stop following a thread or a category, false when it was not followed
+	result, err := s.db.Exec("DELETE FROM Subscription WHERE user_id=? AND post_id=? AND category_id=?", userId, postId, categoryId)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) GetSubscriptions(userId string) ([]models.Subscription, error) {
+	// Get the threads and categories a user follows, with their title or name
+	rows, err := s.db.Query(`
+		SELECT sb.subscription_id, sb.post_id, COALESCE(p.title, ''), sb.category_id, COALESCE(c.name, ''), sb.creation_date
+		FROM Subscription sb
+		LEFT JOIN Post p ON sb.post_id = p.post_id
+		LEFT JOIN Category c ON sb.category_id = c.category_id
+		WHERE sb.user_id = ? AND (sb.post_id = '' OR (p.status = 'published' AND p.deletion_date IS NULL))
+		ORDER BY sb.creation_date DESC`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var subscriptions []models.Subscription
+	for rows.Next() {
+		subscription := models.Subscription{UserId: userId}
+		err = rows.Scan(&subscription.SubscriptionId, &subscription.PostId, &subscription.PostTitle, &subscription.CategoryId, &subscription.CategoryName, &subscription.CreationDate)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+func (s *service) GetSubscribers(postId string, categoryIds []string) ([]string, error) {
+	// Get the users following a thread or any of the given categories, each one once
+	args := []interface{}{postId}
+	query := "SELECT DISTINCT sb.user_id FROM Subscription sb JOIN User u ON sb.user_id = u.user_id WHERE u.deletion_date IS NULL AND ((sb.post_id != '' AND sb.post_id = ?)"
+	if len(categoryIds) > 0 {
+		query += " OR (sb.post_id = '' AND sb.category_id IN (?" + strings.Repeat(", ?", len(categoryIds)-1) + "))"
+		for _, categoryId := range categoryIds {
+			args = append(args, categoryId)
+		}
+	}
+	query += ")"
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var userIds []string
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, rows.Err()
+}
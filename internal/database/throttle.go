@@ -0,0 +1,71 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"time"
+)
+
+func (s *service) GetLoginThrottle(key string) (models.LoginThrottle, error) {
+	// Get the failed logins of an account or an IP, an empty LoginThrottle is returned if there is none
+	query := "SELECT throttle_key, failures, last_failure, locked_until FROM Login_Throttle WHERE throttle_key=?"
+	row := s.db.QueryRow(query, key)
+	var throttle models.LoginThrottle
+	err := row.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailure, &throttle.LockedUntil)
+	if err == sql.ErrNoRows {
+		return models.LoginThrottle{Key: key}, nil
+	}
+	return throttle, err
+}
+
+func (s *service) RecordLoginFailure(key string, since time.Time) (models.LoginThrottle, error) {
+	// Count a failed login, failures older than since are forgotten
+	query := `
+		INSERT INTO Login_Throttle (throttle_key, failures, last_failure) VALUES (?, 1, ?)
+		ON CONFLICT(throttle_key) DO UPDATE SET
+			failures = CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END,
+			last_failure = excluded.last_failure`
+	_, err := s.db.Exec(query, key, time.Now(), since)
+	if err != nil {
+		return models.LoginThrottle{}, err
+	}
+	return s.GetLoginThrottle(key)
+}
+
+func (s *service) LockLoginThrottle(key string, until time.Time) error {
+	// Lock an account or an IP until the given date
+	_, err := s.db.Exec("UPDATE Login_Throttle SET locked_until=? WHERE throttle_key=?", until, key)
+	return err
+}
+
+func (s *service) ResetLoginThrottle(key string) error {
+	// Forget the failed logins of an account or an IP
+	_, err := s.db.Exec("DELETE FROM Login_Throttle WHERE throttle_key=?", key)
+	return err
+}
+
+func (s *service) GetLockedAccounts() ([]models.LoginThrottle, error) {
+	// Get the accounts currently locked after too many failed logins
+	rows, err := s.db.Query(`
+		SELECT t.throttle_key, t.failures, t.last_failure, t.locked_until, u.user_id, u.username, u.email
+		FROM Login_Throttle t
+		JOIN User u ON t.throttle_key = 'user:' || u.user_id
+		WHERE t.locked_until > ?
+		ORDER BY t.locked_until DESC`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	throttles := make([]models.LoginThrottle, 0)
+	for rows.Next() {
+		var throttle models.LoginThrottle
+		err := rows.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailure, &throttle.LockedUntil, &throttle.User.UserId, &throttle.User.Username, &throttle.User.Email)
+		if err != nil {
+			return nil, err
+		}
+		throttle.FormattedLockedUntil = throttle.LockedUntil.Time.Format("2006-01-02 15:04:05")
+		throttles = append(throttles, throttle)
+	}
+	return throttles, nil
+}
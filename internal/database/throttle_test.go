@@ -0,0 +1,55 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginFailuresLockEveryThreshold(t *testing.T) {
+	s := newTestService(t)
+	const threshold = 10
+	since := time.Now().Add(-24 * time.Hour)
+	for i := 1; i <= 25; i++ {
+		throttle, err := s.RecordLoginFailure("user:alice", since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != i {
+			t.Fatalf("failure %d: Failures = %d", i, throttle.Failures)
+		}
+		want := i == 10 || i == 20
+		if got := throttle.LockDue(threshold); got != want {
+			t.Errorf("failure %d: LockDue = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestLoginFailuresWindow(t *testing.T) {
+	s := newTestService(t)
+	tests := []struct {
+		name  string
+		since time.Time
+		want  int
+	}{
+		{"first failure", time.Now().Add(-time.Hour), 1},
+		{"inside the window", time.Now().Add(-time.Hour), 2},
+		{"older failures forgotten", time.Now().Add(time.Second), 1},
+	}
+	for _, tt := range tests {
+		throttle, err := s.RecordLoginFailure("ip:127.0.0.1", tt.since)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if throttle.Failures != tt.want {
+			t.Errorf("%s: Failures = %d, want %d", tt.name, throttle.Failures, tt.want)
+		}
+	}
+	err := s.ResetLoginThrottle("ip:127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle, err := s.GetLoginThrottle("ip:127.0.0.1")
+	if err != nil || throttle.Failures != 0 {
+		t.Errorf("after reset: Failures = %d, err = %v", throttle.Failures, err)
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"forum-go/internal/models"
+	"forum-go/internal/shared"
+)
+
+func (s *service) GetUserById(id string) (models.User, error) {
+	// Find user by id
+	query := "SELECT user_id, email, username, password, role, creation_date, session_id, session_expire, provider FROM User WHERE user_id=? AND deletion_date IS NULL"
+	row := s.db.QueryRow(query, id)
+	var user models.User
+	if err := row.Scan(&user.UserId, &user.Email, &user.Username, &user.Password, &user.Role, &user.CreationDate, &user.SessionId, &user.SessionExpire, &user.Provider); err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (s *service) GetTotp(userId string) (models.UserTotp, error) {
+	// Get the TOTP secret of a user, an empty UserTotp is returned if there is none
+	query := "SELECT user_id, secret, enabled, last_step, creation_date FROM User_Totp WHERE user_id=?"
+	row := s.db.QueryRow(query, userId)
+	var totp models.UserTotp
+	err := row.Scan(&totp.UserId, &totp.Secret, &totp.Enabled, &totp.LastStep, &totp.CreationDate)
+	if err == sql.ErrNoRows {
+		return models.UserTotp{}, nil
+	}
+	return totp, err
+}
+
+func (s *service) SaveTotp(totp models.UserTotp) error {
+	// Insert or replace the TOTP secret of a user
+	query := "INSERT OR REPLACE INTO User_Totp (user_id, secret, enabled, last_step, creation_date) VALUES (?,?,?,?,?)"
+	_, err := s.db.Exec(query, totp.UserId, totp.Secret, totp.Enabled, totp.LastStep, totp.CreationDate)
+	return err
+}
+
+func (s *service) UpdateTotpStep(userId string, step int64) error {
+	// Remember the last accepted TOTP period
+	_, err := s.db.Exec("UPDATE User_Totp SET last_step=? WHERE user_id=?", step, userId)
+	return err
+}
+
+func (s *service) DeleteTotp(userId string) error {
+	// Disable two factor authentication and drop the recovery codes
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM User_Totp WHERE user_id=?", userId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Recovery_Code WHERE user_id=?", userId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *service) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	// Replace all recovery codes of a user
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM Recovery_Code WHERE user_id=?", userId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, codeHash := range codeHashes {
+		_, err = tx.Exec("INSERT INTO Recovery_Code (code_id, user_id, code_hash, used) VALUES (?,?,?,0)", shared.ParseUUID(shared.GenerateUUID()), userId, codeHash)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *service) UseRecoveryCode(userId, codeHash string) (bool, error) {
+	// Consume an unused recovery code, returns false if it doesn't match
+	result, err := s.db.Exec("UPDATE Recovery_Code SET used=1 WHERE user_id=? AND code_hash=? AND used=0", userId, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *service) CountRecoveryCodes(userId string) (int, error) {
+	// Count the unused recovery codes of a user
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM Recovery_Code WHERE user_id=? AND used=0", userId).Scan(&count)
+	return count, err
+}
+
+func (s *service) CreateLoginChallenge(challenge models.LoginChallenge) error {
+	// Insert a pending login
+	query := "INSERT INTO Login_Challenge (challenge_id, user_id, attempts, expire_date) VALUES (?,?,?,?)"
+	_, err := s.db.Exec(query, challenge.ChallengeId, challenge.UserId, challenge.Attempts, challenge.ExpireDate)
+	return err
+}
+
+func (s *service) GetLoginChallenge(challengeId string) (models.LoginChallenge, error) {
+	// Get a pending login by id
+	query := "SELECT challenge_id, user_id, attempts, expire_date FROM Login_Challenge WHERE challenge_id=?"
+	row := s.db.QueryRow(query, challengeId)
+	var challenge models.LoginChallenge
+	if err := row.Scan(&challenge.ChallengeId, &challenge.UserId, &challenge.Attempts, &challenge.ExpireDate); err != nil {
+		return models.LoginChallenge{}, err
+	}
+	return challenge, nil
+}
+
+func (s *service) IncrementChallengeAttempts(challengeId string) error {
+	// Count a wrong code on a pending login
+	_, err := s.db.Exec("UPDATE Login_Challenge SET attempts=attempts+1 WHERE challenge_id=?", challengeId)
+	return err
+}
+
+func (s *service) DeleteLoginChallenge(challengeId string) error {
+	// Delete a pending login
+	_, err := s.db.Exec("DELETE FROM Login_Challenge WHERE challenge_id=?", challengeId)
+	return err
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"fmt"
+	"forum-go/internal/models"
+	"time"
+)
+
+// Table and key of each kind of row the trash holds
+var trashTables = map[string]struct {
+	table, key string
+}{
+	models.TRASH_POST:    {"Post", "post_id"},
+	models.TRASH_COMMENT: {"Comment", "comment_id"},
+	models.TRASH_USER:    {"User", "user_id"},
+}
+
+func (s *service) Trash(kind, id, deletedBy string) (bool, error) {
+	// Move a post, a comment or a user to the trash, false when it was already there
+	t, ok := trashTables[kind]
+	if !ok {
+		return false, fmt.Errorf("unknown trash kind %q", kind)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	// The karma of the votes is taken back while the content still counts
+	if condition, ok := karmaConditions[kind]; ok {
+		err = shiftKarma(tx, -1, condition, id)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	result, err := tx.Exec(fmt.Sprintf("UPDATE %s SET deletion_date=?, deleted_by=? WHERE %s=? AND deletion_date IS NULL", t.table, t.key), time.Now(), deletedBy, id)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return n == 1, tx.Commit()
+}
+
+func (s *service) Restore(kind, id string) (bool, error) {
+	// Take a post, a comment or a user out of the trash, false when it was not there
+	t, ok := trashTables[kind]
+	if !ok {
+		return false, fmt.Errorf("unknown trash kind %q", kind)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(fmt.Sprintf("UPDATE %s SET deletion_date=NULL, deleted_by=NULL WHERE %s=? AND deletion_date IS NOT NULL", t.table, t.key), id)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	// The votes count again once the content is back
+	if condition, ok := karmaConditions[kind]; ok && n == 1 {
+		err = shiftKarma(tx, 1, condition, id)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+	return n == 1, tx.Commit()
+}
+
+func (s *service) GetTrash() ([]models.TrashItem, error) {
+	// Get everything in the trash with who deleted it, last deleted first
+	rows, err := s.db.Query(`
+		SELECT 'post', p.post_id, p.title, u.username, p.post_id, p.deletion_date, COALESCE(d.username, '')
+		FROM Post p
+		JOIN User u ON p.user_id = u.user_id
+		LEFT JOIN User d ON p.deleted_by = d.user_id
+		WHERE p.deletion_date IS NOT NULL
+		UNION ALL
+		SELECT 'comment', c.comment_id, c.content, u.username, c.post_id, c.deletion_date, COALESCE(d.username, '')
+		FROM Comment c
+		JOIN User u ON c.user_id = u.user_id
+		LEFT JOIN User d ON c.deleted_by = d.user_id
+		WHERE c.deletion_date IS NOT NULL
+		UNION ALL
+		SELECT 'user', u.user_id, u.username, u.email, '', u.deletion_date, COALESCE(d.username, '')
+		FROM User u
+		LEFT JOIN User d ON u.deleted_by = d.user_id
+		WHERE u.deletion_date IS NOT NULL
+		ORDER BY 6 DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []models.TrashItem
+	for rows.Next() {
+		var item models.TrashItem
+		err = rows.Scan(&item.Kind, &item.Id, &item.Label, &item.Author, &item.PostId, &item.DeletionDate, &item.DeletedBy)
+		if err != nil {
+			return nil, err
+		}
+		item.FormattedDeletionDate = item.DeletionDate.Format("Jan 02, 2006 - 15:04")
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *service) PurgeTrash(before time.Time) (int, error) {
+	// Delete for good what was put in the trash before a date
+	purge := []struct {
+		kind   string
+		delete func(id string) error
+	}{
+		{models.TRASH_COMMENT, s.deleteComment},
+		{models.TRASH_POST, s.DeletePost},
+		{models.TRASH_USER, s.deleteUser},
+	}
+	purged := 0
+	for _, p := range purge {
+		t := trashTables[p.kind]
+		ids, err := s.trashedBefore(t.table, t.key, before)
+		if err != nil {
+			return purged, err
+		}
+		for _, id := range ids {
+			err = p.delete(id)
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (s *service) trashedBefore(table, key string, before time.Time) ([]string, error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE deletion_date <= ?", key, table), before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
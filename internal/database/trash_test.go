@@ -0,0 +1,101 @@
+package database
+
+import (
+	"forum-go/internal/models"
+	"testing"
+	"time"
+)
+
+func TestTrashRestoreKarma(t *testing.T) {
+	s := newTestService(t)
+	alice := addTestUser(t, s, "alice")
+	bob := addTestUser(t, s, "bob")
+	postId := addTestPost(t, s, alice, "hello")
+	commentId := addTestComment(t, s, alice, postId, "first")
+	for _, vote := range []struct {
+		commentId string
+		karma     int
+	}{{"", 2}, {commentId, 1}} {
+		err := s.Vote(postId, vote.commentId, bob, true, vote.karma)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantKarma(t, s, alice, "voted", 2, 1)
+	steps := []struct {
+		name     string
+		trash    bool
+		kind, id string
+		changed  bool
+		posts    int
+		comments int
+	}{
+		{"trash post", true, models.TRASH_POST, postId, true, 0, 1},
+		{"trash post again", true, models.TRASH_POST, postId, false, 0, 1},
+		{"trash comment", true, models.TRASH_COMMENT, commentId, true, 0, 0},
+		{"restore post", false, models.TRASH_POST, postId, true, 2, 0},
+		{"restore post again", false, models.TRASH_POST, postId, false, 2, 0},
+		{"restore comment", false, models.TRASH_COMMENT, commentId, true, 2, 1},
+	}
+	for _, step := range steps {
+		var changed bool
+		var err error
+		if step.trash {
+			changed, err = s.Trash(step.kind, step.id, bob)
+		} else {
+			changed, err = s.Restore(step.kind, step.id)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != step.changed {
+			t.Errorf("%s: changed = %v, want %v", step.name, changed, step.changed)
+		}
+		wantKarma(t, s, alice, step.name, step.posts, step.comments)
+	}
+}
+
+func TestPurgeKarma(t *testing.T) {
+	s := newTestService(t)
+	alice := addTestUser(t, s, "alice")
+	bob := addTestUser(t, s, "bob")
+	kept := addTestPost(t, s, alice, "kept")
+	trashed := addTestPost(t, s, alice, "trashed")
+	deleted := addTestPost(t, s, alice, "deleted")
+	commentId := addTestComment(t, s, alice, kept, "first")
+	for _, postId := range []string{kept, trashed, deleted} {
+		err := s.Vote(postId, "", bob, true, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := s.Vote(kept, commentId, bob, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKarma(t, s, alice, "voted", 6, 1)
+
+	// Deleting a post for good takes its votes back
+	err = s.DeletePost(deleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKarma(t, s, alice, "delete post", 4, 1)
+
+	// Purging the trash doesn't take back again what trashing took
+	for _, item := range []struct{ kind, id string }{{models.TRASH_POST, trashed}, {models.TRASH_COMMENT, commentId}} {
+		_, err = s.Trash(item.kind, item.id, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantKarma(t, s, alice, "trash", 2, 0)
+	purged, err := s.PurgeTrash(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("purged = %d, want 2", purged)
+	}
+	wantKarma(t, s, alice, "purge", 2, 0)
+}
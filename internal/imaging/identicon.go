@@ -0,0 +1,70 @@
+package imaging
+
+import (
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// Cells of an identicon on each side, the left half is mirrored on the right
+const identiconGrid = 5
+
+// Identicon draws a symmetric pattern derived from the seed, so every user
+// gets a recognizable default avatar that never changes.
+func Identicon(seed string, size int) *image.RGBA {
+	sum := sha256.Sum256([]byte(seed))
+	background := color.RGBA{0x10, 0x09, 0x1b, 0xff}
+	foreground := hslColor(float64(uint16(sum[0])<<8|uint16(sum[1]))/65536, 0.65, 0.65)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	// Keep a margin of half a cell around the pattern
+	cell := size / (identiconGrid + 1)
+	margin := (size - cell*identiconGrid) / 2
+	bit := 16
+	for x := 0; x < (identiconGrid+1)/2; x++ {
+		for y := 0; y < identiconGrid; y++ {
+			on := sum[2+bit/8]>>(bit%8)&1 == 1
+			bit++
+			if !on {
+				continue
+			}
+			for _, cx := range []int{x, identiconGrid - 1 - x} {
+				rect := image.Rect(margin+cx*cell, margin+y*cell, margin+(cx+1)*cell, margin+(y+1)*cell)
+				draw.Draw(img, rect, image.NewUniform(foreground), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
+
+func hslColor(h, s, l float64) color.RGBA {
+	// Convert a hue, saturation and lightness between 0 and 1 to RGB
+	q := l + s - l*s
+	if l < 0.5 {
+		q = l * (1 + s)
+	}
+	p := 2*l - q
+	channel := func(t float64) uint8 {
+		if t < 0 {
+			t++
+		}
+		if t > 1 {
+			t--
+		}
+		var v float64
+		switch {
+		case t < 1.0/6:
+			v = p + (q-p)*6*t
+		case t < 0.5:
+			v = q
+		case t < 2.0/3:
+			v = p + (q-p)*(2.0/3-t)*6
+		default:
+			v = p
+		}
+		return uint8(v*255 + 0.5)
+	}
+	return color.RGBA{channel(h + 1.0/3), channel(h), channel(h - 1.0/3), 0xff}
+}
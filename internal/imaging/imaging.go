@@ -0,0 +1,166 @@
+// Package imaging decodes, crops, resizes and encodes the images uploaded to
+// the forum with the standard library, plus the WebP decoder of x/image.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Largest image accepted, in pixels, so a small file can't expand into a huge bitmap
+const MaxPixels = 40_000_000
+
+// Longest side accepted, a 1x40000000 strip is as suspicious as a huge square
+const MaxSide = 12_000
+
+// ErrTooLarge is returned when the dimensions of an image exceed MaxPixels or MaxSide.
+var ErrTooLarge = errors.New("image dimensions are too large")
+
+// ErrUnsupported is returned when the content is not a JPEG, PNG, GIF or WebP image,
+// whatever the name of the file says.
+var ErrUnsupported = errors.New("unsupported or corrupted image")
+
+// Formats accepted, by the MIME type http.DetectContentType finds in the content
+var sniffedFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// Sniff returns the format of an image from its first bytes.
+func Sniff(data []byte) (string, error) {
+	format, ok := sniffedFormats[http.DetectContentType(data)]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	return format, nil
+}
+
+func checkConfig(data []byte, format string) (image.Config, error) {
+	// Read the header of the image and refuse it before any pixel is allocated
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return config, ErrUnsupported
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxSide || config.Height > MaxSide || config.Width*config.Height > MaxPixels {
+		return config, ErrTooLarge
+	}
+	return config, nil
+}
+
+// Decode reads a JPEG, PNG, GIF or WebP image. The format is sniffed from the
+// content and its dimensions are checked before the pixels are decoded.
+// Only the first frame of an animated GIF is kept.
+func Decode(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = checkConfig(data, format)
+	if err != nil {
+		return nil, "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrUnsupported
+	}
+	return img, format, nil
+}
+
+// Fit scales the image down so its longest side is at most maxSide, keeping
+// its proportions. Smaller images are returned as they are.
+func Fit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxSide && b.Dy() <= maxSide {
+		return img
+	}
+	width, height := maxSide, max(b.Dy()*maxSide/b.Dx(), 1)
+	if b.Dy() > b.Dx() {
+		width, height = max(b.Dx()*maxSide/b.Dy(), 1), maxSide
+	}
+	return Resize(img, width, height)
+}
+
+// CenterCrop returns the largest centered square of the image.
+func CenterCrop(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+	rect := image.Rect(x, y, x+side, y+side)
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Resize scales the image to width x height. Each destination pixel is the
+// average of the source pixels it covers, which keeps downscaled photos smooth.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sb := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := sb.Min.Y + y*sb.Dy()/height
+		y1 := max(sb.Min.Y+(y+1)*sb.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := sb.Min.X + x*sb.Dx()/width
+			x1 := max(sb.Min.X+(x+1)*sb.Dx()/width, x0+1)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[i])
+					g += uint32(src.Pix[i+1])
+					b += uint32(src.Pix[i+2])
+					a += uint32(src.Pix[i+3])
+					n++
+					i += 4
+				}
+			}
+			j := dst.PixOffset(x, y)
+			dst.Pix[j], dst.Pix[j+1], dst.Pix[j+2], dst.Pix[j+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// EncodeJPEG writes the image as a JPEG, transparent areas are painted with
+// the background color. Nothing but the pixels is written, so metadata like
+// EXIF never survives a re-encoding.
+func EncodeJPEG(w io.Writer, img image.Image, background color.Color, quality int) error {
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, flat, &jpeg.Options{Quality: quality})
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	// Convert to non premultiplied access friendly RGBA, copying only when needed
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, img, b.Min, draw.Src)
+	return rgba
+}
@@ -0,0 +1,161 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Most frames accepted in an animated GIF
+const MaxFrames = 300
+
+// Encoded is an image written again from its decoded pixels.
+type Encoded struct {
+	Data []byte
+	// Extension of the file, with its dot
+	Ext string
+	// First frame, used to create thumbnails
+	Image image.Image
+}
+
+// Reencode decodes a JPEG, PNG, GIF or WebP image and writes it again, in the
+// same format or as JPEG or PNG for WebP, so metadata, comments and anything
+// appended to the file are dropped. Images wider or taller than maxSide are scaled down. Animated GIFs
+// keep their frames when they fit, otherwise only their first frame is kept
+// and stored as a PNG.
+func Reencode(data []byte, maxSide int) (Encoded, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return Encoded{}, err
+	}
+	config, err := checkConfig(data, format)
+	if err != nil {
+		return Encoded{}, err
+	}
+	if format == "gif" && config.Width <= maxSide && config.Height <= maxSide {
+		return reencodeGIF(data, config)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Encoded{}, ErrUnsupported
+	}
+	img = Fit(img, maxSide)
+	var buf bytes.Buffer
+	encoded := Encoded{Image: img}
+	// There is no WebP encoder, opaque WebP images become JPEG like photos
+	if format == "jpeg" || format == "webp" && isOpaque(img) {
+		encoded.Ext = ".jpg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	} else {
+		encoded.Ext = ".png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Encoded{}, err
+	}
+	encoded.Data = buf.Bytes()
+	return encoded, nil
+}
+
+func reencodeGIF(data []byte, config image.Config) (Encoded, error) {
+	// Keep the animation, every frame counts against the pixel budget and is
+	// counted before any of them is decoded
+	frames, err := countFrames(data)
+	if err != nil {
+		return Encoded{}, err
+	}
+	if frames > MaxFrames || frames*config.Width*config.Height > MaxPixels*2 {
+		return Encoded{}, ErrTooLarge
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(anim.Image) == 0 {
+		return Encoded{}, ErrUnsupported
+	}
+	var buf bytes.Buffer
+	err = gif.EncodeAll(&buf, &gif.GIF{
+		Image:     anim.Image,
+		Delay:     anim.Delay,
+		Disposal:  anim.Disposal,
+		LoopCount: anim.LoopCount,
+		Config:    anim.Config,
+	})
+	if err != nil {
+		return Encoded{}, err
+	}
+	return Encoded{Data: buf.Bytes(), Ext: ".gif", Image: anim.Image[0]}, nil
+}
+
+// countFrames walks the blocks of a GIF without decompressing them and returns
+// the number of frames, stopping as soon as there are more than MaxFrames.
+func countFrames(data []byte) (int, error) {
+	// Header then logical screen descriptor, followed by the global color table
+	if len(data) < 13 {
+		return 0, ErrUnsupported
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21:
+			// Extension: label then data sub-blocks
+			if pos+2 > len(data) {
+				return 0, ErrUnsupported
+			}
+			next, ok := skipSubBlocks(data, pos+2)
+			if !ok {
+				return 0, ErrUnsupported
+			}
+			pos = next
+		case 0x2c:
+			// Image descriptor, its local color table, the LZW code size then the data sub-blocks
+			frames++
+			if frames > MaxFrames {
+				return frames, nil
+			}
+			if pos+10 > len(data) {
+				return 0, ErrUnsupported
+			}
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << (packed&0x07 + 1)
+			}
+			next, ok := skipSubBlocks(data, pos+1)
+			if !ok {
+				return 0, ErrUnsupported
+			}
+			pos = next
+		case 0x3b:
+			return frames, nil
+		default:
+			return 0, ErrUnsupported
+		}
+	}
+	// Like the decoder, accept a file missing its trailer
+	return frames, nil
+}
+
+func skipSubBlocks(data []byte, pos int) (int, bool) {
+	// Position after the sub-blocks starting at pos, ended by an empty one
+	for pos < len(data) {
+		size := int(data[pos])
+		pos++
+		if size == 0 {
+			return pos, true
+		}
+		pos += size
+	}
+	return pos, false
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testJPEG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReencodeStripsMetadata(t *testing.T) {
+	data := testJPEG(t, 64, 32)
+	// Insert an APP1 segment right after the SOI marker, as cameras do for EXIF
+	secret := []byte("Exif\x00\x00SECRET-GPS")
+	segment := append([]byte{0xff, 0xe1, 0, byte(len(secret) + 2)}, secret...)
+	tagged := append(append(append([]byte{}, data[:2]...), segment...), data[2:]...)
+	tagged = append(tagged, []byte("<?php payload ?>")...)
+
+	encoded, err := Reencode(tagged, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded.Ext != ".jpg" {
+		t.Errorf("Ext = %q, want .jpg", encoded.Ext)
+	}
+	if bytes.Contains(encoded.Data, []byte("SECRET-GPS")) || bytes.Contains(encoded.Data, []byte("payload")) {
+		t.Error("metadata or payload survived the re-encoding")
+	}
+}
+
+func TestReencodeScalesDown(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 100))
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Reencode(buf.Bytes(), 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := encoded.Image.Bounds(); b.Dx() != 150 || b.Dy() != 50 {
+		t.Errorf("size = %dx%d, want 150x50", b.Dx(), b.Dy())
+	}
+}
+
+func TestReencodeRejects(t *testing.T) {
+	if _, err := Reencode([]byte("<html><script>alert(1)</script></html>"), 2048); err != ErrUnsupported {
+		t.Errorf("html: err = %v, want ErrUnsupported", err)
+	}
+	// A valid header announcing a huge image, the pixels are never decoded
+	data := testJPEG(t, 8, 8)
+	for i := 0; i+8 < len(data); i++ {
+		if data[i] == 0xff && data[i+1] == 0xc0 {
+			data[i+5], data[i+6], data[i+7], data[i+8] = 0xff, 0xff, 0xff, 0xff
+			break
+		}
+	}
+	if _, err := Reencode(data, 2048); err != ErrTooLarge {
+		t.Errorf("bomb: err = %v, want ErrTooLarge", err)
+	}
+}
+
+func testGIF(t *testing.T, size, frames int) []byte {
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.Black, color.White}))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReencodeGIFFrames(t *testing.T) {
+	encoded, err := Reencode(testGIF(t, 16, 3), 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(encoded.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded.Ext != ".gif" || len(anim.Image) != 3 {
+		t.Errorf("got %s with %d frames, want .gif with 3", encoded.Ext, len(anim.Image))
+	}
+	// Blank frames compress to almost nothing, they are counted before being decoded
+	if _, err := Reencode(testGIF(t, 16, MaxFrames+1), 2048); err != ErrTooLarge {
+		t.Errorf("frames: err = %v, want ErrTooLarge", err)
+	}
+	if _, err := Reencode(testGIF(t, 2000, 25), 2048); err != ErrTooLarge {
+		t.Errorf("pixels: err = %v, want ErrTooLarge", err)
+	}
+}
@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"container/list"
+	"html/template"
+	"sync"
+)
+
+// Cache keeps the HTML of the most recently shown contents, so a popular
+// post isn't rendered again on every visit.
+type Cache struct {
+	mu       sync.Mutex
+	capacity int
+	resolver Resolver
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key    string
+	source string
+	html   template.HTML
+}
+
+// NewCache creates a cache holding at most capacity contents, their
+// references are looked up with resolver.
+func NewCache(capacity int, resolver Resolver) *Cache {
+	return &Cache{capacity: capacity, resolver: resolver, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Render returns the HTML of the content stored under key, rendering it when
+// it isn't cached. An entry whose source changed is rendered again, even if
+// Invalidate was not called.
+func (c *Cache) Render(key, source string) template.HTML {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.source == source {
+			c.order.MoveToFront(element)
+			c.mu.Unlock()
+			return entry.html
+		}
+	}
+	c.mu.Unlock()
+
+	html := Render(source, c.resolver)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, source: source, html: html})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return html
+}
+
+// Invalidate forgets the HTML of a content, after it was edited or deleted.
+func (c *Cache) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
@@ -0,0 +1,69 @@
+// Package markdown renders the Markdown of posts and comments to HTML:
+// CommonMark with tables, fenced code, ||spoilers||, @mentions, #post
+// links and quotes of comments. Raw HTML is never rendered and the output goes through an allowlist
+// sanitizer.
+package markdown
+
+import (
+	"bytes"
+	"html/template"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+)
+
+var converter = goldmark.New(
+	goldmark.WithExtensions(
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		&spoilerExtension{},
+		&referenceExtension{},
+		&quoteExtension{},
+	),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	// Only the elements the renderer produces are kept, with the attributes they need
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"blockquote", "ul", "ol", "li", "pre", "code", "em", "strong",
+		"table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("start").Matching(regexp.MustCompile(`^[0-9]{1,9}$`)).OnElements("ol")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]{1,30}$`)).OnElements("code")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^spoiler$`)).OnElements("span")
+	p.AllowAttrs("tabindex").Matching(regexp.MustCompile(`^0$`)).OnElements("span")
+
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(post-card-title|post-card-meta)$`)).OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^quote$`)).OnElements("blockquote")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^quote-source$`)).OnElements("p")
+
+	// Links go anywhere on the web, they are marked nofollow and external ones open in a new tab
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^(mention|post-card)$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.AllowRelativeURLs(true)
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+
+	// Images only come from the forum, a remote image would tell its host who reads the post
+	p.AllowAttrs("src").Matching(regexp.MustCompile(`^/uploads/[\w./-]+$`)).OnElements("img")
+	p.AllowAttrs("alt", "title").OnElements("img")
+	return p
+}
+
+// Render converts Markdown to sanitized HTML, safe to put in a template. The
+// references are looked up with resolver, without one they stay plain text.
+func Render(source string, resolver Resolver) template.HTML {
+	var buf bytes.Buffer
+	err := converter.Convert([]byte(source), &buf, parser.WithContext(newContext(resolver)))
+	if err != nil {
+		return template.HTML(template.HTMLEscapeString(source))
+	}
+	return template.HTML(policy.SanitizeBytes(buf.Bytes()))
+}
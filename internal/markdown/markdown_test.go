@@ -0,0 +1,116 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name, source string
+		want         []string
+		reject       []string
+	}{
+		{"emphasis", "*hi* **there**", []string{"<em>hi</em>", "<strong>there</strong>"}, nil},
+		{"fenced code", "```go\nfmt.Println(\"<b>\")\n```", []string{`<code class="language-go">`, "&lt;b&gt;"}, []string{"<b>"}},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |", []string{"<table>", `<th align="left">a</th>`, `<td align="right">2</td>`}, nil},
+		{"spoiler", "Naruto ||dies|| not", []string{`<span class="spoiler" tabindex="0">dies</span>`}, nil},
+		{"single bar", "a | b", []string{"a | b"}, []string{"spoiler"}},
+		{"raw html", "<script>alert(1)</script><img src=x onerror=alert(1)>", nil, []string{"<script", "onerror", "<img"}},
+		{"javascript link", "[x](javascript:alert(1))", nil, []string{"javascript:"}},
+		{"external link", "[x](https://example.com)", []string{`href="https://example.com"`, `rel="nofollow noopener"`, `target="_blank"`}, nil},
+		{"remote image", "![x](https://evil.example/track.png)", nil, []string{"evil.example"}},
+		{"local image", "![x](/uploads/abc.jpg)", []string{`src="/uploads/abc.jpg"`}, nil},
+	}
+	for _, tt := range tests {
+		got := string(Render(tt.source, nil))
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: Render(%q) = %q, want it to contain %q", tt.name, tt.source, got, want)
+			}
+		}
+		for _, reject := range tt.reject {
+			if strings.Contains(got, reject) {
+				t.Errorf("%s: Render(%q) = %q, must not contain %q", tt.name, tt.source, got, reject)
+			}
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(2, nil)
+	if got := c.Render("a", "*a*"); !strings.Contains(string(got), "<em>a</em>") {
+		t.Fatalf("Render = %q", got)
+	}
+	// A changed source is rendered again
+	if got := c.Render("a", "**a**"); !strings.Contains(string(got), "<strong>a</strong>") {
+		t.Errorf("Render after edit = %q", got)
+	}
+	c.Render("b", "b")
+	c.Render("c", "c")
+	if _, ok := c.entries["a"]; ok {
+		t.Error("least recently used entry kept over capacity")
+	}
+	c.Invalidate("c")
+	if _, ok := c.entries["c"]; ok {
+		t.Error("invalidated entry kept")
+	}
+}
+
+type fakeResolver struct{}
+
+func (fakeResolver) UserExists(username string) bool {
+	return username == "alice"
+}
+
+func (fakeResolver) FindPost(ref string) (PostCard, bool) {
+	if ref != "best-openings" {
+		return PostCard{}, false
+	}
+	return PostCard{PostId: "p1", Title: "Best <openings>", Author: "alice", NbOfComments: 3}, true
+}
+
+func (fakeResolver) FindComment(commentId string) (CommentRef, bool) {
+	if commentId != "c0ffee" {
+		return CommentRef{}, false
+	}
+	return CommentRef{CommentId: "c0ffee", PostId: "p1", Author: "alice"}, true
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		source, want string
+	}{
+		{"hi @alice!", `hi <a class="mention" href="/u/alice" rel="nofollow">@alice</a>!`},
+		{"hi @bob", "hi @bob"},
+		{"mail alice@example.com", "mail alice@example.com"},
+		{"`@alice`", "<code>@alice</code>"},
+		{"[ask @alice](https://example.com)", ">ask @alice</a>"},
+		{"see #best-openings-.", `<a class="post-card" href="/post/p1" rel="nofollow"><span class="post-card-title">Best &lt;openings&gt;</span><span class="post-card-meta">by alice · 3 comments</span></a>-.`},
+		{"#1 anime", "#1 anime"},
+		{"> [!quote c0ffee]\n> she *said*", `<blockquote class="quote"><p class="quote-source"><a href="/post/p1#comment-c0ffee" rel="nofollow">alice wrote:</a></p>
+<p>she <em>said</em></p>`},
+		{"> [!quote dead]\n> gone", "<blockquote class=\"quote\"><p>gone</p>"},
+		{"> [!quote c0ffee]", `<blockquote class="quote"><p class="quote-source">`},
+	}
+	for _, tt := range tests {
+		got := string(Render(tt.source, fakeResolver{}))
+		if !strings.Contains(got, tt.want) {
+			t.Errorf("Render(%q) = %q, want it to contain %q", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestMentions(t *testing.T) {
+	got := Mentions("@alice and @bob, again @alice, not `@carol` nor dave@example.com")
+	if strings.Join(got, ",") != "alice,bob" {
+		t.Errorf("Mentions = %q, want [alice bob]", got)
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	got := Quotes("> [!quote aa]\n> one\n\n> [!quote bb]\n> two\n\n> [!quote aa]\n> again\n\n[!quote cc] not in a quote")
+	if strings.Join(got, ",") != "aa,bb" {
+		t.Errorf("Quotes = %q, want [aa bb]", got)
+	}
+}
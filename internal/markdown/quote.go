@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// CommentRef is what a quote shows of the comment it comes from.
+type CommentRef struct {
+	CommentId string
+	PostId    string
+	Author    string
+}
+
+// A quote is a blockquote whose first line names the quoted comment:
+//
+//	> [!quote 7b0c2d7e-…]
+//	> the quoted text
+var quoteMarker = regexp.MustCompile(`^\[!quote ([0-9a-fA-F-]{1,36})\]\s*$`)
+
+// KindQuoteSource is the kind of the nodes heading a quote.
+var KindQuoteSource = gast.NewNodeKind("QuoteSource")
+
+// QuoteSource heads a quote with a link to the comment it comes from.
+type QuoteSource struct {
+	gast.BaseBlock
+	CommentId string
+	Ref       *CommentRef
+}
+
+func (n *QuoteSource) Kind() gast.NodeKind {
+	return KindQuoteSource
+}
+
+func (n *QuoteSource) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"CommentId": n.CommentId}, nil)
+}
+
+type quoteTransformer struct{}
+
+func (t *quoteTransformer) Transform(doc *gast.Document, reader text.Reader, pc parser.Context) {
+	// The quotes are only known once the whole content is parsed
+	var quotes []*gast.Blockquote
+	gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		if quote, ok := n.(*gast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return gast.WalkContinue, nil
+	})
+	refs, _ := pc.Get(referencesKey).(*references)
+	for _, quote := range quotes {
+		paragraph, ok := quote.FirstChild().(*gast.Paragraph)
+		if !ok || paragraph.Lines().Len() == 0 {
+			continue
+		}
+		first := paragraph.Lines().At(0)
+		match := quoteMarker.FindSubmatch(first.Value(reader.Source()))
+		if match == nil {
+			continue
+		}
+		removeFirstLine(paragraph, first)
+
+		node := &QuoteSource{CommentId: string(match[1])}
+		if refs.lookup() {
+			if ref, ok := refs.resolver.FindComment(node.CommentId); ok {
+				node.Ref = &ref
+			}
+		}
+		quote.InsertBefore(quote, quote.FirstChild(), node)
+		quote.SetAttributeString("class", []byte("quote"))
+	}
+}
+
+func removeFirstLine(paragraph *gast.Paragraph, line text.Segment) {
+	// The marker line only holds text, its nodes are dropped and the paragraph too when nothing is left
+	for child := paragraph.FirstChild(); child != nil; {
+		t, ok := child.(*gast.Text)
+		if !ok || t.Segment.Start >= line.Stop {
+			break
+		}
+		next := child.NextSibling()
+		paragraph.RemoveChild(paragraph, child)
+		child = next
+	}
+	if paragraph.FirstChild() == nil {
+		paragraph.Parent().RemoveChild(paragraph.Parent(), paragraph)
+	}
+}
+
+type quoteRenderer struct{}
+
+func (r *quoteRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindQuoteSource, r.render)
+}
+
+func (r *quoteRenderer) render(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	// A quote of a deleted comment keeps its text, without saying where it comes from
+	node := n.(*QuoteSource)
+	if !entering || node.Ref == nil {
+		return gast.WalkContinue, nil
+	}
+	ref := node.Ref
+	fmt.Fprintf(w, "<p class=\"quote-source\"><a href=\"/post/%s#comment-%s\">%s wrote:</a></p>\n",
+		util.URLEscape([]byte(ref.PostId), false), util.URLEscape([]byte(ref.CommentId), false), util.EscapeHTML([]byte(ref.Author)))
+	return gast.WalkContinue, nil
+}
+
+type quoteExtension struct{}
+
+func (e *quoteExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(&quoteTransformer{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&quoteRenderer{}, 500),
+	))
+}
+
+// Quotes returns the comments a content quotes, once each and at most
+// MaxReferences of them.
+func Quotes(source string) []string {
+	doc := converter.Parser().Parse(text.NewReader([]byte(source)), parser.WithContext(newContext(nil)))
+	var commentIds []string
+	seen := map[string]bool{}
+	gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		quote, ok := n.(*QuoteSource)
+		if !entering || !ok || seen[quote.CommentId] {
+			return gast.WalkContinue, nil
+		}
+		seen[quote.CommentId] = true
+		commentIds = append(commentIds, quote.CommentId)
+		if len(commentIds) == MaxReferences {
+			return gast.WalkStop, nil
+		}
+		return gast.WalkContinue, nil
+	})
+	return commentIds
+}
@@ -0,0 +1,236 @@
+package markdown
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// MaxReferences is the number of @mentions, #post links and quotes of a
+// content that are looked up, the following ones stay plain text.
+const MaxReferences = 20
+
+// Longest name after an @ or a #, usernames are shorter and slugs are cut before
+const maxReferenceLength = 80
+
+// PostCard is what a #post link shows of the post it refers to.
+type PostCard struct {
+	PostId       string
+	Title        string
+	Author       string
+	NbOfComments int
+}
+
+// Resolver looks up the users, posts and comments a content refers to.
+type Resolver interface {
+	// UserExists tells whether @username is someone
+	UserExists(username string) bool
+	// FindPost finds a post by its id or its slug
+	FindPost(ref string) (PostCard, bool)
+	// FindComment finds the comment a quote comes from
+	FindComment(commentId string) (CommentRef, bool)
+}
+
+// KindMention is the kind of the nodes calling a user, written @username.
+var KindMention = gast.NewNodeKind("Mention")
+
+// Mention is an inline node calling a user. It is a link to his profile when
+// he exists, text otherwise.
+type Mention struct {
+	gast.BaseInline
+	Username string
+	Known    bool
+}
+
+func (n *Mention) Kind() gast.NodeKind {
+	return KindMention
+}
+
+func (n *Mention) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Username": n.Username}, nil)
+}
+
+// KindPostLink is the kind of the nodes linking a post, written #id or #slug.
+var KindPostLink = gast.NewNodeKind("PostLink")
+
+// PostLink is an inline node shown as a card of the post it refers to, or as
+// text when there is no such post.
+type PostLink struct {
+	gast.BaseInline
+	Ref  string
+	Card *PostCard
+}
+
+func (n *PostLink) Kind() gast.NodeKind {
+	return KindPostLink
+}
+
+func (n *PostLink) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, map[string]string{"Ref": n.Ref}, nil)
+}
+
+var referencesKey = parser.NewContextKey()
+
+// references is stored in the parser context, it counts the lookups of a content
+type references struct {
+	resolver Resolver
+	lookups  int
+}
+
+func (r *references) lookup() bool {
+	if r == nil || r.resolver == nil || r.lookups >= MaxReferences {
+		return false
+	}
+	r.lookups++
+	return true
+}
+
+func newContext(resolver Resolver) parser.Context {
+	pc := parser.NewContext()
+	pc.Set(referencesKey, &references{resolver: resolver})
+	return pc
+}
+
+type referenceParser struct{}
+
+func (p *referenceParser) Trigger() []byte {
+	return []byte{'@', '#'}
+}
+
+func (p *referenceParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	// A marker inside a word, like in an email address, is not a reference
+	if isReferenceRune(block.PrecendingCharacter(), true) {
+		return nil
+	}
+	line, _ := block.PeekLine()
+	marker := line[0]
+	name := scanReference(line[1:], marker == '#')
+	if name == "" {
+		return nil
+	}
+	block.Advance(1 + len(name))
+
+	refs, _ := pc.Get(referencesKey).(*references)
+	if marker == '@' {
+		node := &Mention{Username: name}
+		if refs.lookup() {
+			node.Known = refs.resolver.UserExists(name)
+		}
+		return node
+	}
+	node := &PostLink{Ref: name}
+	if refs.lookup() {
+		if card, ok := refs.resolver.FindPost(name); ok {
+			node.Card = &card
+		}
+	}
+	return node
+}
+
+func isReferenceRune(r rune, slug bool) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || (slug && r == '-')
+}
+
+func scanReference(line []byte, slug bool) string {
+	// Usernames are letters and digits, slugs and ids also have dashes but never end with one
+	end := 0
+	for end < len(line) {
+		r, size := utf8.DecodeRune(line[end:])
+		if !isReferenceRune(r, slug) {
+			break
+		}
+		end += size
+	}
+	for end > 0 && line[end-1] == '-' {
+		end--
+	}
+	if end > maxReferenceLength {
+		return ""
+	}
+	return string(line[:end])
+}
+
+type referenceRenderer struct{}
+
+func (r *referenceRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMention, r.renderMention)
+	reg.Register(KindPostLink, r.renderPostLink)
+}
+
+func (r *referenceRenderer) renderMention(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	node := n.(*Mention)
+	name := util.EscapeHTML([]byte(node.Username))
+	if !node.Known || insideLink(n) {
+		fmt.Fprintf(w, "@%s", name)
+		return gast.WalkContinue, nil
+	}
+	fmt.Fprintf(w, `<a class="mention" href="/u/%s">@%s</a>`, util.URLEscape([]byte(node.Username), false), name)
+	return gast.WalkContinue, nil
+}
+
+func (r *referenceRenderer) renderPostLink(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	if !entering {
+		return gast.WalkContinue, nil
+	}
+	node := n.(*PostLink)
+	if node.Card == nil || insideLink(n) {
+		fmt.Fprintf(w, "#%s", util.EscapeHTML([]byte(node.Ref)))
+		return gast.WalkContinue, nil
+	}
+	card := node.Card
+	fmt.Fprintf(w, `<a class="post-card" href="/post/%s"><span class="post-card-title">%s</span><span class="post-card-meta">by %s · %d comments</span></a>`,
+		util.URLEscape([]byte(card.PostId), false), util.EscapeHTML([]byte(card.Title)), util.EscapeHTML([]byte(card.Author)), card.NbOfComments)
+	return gast.WalkContinue, nil
+}
+
+func insideLink(n gast.Node) bool {
+	// Links can't be nested, a reference in the text of a link stays text
+	for p := n.Parent(); p != nil; p = p.Parent() {
+		if p.Kind() == gast.KindLink || p.Kind() == gast.KindAutoLink {
+			return true
+		}
+	}
+	return false
+}
+
+type referenceExtension struct{}
+
+func (e *referenceExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&referenceParser{}, 600),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&referenceRenderer{}, 600),
+	))
+}
+
+// Mentions returns the users a content calls, once each and at most
+// MaxReferences of them. Mentions in code or in the text of a link don't count.
+func Mentions(source string) []string {
+	doc := converter.Parser().Parse(text.NewReader([]byte(source)), parser.WithContext(newContext(nil)))
+	var usernames []string
+	seen := map[string]bool{}
+	gast.Walk(doc, func(n gast.Node, entering bool) (gast.WalkStatus, error) {
+		mention, ok := n.(*Mention)
+		if !entering || !ok || seen[mention.Username] || insideLink(n) {
+			return gast.WalkContinue, nil
+		}
+		seen[mention.Username] = true
+		usernames = append(usernames, mention.Username)
+		if len(usernames) == MaxReferences {
+			return gast.WalkStop, nil
+		}
+		return gast.WalkContinue, nil
+	})
+	return usernames
+}
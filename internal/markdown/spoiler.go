@@ -0,0 +1,89 @@
+package markdown
+
+import (
+	"github.com/yuin/goldmark"
+	gast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindSpoiler is the kind of the nodes hiding text until it is clicked.
+var KindSpoiler = gast.NewNodeKind("Spoiler")
+
+// Spoiler is an inline node written ||like this||.
+type Spoiler struct {
+	gast.BaseInline
+}
+
+func (n *Spoiler) Kind() gast.NodeKind {
+	return KindSpoiler
+}
+
+func (n *Spoiler) Dump(source []byte, level int) {
+	gast.DumpHelper(n, source, level, nil, nil)
+}
+
+type spoilerDelimiterProcessor struct{}
+
+func (p *spoilerDelimiterProcessor) IsDelimiter(b byte) bool {
+	return b == '|'
+}
+
+func (p *spoilerDelimiterProcessor) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (p *spoilerDelimiterProcessor) OnMatch(consumes int) gast.Node {
+	return &Spoiler{}
+}
+
+type spoilerParser struct{}
+
+func (s *spoilerParser) Trigger() []byte {
+	return []byte{'|'}
+}
+
+func (s *spoilerParser) Parse(parent gast.Node, block text.Reader, pc parser.Context) gast.Node {
+	// Only a pair of bars opens or closes a spoiler, a single one stays text
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, 2, &spoilerDelimiterProcessor{})
+	if node == nil || node.OriginalLength != 2 || before == '|' {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func (s *spoilerParser) CloseBlock(parent gast.Node, pc parser.Context) {}
+
+type spoilerRenderer struct{}
+
+func (r *spoilerRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindSpoiler, r.render)
+}
+
+func (r *spoilerRenderer) render(w util.BufWriter, source []byte, n gast.Node, entering bool) (gast.WalkStatus, error) {
+	// Focusable so keyboard users can reveal it too, the CSS shows it on focus
+	if entering {
+		w.WriteString(`<span class="spoiler" tabindex="0">`)
+	} else {
+		w.WriteString("</span>")
+	}
+	return gast.WalkContinue, nil
+}
+
+type spoilerExtension struct{}
+
+func (e *spoilerExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&spoilerParser{}, 500),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&spoilerRenderer{}, 500),
+	))
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"forum-go/internal/shared"
+	"html/template"
 	"time"
 )
 
@@ -19,6 +20,8 @@ type User struct {
 	Posts            []Post         `db:"-"`
 	Activities       []Activity     `db:"-"`
 	UnreadActivities int            `db:"-"`
+	UnreadMessages   int            `db:"-"`
+	Karma            int            `db:"-"`
 }
 
 type Category struct {
@@ -29,36 +32,144 @@ type Post_Comment interface {
 	GetUserLikes() []UserLike
 }
 type Post struct {
-	PostId                string       `db:"post_id"`
-	Title                 string       `db:"title"`
-	Content               string       `db:"content"`
-	UserID                string       `db:"user_id"`
-	CreationDate          time.Time    `db:"creation_date"`
-	ImageURL              string       `db:"image_url"`
-	FormattedCreationDate string       `db:"-"`
-	UpdateDate            sql.NullTime `db:"update_date"`
-	User                  User         `db:"-"`
-	Categories            []Category   `db:"-"`
-	Comments              []Comment    `db:"-"`
-	NbOfComments          int          `db:"-"`
-	UserLikes             []UserLike   `db:"-"`
-	Likes                 int          `db:"-"`
-	Dislikes              int          `db:"-"`
-	HasVoted              int          `db:"-"`
+	PostId                string            `db:"post_id"`
+	Title                 string            `db:"title"`
+	Slug                  string            `db:"slug"`
+	Content               string            `db:"content"`
+	RenderedContent       template.HTML     `db:"-"`
+	UserID                string            `db:"user_id"`
+	CreationDate          time.Time         `db:"creation_date"`
+	ImageURL              string            `db:"image_url"`
+	ThumbnailURL          string            `db:"-"`
+	Attachments           []Attachment      `db:"-"`
+	Poll                  *Poll             `db:"-"`
+	NbOfAttachments       int               `db:"-"`
+	FormattedCreationDate string            `db:"-"`
+	UpdateDate            sql.NullTime      `db:"update_date"`
+	Status                string            `db:"status"`
+	PublishDate           sql.NullTime      `db:"publish_date"`
+	FormattedPublishDate  string            `db:"-"`
+	Pinned                bool              `db:"pinned"`
+	PinnedCategoryId      string            `db:"pinned_category_id"`
+	Locked                bool              `db:"locked"`
+	Archived              bool              `db:"archived"`
+	StateChanges          []PostStateChange `db:"-"`
+	User                  User              `db:"-"`
+	Categories            []Category        `db:"-"`
+	Comments              []Comment         `db:"-"`
+	NbOfComments          int               `db:"-"`
+	NbOfBookmarks         int               `db:"-"`
+	IsBookmarked          bool              `db:"-"`
+	UserLikes             []UserLike        `db:"-"`
+	Likes                 int               `db:"-"`
+	Dislikes              int               `db:"-"`
+	HasVoted              int               `db:"-"`
+	Reactions             []ReactionCount   `db:"-"`
 }
 
 type Comment struct {
-	CommentId             string     `db:"comment_id"`
-	Content               string     `db:"content"`
-	CreationDate          time.Time  `db:"creation_date"`
-	FormattedCreationDate string     `db:"-"`
-	UserID                string     `db:"user_id"`
-	PostID                string     `db:"post_id"`
-	Username              string     `db:"-"`
-	UserLikes             []UserLike `db:"-"`
-	Likes                 int        `db:"-"`
-	Dislikes              int        `db:"-"`
-	HasVoted              int        `db:"-"`
+	CommentId             string          `db:"comment_id"`
+	Content               string          `db:"content"`
+	RenderedContent       template.HTML   `db:"-"`
+	CreationDate          time.Time       `db:"creation_date"`
+	FormattedCreationDate string          `db:"-"`
+	UserID                string          `db:"user_id"`
+	PostID                string          `db:"post_id"`
+	PostTitle             string          `db:"-"`
+	Username              string          `db:"-"`
+	UserKarma             int             `db:"-"`
+	DeletionDate          sql.NullTime    `db:"deletion_date"`
+	IsBookmarked          bool            `db:"-"`
+	UserLikes             []UserLike      `db:"-"`
+	Likes                 int             `db:"-"`
+	Dislikes              int             `db:"-"`
+	HasVoted              int             `db:"-"`
+	Reactions             []ReactionCount `db:"-"`
+}
+
+type Poll struct {
+	PollId             string       `db:"poll_id"`
+	PostId             string       `db:"post_id"`
+	Question           string       `db:"question"`
+	Multiple           bool         `db:"multiple"`
+	CloseDate          sql.NullTime `db:"close_date"`
+	ClosedNotified     bool         `db:"closed_notified"`
+	CreationDate       time.Time    `db:"creation_date"`
+	Options            []PollOption `db:"-"`
+	NbOfVoters         int          `db:"-"`
+	HasVoted           bool         `db:"-"`
+	Closed             bool         `db:"-"`
+	FormattedCloseDate string       `db:"-"`
+	PostTitle          string       `db:"-"`
+	PostUserID         string       `db:"-"`
+}
+
+type PollOption struct {
+	OptionId string `db:"option_id"`
+	PollId   string `db:"poll_id"`
+	Label    string `db:"label"`
+	Position int    `db:"position"`
+	Votes    int    `db:"-"`
+	Percent  int    `db:"-"`
+	Chosen   bool   `db:"-"`
+}
+
+type Attachment struct {
+	AttachmentId string    `db:"attachment_id"`
+	PostId       string    `db:"post_id"`
+	ImageURL     string    `db:"image_url"`
+	ThumbnailURL string    `db:"-"`
+	Caption      string    `db:"caption"`
+	Position     int       `db:"position"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+type PostStateChange struct {
+	ChangeId              string    `db:"change_id"`
+	PostId                string    `db:"post_id"`
+	UserId                string    `db:"user_id"`
+	Username              string    `db:"-"`
+	State                 string    `db:"state"`
+	CategoryId            string    `db:"category_id"`
+	CategoryName          string    `db:"-"`
+	Reason                string    `db:"reason"`
+	CreationDate          time.Time `db:"creation_date"`
+	FormattedCreationDate string    `db:"-"`
+}
+
+type BookmarkFolder struct {
+	FolderId      string    `db:"folder_id"`
+	UserId        string    `db:"user_id"`
+	Name          string    `db:"name"`
+	CreationDate  time.Time `db:"creation_date"`
+	NbOfBookmarks int       `db:"-"`
+}
+
+type Bookmark struct {
+	BookmarkId   string    `db:"bookmark_id"`
+	UserId       string    `db:"user_id"`
+	PostId       string    `db:"post_id"`
+	CommentId    string    `db:"comment_id"`
+	FolderId     string    `db:"folder_id"`
+	CreationDate time.Time `db:"creation_date"`
+	Comment      Comment   `db:"-"`
+}
+
+type Subscription struct {
+	SubscriptionId string    `db:"subscription_id"`
+	UserId         string    `db:"user_id"`
+	PostId         string    `db:"post_id"`
+	PostTitle      string    `db:"-"`
+	CategoryId     string    `db:"category_id"`
+	CategoryName   string    `db:"-"`
+	CreationDate   time.Time `db:"creation_date"`
+}
+
+type Follow struct {
+	FollowId     string    `db:"follow_id"`
+	FollowerId   string    `db:"follower_id"`
+	FollowedId   string    `db:"followed_id"`
+	CreationDate time.Time `db:"creation_date"`
 }
 
 type PostCategory struct {
@@ -115,6 +226,363 @@ type Report struct {
 	Status                string    `db:"status"`
 }
 
+type TrashItem struct {
+	Kind                  string    `db:"-"`
+	Id                    string    `db:"-"`
+	Label                 string    `db:"-"`
+	Author                string    `db:"-"`
+	PostId                string    `db:"post_id"`
+	DeletionDate          time.Time `db:"deletion_date"`
+	FormattedDeletionDate string    `db:"-"`
+	DeletedBy             string    `db:"-"`
+}
+
+// Kinds of rows the trash holds
+const (
+	TRASH_POST    = "post"
+	TRASH_COMMENT = "comment"
+	TRASH_USER    = "user"
+)
+
+type Block struct {
+	BlockId        string    `db:"block_id"`
+	UserId         string    `db:"user_id"`
+	TargetId       string    `db:"target_id"`
+	TargetUsername string    `db:"-"`
+	Kind           string    `db:"kind"`
+	CreationDate   time.Time `db:"creation_date"`
+}
+
+// Kinds of blocks, a muted user is hidden while a blocked one also can't reach the user
+const (
+	BLOCK_BLOCK = "block"
+	BLOCK_MUTE  = "mute"
+)
+
+type Conversation struct {
+	ConversationId      string    `db:"conversation_id"`
+	CreatorId           string    `db:"creator_id"`
+	CreationDate        time.Time `db:"creation_date"`
+	UpdateDate          time.Time `db:"update_date"`
+	FormattedUpdateDate string    `db:"-"`
+	Other               User      `db:"-"`
+	LastMessage         string    `db:"-"`
+	NbOfUnread          int       `db:"-"`
+	Messages            []Message `db:"-"`
+}
+
+type Message struct {
+	MessageId             string       `db:"message_id"`
+	ConversationId        string       `db:"conversation_id"`
+	UserId                string       `db:"user_id"`
+	Username              string       `db:"-"`
+	Content               string       `db:"content"`
+	CreationDate          time.Time    `db:"creation_date"`
+	FormattedCreationDate string       `db:"-"`
+	DeletionDate          sql.NullTime `db:"deletion_date"`
+}
+
+type MessageReport struct {
+	ReportId              string    `db:"report_id"`
+	MessageId             string    `db:"message_id"`
+	Message               Message   `db:"-"`
+	UserId                string    `db:"user_id"`
+	Username              string    `db:"-"`
+	Reason                string    `db:"reason"`
+	Status                string    `db:"status"`
+	CreationDate          time.Time `db:"creation_date"`
+	FormattedCreationDate string    `db:"-"`
+}
+
+type Badge struct {
+	BadgeId            string    `db:"badge_id"`
+	Code               string    `db:"code"`
+	Name               string    `db:"name"`
+	Description        string    `db:"description"`
+	CreationDate       time.Time `db:"creation_date"`
+	AwardDate          time.Time `db:"-"`
+	FormattedAwardDate string    `db:"-"`
+	NbOfAwards         int       `db:"-"`
+}
+
+// BadgeStats are what the rules of the badges look at for a user
+type BadgeStats struct {
+	Posts            int
+	LikesReceived    int
+	AcceptedReports  int
+	AcceptedRequests int
+}
+
+type Reaction struct {
+	ReactionId   string    `db:"reaction_id"`
+	UserId       string    `db:"user_id"`
+	PostId       string    `db:"post_id"`
+	CommentId    string    `db:"comment_id"`
+	Emoji        string    `db:"emoji"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+// ReactionCount is how many users reacted with an emoji to a post, or to one of its comments
+type ReactionCount struct {
+	CommentId string
+	Emoji     string
+	Count     int
+	Reacted   bool
+}
+
+type PasswordReset struct {
+	ResetId      string    `db:"reset_id"`
+	UserId       string    `db:"user_id"`
+	TokenHash    string    `db:"token_hash"`
+	ExpireDate   time.Time `db:"expire_date"`
+	Used         bool      `db:"used"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+type UserTotp struct {
+	UserId       string    `db:"user_id"`
+	Secret       string    `db:"secret"`
+	Enabled      bool      `db:"enabled"`
+	LastStep     int64     `db:"last_step"`
+	CreationDate time.Time `db:"creation_date"`
+}
+
+type LoginChallenge struct {
+	ChallengeId string    `db:"challenge_id"`
+	UserId      string    `db:"user_id"`
+	Attempts    int       `db:"attempts"`
+	ExpireDate  time.Time `db:"expire_date"`
+}
+
+type OAuthState struct {
+	State        string    `db:"state"`
+	Provider     string    `db:"provider"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpireDate   time.Time `db:"expire_date"`
+	UserId       string    `db:"user_id"`
+}
+
+type Profile struct {
+	UserId     string    `db:"user_id"`
+	Bio        string    `db:"bio"`
+	Location   string    `db:"location"`
+	Links      []string  `db:"links"`
+	UpdateDate time.Time `db:"update_date"`
+}
+
+type Avatar struct {
+	UserId     string    `db:"user_id"`
+	Version    int64     `db:"version"`
+	UpdateDate time.Time `db:"update_date"`
+}
+
+type Karma struct {
+	Posts    int `db:"-"`
+	Comments int `db:"-"`
+	Total    int `db:"-"`
+}
+
+type UserIdentity struct {
+	IdentityId            string    `db:"identity_id"`
+	UserId                string    `db:"user_id"`
+	Provider              string    `db:"provider"`
+	Subject               string    `db:"subject"`
+	Email                 string    `db:"email"`
+	CreationDate          time.Time `db:"creation_date"`
+	FormattedCreationDate string    `db:"-"`
+}
+
+type LoginThrottle struct {
+	Key                  string       `db:"throttle_key"`
+	Failures             int          `db:"failures"`
+	LastFailure          time.Time    `db:"last_failure"`
+	LockedUntil          sql.NullTime `db:"locked_until"`
+	User                 User         `db:"-"`
+	FormattedLockedUntil string       `db:"-"`
+}
+
+func NewUserIdentity(userId, provider, subject, email string) UserIdentity {
+	// Create a new link between a user and a provider account
+	return UserIdentity{
+		IdentityId:   shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		Provider:     provider,
+		Subject:      subject,
+		Email:        email,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewAttachment(postId, imageURL, caption string, position int) Attachment {
+	// Create a new image of a post
+	return Attachment{
+		AttachmentId: shared.ParseUUID(shared.GenerateUUID()),
+		PostId:       postId,
+		ImageURL:     imageURL,
+		Caption:      caption,
+		Position:     position,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewPoll(postId, question string, multiple bool, closeDate sql.NullTime, labels []string) Poll {
+	// Create a new poll of a post with its options in the given order
+	poll := Poll{
+		PollId:       shared.ParseUUID(shared.GenerateUUID()),
+		PostId:       postId,
+		Question:     question,
+		Multiple:     multiple,
+		CloseDate:    closeDate,
+		CreationDate: time.Now(),
+	}
+	for position, label := range labels {
+		poll.Options = append(poll.Options, PollOption{
+			OptionId: shared.ParseUUID(shared.GenerateUUID()),
+			PollId:   poll.PollId,
+			Label:    label,
+			Position: position,
+		})
+	}
+	return poll
+}
+
+func (poll Poll) IsClosed(now time.Time) bool {
+	// A poll without close date stays open
+	return poll.CloseDate.Valid && !now.Before(poll.CloseDate.Time)
+}
+
+func (throttle LoginThrottle) LockDue(threshold int) bool {
+	// Every threshold failures in a row lock again, as the count only resets after the window or a successful login
+	return throttle.Failures > 0 && throttle.Failures%threshold == 0
+}
+
+func NewPostStateChange(postId, userId, state, categoryId, reason string) PostStateChange {
+	// Create a new post state change
+	return PostStateChange{
+		ChangeId:     shared.ParseUUID(shared.GenerateUUID()),
+		PostId:       postId,
+		UserId:       userId,
+		State:        state,
+		CategoryId:   categoryId,
+		Reason:       reason,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewBookmark(userId, postId, commentId, folderId string) Bookmark {
+	// Create a new bookmark, an empty comment id saves the post itself
+	return Bookmark{
+		BookmarkId:   shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		PostId:       postId,
+		CommentId:    commentId,
+		FolderId:     folderId,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewBookmarkFolder(userId, name string) BookmarkFolder {
+	// Create a new bookmark folder
+	return BookmarkFolder{
+		FolderId:     shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		Name:         name,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewSubscription(userId, postId, categoryId string) Subscription {
+	// Create a new subscription to a thread or, with an empty post id, to a category
+	return Subscription{
+		SubscriptionId: shared.ParseUUID(shared.GenerateUUID()),
+		UserId:         userId,
+		PostId:         postId,
+		CategoryId:     categoryId,
+		CreationDate:   time.Now(),
+	}
+}
+
+func NewFollow(followerId, followedId string) Follow {
+	// Create a new follow of a user by another
+	return Follow{
+		FollowId:     shared.ParseUUID(shared.GenerateUUID()),
+		FollowerId:   followerId,
+		FollowedId:   followedId,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewBlock(userId, targetId, kind string) Block {
+	// Create a new block or mute of a user by another
+	return Block{
+		BlockId:      shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		TargetId:     targetId,
+		Kind:         kind,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewConversation(creatorId string) Conversation {
+	// Create a new conversation started by a user
+	now := time.Now()
+	return Conversation{
+		ConversationId: shared.ParseUUID(shared.GenerateUUID()),
+		CreatorId:      creatorId,
+		CreationDate:   now,
+		UpdateDate:     now,
+	}
+}
+
+func NewMessage(conversationId, userId, content string) Message {
+	// Create a new message of a conversation
+	now := time.Now()
+	return Message{
+		MessageId:             shared.ParseUUID(shared.GenerateUUID()),
+		ConversationId:        conversationId,
+		UserId:                userId,
+		Content:               content,
+		CreationDate:          now,
+		FormattedCreationDate: now.Format("02/01/06 - 15:04"),
+	}
+}
+
+func NewMessageReport(messageId, userId, reason string) MessageReport {
+	// Create a new report of a message, waiting for an admin
+	return MessageReport{
+		ReportId:     shared.ParseUUID(shared.GenerateUUID()),
+		MessageId:    messageId,
+		UserId:       userId,
+		Reason:       reason,
+		Status:       "pending",
+		CreationDate: time.Now(),
+	}
+}
+
+func NewBadge(code, name, description string) Badge {
+	// Create a new badge, an empty code makes it awarded by hand
+	return Badge{
+		BadgeId:      shared.ParseUUID(shared.GenerateUUID()),
+		Code:         code,
+		Name:         name,
+		Description:  description,
+		CreationDate: time.Now(),
+	}
+}
+
+func NewReaction(userId, postId, commentId, emoji string) Reaction {
+	// Create a new reaction of a user to a post, or to a comment when its id is set
+	return Reaction{
+		ReactionId:   shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		PostId:       postId,
+		CommentId:    commentId,
+		Emoji:        emoji,
+		CreationDate: time.Now(),
+	}
+}
+
 func NewRequest(userId, username, content string) Request {
 	// Create a new request
 	request := Request{
@@ -161,16 +629,62 @@ func NewReport(userId, username, postId, content, reason string) Report {
 	return report
 }
 
+func NewPasswordReset(userId, tokenHash string, expireDate time.Time) PasswordReset {
+	// Create a new password reset token
+	reset := PasswordReset{
+		ResetId:      shared.ParseUUID(shared.GenerateUUID()),
+		UserId:       userId,
+		TokenHash:    tokenHash,
+		ExpireDate:   expireDate,
+		Used:         false,
+		CreationDate: time.Now(),
+	}
+	return reset
+}
+
+func NewLoginChallenge(userId string, expireDate time.Time) LoginChallenge {
+	// Create a new pending login
+	challenge := LoginChallenge{
+		ChallengeId: shared.ParseUUID(shared.GenerateUUID()),
+		UserId:      userId,
+		Attempts:    0,
+		ExpireDate:  expireDate,
+	}
+	return challenge
+}
+
 func (post Post) GetUserLikes() []UserLike {
 	// Get the user likes of a post
 	return post.UserLikes
 }
 
+func (post Post) IsPublished() bool {
+	// Drafts and scheduled posts are only seen by their author
+	return post.Status == POST_PUBLISHED
+}
+
 func (comment Comment) GetUserLikes() []UserLike {
 	// Get the user likes of a comment
 	return comment.UserLikes
 }
 
+// Status of a post, only published posts are shown to everyone
+const (
+	POST_DRAFT     = "draft"
+	POST_SCHEDULED = "scheduled"
+	POST_PUBLISHED = "published"
+)
+
+// State changes of a post made by the moderators
+const (
+	POST_PINNED     = "pinned"
+	POST_UNPINNED   = "unpinned"
+	POST_LOCKED     = "locked"
+	POST_UNLOCKED   = "unlocked"
+	POST_ARCHIVED   = "archived"
+	POST_UNARCHIVED = "unarchived"
+)
+
 type ActionType string
 
 const (
@@ -185,4 +699,11 @@ const (
 	POST_CREATED         ActionType = "postCreated"
 	COMMENT_CREATED      ActionType = "commentCreated"
 	GET_COMMENT          ActionType = "getComment"
+	MENTIONED            ActionType = "mentioned"
+	QUOTED               ActionType = "quoted"
+	POLL_CLOSED          ActionType = "pollClosed"
+	FOLLOWED_COMMENT     ActionType = "followedComment"
+	FOLLOWED_POST        ActionType = "followedPost"
+	BADGE_AWARDED        ActionType = "badgeAwarded"
+	GET_REACTION         ActionType = "getReaction"
 )
@@ -0,0 +1,84 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// discovery holds the fields of an OpenID discovery document used by the forum
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IsOIDC tells if the provider issues ID tokens.
+func (p *Provider) IsOIDC() bool {
+	return p.Issuer != ""
+}
+
+func (p *Provider) discover() error {
+	// Fill the endpoints missing from the configuration with the discovery document of the issuer.
+	// The document is only fetched once, a failure is retried on the next login.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.IsOIDC() || p.discovered {
+		return nil
+	}
+	var doc discovery
+	err := getJSON(p.Issuer+"/.well-known/openid-configuration", "", &doc)
+	if err != nil {
+		return fmt.Errorf("discovery of %s: %w", p.Name, err)
+	}
+	if strings.TrimRight(doc.Issuer, "/") != p.Issuer {
+		return fmt.Errorf("discovery of %s: issuer mismatch %q", p.Name, doc.Issuer)
+	}
+	override(&doc.AuthorizationEndpoint, p.AuthURL)
+	override(&doc.TokenEndpoint, p.TokenURL)
+	override(&doc.UserInfoEndpoint, p.UserInfoURL)
+	override(&doc.JWKSURI, p.JWKSURL)
+	p.AuthURL, p.TokenURL, p.UserInfoURL, p.JWKSURL = doc.AuthorizationEndpoint, doc.TokenEndpoint, doc.UserInfoEndpoint, doc.JWKSURI
+	p.discovered = true
+	return nil
+}
+
+func getJSON(url, accessToken string, v interface{}) error {
+	// GET a JSON document, authenticated with the access token when given
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, v)
+}
+
+func decodeResponse(resp *http.Response, v interface{}) error {
+	// Decode a JSON response, numbers are kept as json.Number so ids don't lose precision
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", resp.Request.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(body)))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return errors.New("invalid response from " + resp.Request.URL.Host + ": " + err.Error())
+	}
+	return nil
+}
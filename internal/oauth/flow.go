@@ -0,0 +1,210 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Tokens is the response of the token endpoint.
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+var placeholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// RandomString returns a random URL safe string, used for states, nonces and PKCE verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// AuthCodeURL returns the URL of the provider login page. The PKCE challenge
+// is derived from the verifier, the nonce is only sent to OpenID providers.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) (string, error) {
+	if err := p.discover(); err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"response_type":         {"code"},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if p.IsOIDC() {
+		params.Set("nonce", nonce)
+	}
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + params.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens.
+func (p *Provider) Exchange(code, verifier string) (Tokens, error) {
+	var tokens Tokens
+	if err := p.discover(); err != nil {
+		return tokens, err
+	}
+	form := url.Values{
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"redirect_uri":  {p.RedirectURL},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequest("POST", p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return tokens, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// GitHub answers with a form unless JSON is asked for
+	req.Header.Set("Accept", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return tokens, err
+	}
+	defer resp.Body.Close()
+	err = decodeResponse(resp, &tokens)
+	if err != nil {
+		return tokens, err
+	}
+	// GitHub reports errors with a 200 status
+	if tokens.Error != "" {
+		return tokens, fmt.Errorf("%s: %s %s", p.Name, tokens.Error, tokens.Description)
+	}
+	if tokens.AccessToken == "" {
+		return tokens, errors.New("access token missing from " + p.Name + " response")
+	}
+	if p.IsOIDC() && tokens.IDToken == "" {
+		return tokens, errors.New("ID token missing from " + p.Name + " response")
+	}
+	return tokens, nil
+}
+
+// Identity validates the ID token, completes its claims with the userinfo
+// endpoint and maps them onto an Identity with the claim mapping.
+func (p *Provider) Identity(tokens Tokens, nonce string) (Identity, error) {
+	claims := map[string]interface{}{}
+	if p.IsOIDC() {
+		var err error
+		claims, err = p.VerifyIDToken(tokens.IDToken, nonce, time.Now())
+		if err != nil {
+			return Identity{}, err
+		}
+	}
+	if p.UserInfoURL != "" {
+		var info map[string]interface{}
+		if err := getJSON(p.UserInfoURL, tokens.AccessToken, &info); err != nil {
+			return Identity{}, err
+		}
+		// The subject of the userinfo must be the one of the ID token
+		if sub, ok := claims["sub"]; ok && info["sub"] != nil && info["sub"] != sub {
+			return Identity{}, errors.New("userinfo subject doesn't match the ID token")
+		}
+		for key, value := range info {
+			if _, ok := claims[key]; !ok {
+				claims[key] = value
+			}
+		}
+	}
+
+	identity := Identity{
+		Provider: p.Name,
+		Subject:  claimValue(claims, p.Claims.Subject),
+		Email:    claimValue(claims, p.Claims.Email),
+		Username: claimValue(claims, p.Claims.Username),
+		Picture:  claimValue(claims, p.Claims.Picture),
+	}
+	identity.EmailVerified = claimValue(claims, p.Claims.EmailVerified) == "true"
+	if p.EmailsURL != "" {
+		if err := p.primaryEmail(tokens.AccessToken, &identity); err != nil {
+			return Identity{}, err
+		}
+	}
+	if identity.Subject == "" {
+		return Identity{}, errors.New(p.Name + " didn't return a user id")
+	}
+	return identity, nil
+}
+
+func (p *Provider) primaryEmail(accessToken string, identity *Identity) error {
+	// Use the primary verified address of the emails endpoint
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(p.EmailsURL, accessToken, &emails); err != nil {
+		return err
+	}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			identity.Email, identity.EmailVerified = email.Email, true
+			return nil
+		}
+	}
+	return nil
+}
+
+func claimValue(claims map[string]interface{}, mapping string) string {
+	// Value of a claim as a string. The mapping is either a claim name, a dotted
+	// path in nested objects or a template with {claim} placeholders.
+	if mapping == "" {
+		return ""
+	}
+	if strings.Contains(mapping, "{") {
+		missing := false
+		value := placeholder.ReplaceAllStringFunc(mapping, func(m string) string {
+			v := claimValue(claims, m[1:len(m)-1])
+			if v == "" {
+				missing = true
+			}
+			return url.PathEscape(v)
+		})
+		if missing {
+			return ""
+		}
+		return value
+	}
+	var value interface{} = claims
+	for _, key := range strings.Split(mapping, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	}
+	return ""
+}
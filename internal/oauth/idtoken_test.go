@@ -0,0 +1,111 @@
+package oauth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer jwks.Close()
+	provider := &Provider{Name: "test", Issuer: "https://issuer.example", ClientID: "client", JWKSURL: jwks.URL}
+	now := time.Now()
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://issuer.example", "aud": "client", "sub": "42", "nonce": "n0nce",
+			"exp": now.Add(time.Hour).Unix(), "iat": now.Unix(),
+		}
+	}
+
+	got, err := provider.VerifyIDToken(signToken(t, key, "k1", claims()), "n0nce", now)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claimValue(got, "sub") != "42" {
+		t.Errorf("sub = %q, want 42", claimValue(got, "sub"))
+	}
+
+	tests := []struct {
+		name   string
+		change func(map[string]interface{})
+		kid    string
+		nonce  string
+	}{
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example" }, "k1", "n0nce"},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = []string{"other"} }, "k1", "n0nce"},
+		{"expired", func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() }, "k1", "n0nce"},
+		{"wrong nonce", func(c map[string]interface{}) {}, "k1", "other"},
+		{"unknown key", func(c map[string]interface{}) {}, "k2", "n0nce"},
+	}
+	for _, tt := range tests {
+		c := claims()
+		tt.change(c)
+		if _, err := provider.VerifyIDToken(signToken(t, key, tt.kid, c), tt.nonce, now); err == nil {
+			t.Errorf("%s: token accepted", tt.name)
+		}
+	}
+
+	// A token signed by another key or with a tampered payload is rejected
+	token := signToken(t, key, "k1", claims())
+	parts := strings.Split(token, ".")
+	tampered := claims()
+	tampered["sub"] = "1"
+	payload, _ := json.Marshal(tampered)
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	if _, err := provider.VerifyIDToken(forged, "n0nce", now); err == nil {
+		t.Error("tampered token accepted")
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`)) + "." + parts[1] + "."
+	if _, err := provider.VerifyIDToken(unsigned, "n0nce", now); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestClaimValue(t *testing.T) {
+	claims := map[string]interface{}{"id": json.Number("80351110224678912"), "avatar": "abc", "profile": map[string]interface{}{"name": "Nelly"}, "verified": true}
+	tests := map[string]string{
+		"id":                   "80351110224678912",
+		"verified":             "true",
+		"profile.name":         "Nelly",
+		"missing":              "",
+		"/a/{id}/{avatar}.png": "/a/80351110224678912/abc.png",
+		"/a/{missing}.png":     "",
+	}
+	for mapping, want := range tests {
+		if got := claimValue(claims, mapping); got != want {
+			t.Errorf("claimValue(%q) = %q, want %q", mapping, got, want)
+		}
+	}
+}
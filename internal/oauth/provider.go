@@ -0,0 +1,210 @@
+// Package oauth implements the OAuth2 / OpenID Connect login flow for any
+// provider described in the .env file.
+package oauth
+
+import (
+	"crypto"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"forum-go/internal/shared"
+)
+
+// ClaimMapping tells which claim of the ID token or userinfo response fills
+// each field of the forum user. A value containing "{claim}" placeholders is
+// treated as a template, e.g. "https://cdn.example.com/{id}/{avatar}.png".
+type ClaimMapping struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	Username      string
+	Picture       string
+}
+
+// Provider is a login provider. When Issuer is set the endpoints are read
+// from its OpenID discovery document and ID tokens are validated, otherwise
+// the endpoints must be configured explicitly (plain OAuth2 like GitHub).
+type Provider struct {
+	Name         string
+	DisplayName  string
+	Icon         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Issuer       string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	// EmailsURL returns a list of {email, primary, verified} objects, used by
+	// providers that don't put a verified email in the profile (GitHub).
+	EmailsURL string
+	JWKSURL   string
+	Claims    ClaimMapping
+
+	mu         sync.Mutex
+	discovered bool
+	keys       map[string]crypto.PublicKey
+}
+
+// Registry holds the providers enabled in the configuration.
+type Registry struct {
+	providers []*Provider
+}
+
+// Identity is the user returned by a provider after a successful login.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Picture       string
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Default OpenID Connect claims, used by providers without a preset
+var oidcClaims = ClaimMapping{
+	Subject:       "sub",
+	Email:         "email",
+	EmailVerified: "email_verified",
+	Username:      "preferred_username",
+	Picture:       "picture",
+}
+
+// Presets of the providers supported out of the box, the .env only needs
+// their client id and secret. legacy holds the env keys used before the
+// registry existed so old configurations keep working.
+var presets = map[string]struct {
+	provider *Provider
+	legacy   map[string]string
+}{
+	"google": {
+		provider: &Provider{
+			DisplayName: "Google",
+			Icon:        "https://www.google.com/favicon.ico",
+			Issuer:      "https://accounts.google.com",
+			Scopes:      []string{"openid", "email", "profile"},
+			Claims:      ClaimMapping{Subject: "sub", Email: "email", EmailVerified: "email_verified", Username: "name", Picture: "picture"},
+		},
+		legacy: map[string]string{"ClientID": "googleClientID", "ClientSecret": "googleClientSecret", "RedirectURL": "googleRedirectURL"},
+	},
+	"github": {
+		provider: &Provider{
+			DisplayName: "GitHub",
+			Icon:        "/assets/img/github-mark-white.svg",
+			AuthURL:     "https://github.com/login/oauth/authorize",
+			TokenURL:    "https://github.com/login/oauth/access_token",
+			UserInfoURL: "https://api.github.com/user",
+			EmailsURL:   "https://api.github.com/user/emails",
+			Scopes:      []string{"read:user", "user:email"},
+			Claims:      ClaimMapping{Subject: "id", Email: "email", Username: "login", Picture: "avatar_url"},
+		},
+		legacy: map[string]string{"ClientID": "GitHubClientID", "ClientSecret": "GitHubClientSecret", "RedirectURL": "GitHubredirectURI"},
+	},
+	"discord": {
+		provider: &Provider{
+			DisplayName: "Discord",
+			Icon:        "/assets/img/discord.svg",
+			AuthURL:     "https://discord.com/oauth2/authorize",
+			TokenURL:    "https://discord.com/api/oauth2/token",
+			UserInfoURL: "https://discord.com/api/users/@me",
+			Scopes:      []string{"identify", "email"},
+			Claims:      ClaimMapping{Subject: "id", Email: "email", EmailVerified: "verified", Username: "username", Picture: "https://cdn.discordapp.com/avatars/{id}/{avatar}.png"},
+		},
+		legacy: map[string]string{"ClientID": "DiscordClientID", "ClientSecret": "DiscordClientSecret", "RedirectURL": "DiscordRedirectURI"},
+	},
+}
+
+// LoadProviders builds the registry from the .env file. The providers are
+// listed in oauthProviders (e.g. "google,github,gitlab"), each one being
+// configured with keys prefixed by its name: gitlabClientID, gitlabIssuer...
+// Without oauthProviders, every preset with a client id is enabled.
+func LoadProviders() *Registry {
+	names := splitList(shared.GetEnv("oauthProviders"))
+	if len(names) == 0 {
+		for _, name := range []string{"google", "github", "discord"} {
+			if env(name, "ClientID", presets[name].legacy) != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	registry := &Registry{}
+	for _, name := range names {
+		registry.providers = append(registry.providers, loadProvider(strings.ToLower(name)))
+	}
+	return registry
+}
+
+// Get returns the provider with the given name.
+func (registry *Registry) Get(name string) (*Provider, bool) {
+	for _, provider := range registry.providers {
+		if provider.Name == name {
+			return provider, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the enabled providers in configuration order.
+func (registry *Registry) List() []*Provider {
+	return registry.providers
+}
+
+func loadProvider(name string) *Provider {
+	// Start from the preset of the provider, if any, and apply the .env on top of it
+	preset, hasPreset := presets[name]
+	provider := &Provider{Name: name, DisplayName: name, Claims: oidcClaims, Scopes: []string{"openid", "email", "profile"}}
+	if hasPreset {
+		p := preset.provider
+		provider.DisplayName, provider.Icon, provider.Issuer = p.DisplayName, p.Icon, p.Issuer
+		provider.AuthURL, provider.TokenURL, provider.UserInfoURL, provider.EmailsURL = p.AuthURL, p.TokenURL, p.UserInfoURL, p.EmailsURL
+		provider.Scopes, provider.Claims = p.Scopes, p.Claims
+	}
+	legacy := preset.legacy
+	provider.ClientID = env(name, "ClientID", legacy)
+	provider.ClientSecret = env(name, "ClientSecret", legacy)
+	provider.RedirectURL = env(name, "RedirectURL", legacy)
+	override(&provider.DisplayName, env(name, "DisplayName", nil))
+	override(&provider.Icon, env(name, "Icon", nil))
+	override(&provider.Issuer, strings.TrimRight(env(name, "Issuer", nil), "/"))
+	override(&provider.AuthURL, env(name, "AuthURL", nil))
+	override(&provider.TokenURL, env(name, "TokenURL", nil))
+	override(&provider.UserInfoURL, env(name, "UserInfoURL", nil))
+	override(&provider.EmailsURL, env(name, "EmailsURL", nil))
+	override(&provider.JWKSURL, env(name, "JWKSURL", nil))
+	override(&provider.Claims.Subject, env(name, "ClaimSubject", nil))
+	override(&provider.Claims.Email, env(name, "ClaimEmail", nil))
+	override(&provider.Claims.EmailVerified, env(name, "ClaimEmailVerified", nil))
+	override(&provider.Claims.Username, env(name, "ClaimUsername", nil))
+	override(&provider.Claims.Picture, env(name, "ClaimPicture", nil))
+	if scopes := splitList(env(name, "Scopes", nil)); len(scopes) > 0 {
+		provider.Scopes = scopes
+	}
+	if provider.RedirectURL == "" {
+		provider.RedirectURL = strings.TrimRight(shared.GetEnv("baseURL"), "/") + "/auth/" + name + "/callback"
+	}
+	return provider
+}
+
+func env(name, key string, legacy map[string]string) string {
+	// Read <name><key> from the .env, falling back on the legacy key of the preset
+	if value := shared.GetEnv(name + key); value != "" {
+		return value
+	}
+	return shared.GetEnv(legacy[key])
+}
+
+func override(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
+
+func splitList(value string) []string {
+	// Split a list separated by commas or spaces
+	return strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+}
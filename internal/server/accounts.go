@@ -0,0 +1,251 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"forum-go/internal/models"
+	"forum-go/internal/oauth"
+	"forum-go/internal/shared"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Accounts without a password confirm their identity by having logged in recently
+const reauthWindow = 10 * time.Minute
+
+type linkedAccount struct {
+	Identity models.UserIdentity
+	Provider *oauth.Provider
+}
+
+func (s *Server) GetAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	// GetAccountsHandler handles the page listing the login providers linked to the account
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderAccounts(w, r, s.getUser(r), nil)
+}
+
+func (s *Server) PostLinkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// PostLinkAccountHandler re-authenticates the user and sends him to the provider to link
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	provider, ok := s.providers.Get(r.FormValue("provider"))
+	if !ok {
+		s.errorHandler(w, r, http.StatusNotFound, "Unknown login provider")
+		return
+	}
+	errMsg, err := s.reauthenticate(r, user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errMsg != "" {
+		s.renderAccounts(w, r, user, map[string]interface{}{"Error": errMsg})
+		return
+	}
+	s.startOAuth(w, r, provider, user.UserId)
+}
+
+func (s *Server) PostUnlinkAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// PostUnlinkAccountHandler removes a provider from the account, as long as another way to log in is left
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	identities, err := s.db.GetUserIdentities(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var unlinked models.UserIdentity
+	var remaining []models.UserIdentity
+	for _, identity := range identities {
+		if identity.IdentityId == r.FormValue("identityid") {
+			unlinked = identity
+		} else {
+			remaining = append(remaining, identity)
+		}
+	}
+	if unlinked.IdentityId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Linked account not found")
+		return
+	}
+	if user.Provider != "local" && len(remaining) == 0 {
+		s.renderAccounts(w, r, user, map[string]interface{}{"Error": "You can't unlink the only way to log in to your account"})
+		return
+	}
+	errMsg, err := s.reauthenticate(r, user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errMsg != "" {
+		s.renderAccounts(w, r, user, map[string]interface{}{"Error": errMsg})
+		return
+	}
+	err = s.db.DeleteIdentity(unlinked.IdentityId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The account was created with this provider, it now belongs to one still linked
+	if user.Provider == unlinked.Provider {
+		user.Provider = remaining[0].Provider
+		err = s.db.SetUserProvider(user.UserId, user.Provider)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for i := range s.users {
+			if s.users[i].UserId == user.UserId {
+				s.users[i].Provider = user.Provider
+				break
+			}
+		}
+	}
+	s.renderAccounts(w, r, user, map[string]interface{}{"Success": "Your " + s.providerName(unlinked.Provider) + " account has been unlinked."})
+}
+
+func (s *Server) linkIdentity(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, identity oauth.Identity, userId string) {
+	// Finish linking a provider account to the user who started it
+	if !s.isLoggedIn(r) || s.getUser(r).UserId != userId {
+		render(w, r, "login", map[string]interface{}{"Error": "Your session has expired, please log in and try again."})
+		return
+	}
+	user := s.getUser(r)
+	linked, err := s.db.GetIdentity(provider.Name, identity.Subject)
+	if err == nil {
+		errMsg := "This " + provider.DisplayName + " account is already linked to another user."
+		if linked.UserId == user.UserId {
+			errMsg = "This " + provider.DisplayName + " account is already linked."
+		}
+		s.renderAccounts(w, r, user, map[string]interface{}{"Error": errMsg})
+		return
+	}
+	if err != sql.ErrNoRows {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	identities, err := s.db.GetUserIdentities(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, i := range identities {
+		if i.Provider == provider.Name {
+			s.renderAccounts(w, r, user, map[string]interface{}{"Error": "Another " + provider.DisplayName + " account is already linked, unlink it first."})
+			return
+		}
+	}
+	err = s.db.CreateIdentity(models.NewUserIdentity(user.UserId, provider.Name, identity.Subject, identity.Email))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.renderAccounts(w, r, user, map[string]interface{}{"Success": "Your " + provider.DisplayName + " account has been linked."})
+}
+
+func (s *Server) mergeIdentity(user models.User, provider *oauth.Provider, identity oauth.Identity) error {
+	// Link a provider account to the user created by a provider with the same verified email, and let the owner know
+	err := s.db.CreateIdentity(models.NewUserIdentity(user.UserId, provider.Name, identity.Subject, identity.Email))
+	if err != nil {
+		return err
+	}
+	avatar, err := s.db.GetAvatar(user.UserId)
+	if err != nil {
+		return err
+	}
+	if avatar.Version == 0 {
+		s.importAvatar(user.UserId, identity.Picture)
+	}
+	// Accounts created by a provider before identities existed are linked silently
+	if user.Provider == provider.Name {
+		return nil
+	}
+	body := "Hello " + user.Username + ",\n\nYour " + provider.DisplayName + " account has been linked to your Aniverse account, you can now use it to log in.\n\n" +
+		"If it wasn't you, unlink it and change your password: " + baseURL() + "/settings/accounts"
+	err = shared.SendMail(user.Email, "A new login method was added to your Aniverse account", body)
+	if err != nil {
+		log.Printf("Failed to send account linked email: %v\n", err)
+	}
+	return nil
+}
+
+func (s *Server) reauthenticate(r *http.Request, user models.User) (string, error) {
+	// Confirm the identity of a logged in user before changing his login methods.
+	// Users with a password type it again, with their second factor if enabled,
+	// the others must have logged in within the last minutes.
+	if user.Provider != "local" {
+		if !user.SessionExpire.Valid || time.Until(user.SessionExpire.Time) < sessionDuration-reauthWindow {
+			return "For your security, please log out and log in again before changing your login methods.", nil
+		}
+		return "", nil
+	}
+	totp, err := s.db.GetTotp(user.UserId)
+	if err != nil {
+		return "", err
+	}
+	if totp.Enabled {
+		return s.confirmIdentity(user, r.FormValue("password"), r.FormValue("code"))
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(r.FormValue("password"))) != nil {
+		return "Password is incorrect", nil
+	}
+	return "", nil
+}
+
+func (s *Server) renderAccounts(w http.ResponseWriter, r *http.Request, user models.User, data map[string]interface{}) {
+	// Render the linked accounts page with the providers that can still be linked
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	identities, err := s.db.GetUserIdentities(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	totp, err := s.db.GetTotp(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var linked []linkedAccount
+	isLinked := map[string]bool{}
+	for _, identity := range identities {
+		identity.FormattedCreationDate = identity.CreationDate.Format("Jan 2, 2006")
+		provider, _ := s.providers.Get(identity.Provider)
+		if provider == nil {
+			provider = &oauth.Provider{Name: identity.Provider, DisplayName: identity.Provider}
+		}
+		linked = append(linked, linkedAccount{Identity: identity, Provider: provider})
+		isLinked[identity.Provider] = true
+	}
+	var available []*oauth.Provider
+	for _, provider := range s.providers.List() {
+		if !isLinked[provider.Name] {
+			available = append(available, provider)
+		}
+	}
+	data["Linked"] = linked
+	data["Available"] = available
+	data["HasPassword"] = user.Provider == "local"
+	data["TwoFactor"] = totp.Enabled
+	render(w, r, "accounts", data)
+}
+
+func (s *Server) providerName(name string) string {
+	// Display name of a provider, which may have been removed from the configuration
+	if provider, ok := s.providers.Get(name); ok {
+		return provider.DisplayName
+	}
+	return name
+}
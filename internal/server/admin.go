@@ -91,6 +91,7 @@ func (s *Server) AcceptRequestHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 	}
+	s.awardBadges(userid)
 	http.Redirect(w, r, "../adminPanel/modrequests", http.StatusSeeOther)
 }
 
@@ -129,7 +130,12 @@ func (s *Server) GetReportsHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	render(w, r, "admin/reports", map[string]interface{}{"Reports": Reports})
+	messageReports, err := s.db.GetMessageReports()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "admin/reports", map[string]interface{}{"Reports": Reports, "MessageReports": messageReports})
 }
 
 func (s *Server) AcceptReportHandler(w http.ResponseWriter, r *http.Request) {
@@ -140,11 +146,28 @@ func (s *Server) AcceptReportHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	r.ParseForm()
 	postid := r.FormValue("postid")
-	err := s.db.DeletePost(postid)
+	_, err := s.db.Trash(models.TRASH_POST, postid, s.getUser(r).UserId)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	if reportId := r.FormValue("reportid"); reportId != "" {
+		err = s.db.UpdateReportStatus(reportId, "accepted")
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		reports, err := s.db.GetReports()
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, report := range reports {
+			if report.ReportId == reportId {
+				s.awardBadges(report.UserId)
+			}
+		}
+	}
 	http.Redirect(w, r, "../adminPanel/reports", http.StatusSeeOther)
 }
 
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"fmt"
+	"forum-go/internal/models"
+	"forum-go/internal/storage"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Most images a post can show
+	maxAttachments = 10
+	// Longest caption of an image, in characters
+	maxCaptionLength = 200
+	// Largest request of the forms uploading images
+	maxImagesRequestSize = 64 * 1024 * 1024
+)
+
+func (s *Server) PostAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	// PostAttachmentsHandler adds uploaded images at the end of the gallery of a post
+	post, ok := s.editablePost(w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImagesRequestSize)
+	err := r.ParseMultipartForm(maxUploadSize)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusBadRequest, "Images must be smaller than 64MB in total")
+		return
+	}
+	attachments, err := s.uploadAttachments(r, post.PostId, len(post.Attachments), !post.IsPublished())
+	if err != nil {
+		s.errorHandler(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, attachment := range attachments {
+		err = s.db.AddAttachment(attachment)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	http.Redirect(w, r, "/post/"+post.PostId, http.StatusSeeOther)
+}
+
+func (s *Server) EditAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	// EditAttachmentHandler changes the caption of an image, moves it in the gallery or removes it
+	post, ok := s.editablePost(w, r)
+	if !ok {
+		return
+	}
+	attachmentId := r.PathValue("attachmentId")
+	index := -1
+	for i, attachment := range post.Attachments {
+		if attachment.AttachmentId == attachmentId {
+			index = i
+		}
+	}
+	if index < 0 {
+		s.errorHandler(w, r, http.StatusNotFound, "Image not found")
+		return
+	}
+	attachment := post.Attachments[index]
+	var err error
+	switch r.FormValue("action") {
+	case "caption":
+		caption := strings.TrimSpace(r.FormValue("caption"))
+		if utf8.RuneCountInString(caption) > maxCaptionLength {
+			s.errorHandler(w, r, http.StatusBadRequest, fmt.Sprintf("Caption must be at most %d characters long", maxCaptionLength))
+			return
+		}
+		err = s.db.EditAttachmentCaption(attachmentId, caption)
+	case "up", "down":
+		target := index - 1
+		if r.FormValue("action") == "down" {
+			target = index + 1
+		}
+		if target < 0 || target >= len(post.Attachments) {
+			break
+		}
+		post.Attachments[index], post.Attachments[target] = post.Attachments[target], post.Attachments[index]
+		err = s.db.ReorderAttachments(post.PostId, attachmentIds(post.Attachments))
+	case "remove":
+		err = s.db.DeleteAttachment(attachmentId)
+		if err == nil {
+			s.releaseImage(attachment.ImageURL)
+			post.Attachments = append(post.Attachments[:index], post.Attachments[index+1:]...)
+			err = s.db.ReorderAttachments(post.PostId, attachmentIds(post.Attachments))
+		}
+	default:
+		s.errorHandler(w, r, http.StatusBadRequest, "Unknown action")
+		return
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/post/"+post.PostId, http.StatusSeeOther)
+}
+
+func (s *Server) editablePost(w http.ResponseWriter, r *http.Request) (models.Post, bool) {
+	// Get the post of the URL, only its author and the admins can change its images
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return models.Post{}, false
+	}
+	post, err := s.db.GetPost(r.PathValue("id"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return models.Post{}, false
+	}
+	if post.PostId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return models.Post{}, false
+	}
+	user := s.getUser(r)
+	if post.UserID != user.UserId && user.Role != "admin" {
+		s.errorHandler(w, r, http.StatusForbidden, "You can't edit this post")
+		return models.Post{}, false
+	}
+	if post.Archived {
+		s.errorHandler(w, r, http.StatusForbidden, "This post is archived")
+		return models.Post{}, false
+	}
+	return post, true
+}
+
+func (s *Server) uploadAttachments(r *http.Request, postId string, existing int, private bool) ([]models.Attachment, error) {
+	// Store the images of the "file" field, their captions come in the same order in "captions".
+	// Images of drafts are private until the post is published.
+	files := r.MultipartForm.File["file"]
+	if existing+len(files) > maxAttachments {
+		return nil, fmt.Errorf("a post can show at most %d images", maxAttachments)
+	}
+	if len(files) > 0 {
+		allowed, needed, err := s.hasKarma(r, karmaImagesSetting)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("you need %d karma to post images", needed)
+		}
+	}
+	captions := r.MultipartForm.Value["captions"]
+	for _, caption := range captions {
+		if utf8.RuneCountInString(strings.TrimSpace(caption)) > maxCaptionLength {
+			return nil, fmt.Errorf("captions must be at most %d characters long", maxCaptionLength)
+		}
+	}
+	prefix := ""
+	if private {
+		prefix = storage.PrivatePrefix
+	}
+	images, err := s.storeImages(r, files, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var attachments []models.Attachment
+	for i, image := range images {
+		caption := ""
+		if i < len(captions) {
+			caption = strings.TrimSpace(captions[i])
+		}
+		attachments = append(attachments, models.NewAttachment(postId, image, caption, existing+i))
+	}
+	return attachments, nil
+}
+
+func attachmentIds(attachments []models.Attachment) []string {
+	ids := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.AttachmentId
+	}
+	return ids
+}
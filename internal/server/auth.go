@@ -23,36 +23,76 @@ func (s *Server) GetLoginHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) PostLoginHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
+	wait, err := s.loginWait(r, email)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if wait > 0 {
+		w.WriteHeader(http.StatusTooManyRequests)
+		render(w, r, "login", map[string]interface{}{"Error": "Too many failed attempts. Please try again in " + formatWait(wait) + ".", "email": email})
+		return
+	}
 	user, err := s.db.GetUser(email, password)
-	
+
 	if user.UserId == "" || err != nil || user.Provider != "local" {
+		err = s.recordLoginFailure(r, email)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 		render(w, r, "login", map[string]interface{}{"Error": "Invalid email or password. Please try again.", "email": email})
 		return
 	}
+	err = s.resetLoginFailures(r, user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 	if user.Role == "ban" {
 		render(w, r, "login", map[string]interface{}{"Error": "You are banned", "email": email})
 		return
 	}
-	userID := shared.ParseUUID(shared.GenerateUUID())
+	// Accounts with two factor authentication finish the login on /login/2fa
+	pending, err := s.startSecondFactor(w, r, user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if pending {
+		return
+	}
+	err = s.createSession(w, user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	//Creates cookie session
-	expiration := time.Now().Add(time.Hour)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// Lifetime of a session, it is not extended by activity
+const sessionDuration = time.Hour
+
+func (s *Server) createSession(w http.ResponseWriter, user models.User) error {
+	// Creates cookie session and stores it on the user
+	sessionID := shared.ParseUUID(shared.GenerateUUID())
+	expiration := time.Now().Add(sessionDuration)
 	cookie := http.Cookie{
 		Name:    s.SESSION_ID,
-		Value:   userID,
+		Value:   sessionID,
 		Expires: expiration,
 		Path:    "/",
 	}
-	user.SessionId = sql.NullString{String: userID, Valid: true}
+	user.SessionId = sql.NullString{String: sessionID, Valid: true}
 	user.SessionExpire = sql.NullTime{Time: expiration, Valid: true}
-	err = s.db.UpdateUser(user)
+	err := s.db.UpdateUser(user)
 	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-		return
+		return err
 	}
 	http.SetCookie(w, &cookie)
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	s.awardBadges(user.UserId)
+	return nil
 }
 
 func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
@@ -99,6 +139,11 @@ func (s *Server) PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	// Bots fill every field, humans never see the honeypot
+	if r.FormValue("website") != "" {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	IsUnique, _ := s.db.FindEmailUser(formData.Email)
 	if !IsUnique {
 		formData.Errors["email_used"] = "Email already used, change it"
@@ -140,6 +185,10 @@ func (s *Server) PostRegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 
 func (s *Server) DeleteUsersHandler(w http.ResponseWriter, r *http.Request) {
+	if !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
 	path := r.URL.Path
 	pathParts := strings.Split(path, "/")
 	// Check if the path matches the structure
@@ -147,7 +196,7 @@ func (s *Server) DeleteUsersHandler(w http.ResponseWriter, r *http.Request) {
 	if len(pathParts) >= 4 && pathParts[2] == "users" {
 		id = pathParts[3] // Extract user ID from the path
 	}
-	err := s.db.DeleteUser(id)
+	_, err := s.db.Trash(models.TRASH_USER, id, s.getUser(r).UserId)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"forum-go/internal/imaging"
+	"forum-go/internal/models"
+)
+
+const (
+	// Prefix of the avatar keys in the blob store
+	avatarPrefix = "avatars/"
+	// Largest avatar file accepted, uploaded or imported from a provider
+	maxAvatarSize = 5 * 1024 * 1024
+)
+
+// Sizes in pixels an avatar is stored in, from the smallest to the largest
+var avatarSizes = []int{32, 96, 256}
+
+// Painted behind the transparent parts of an avatar, the background of the forum
+var avatarBackground = color.RGBA{0x10, 0x09, 0x1b, 0xff}
+
+// Profile pictures come from claims some providers let their users set, so the client
+// only connects to public addresses, checked after name resolution and on every redirect
+var avatarClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: dialPublicOnly}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if req.URL.Scheme != "https" || len(via) >= 3 {
+			return errors.New("picture redirect refused")
+		}
+		return nil
+	},
+}
+
+// Shared address space of carrier-grade NATs, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func dialPublicOnly(network, address string, conn syscall.RawConn) error {
+	// Refuse connections to loopback, private, link-local and other internal addresses
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) || ip.To4() != nil && ip.To4()[0] == 0 {
+		return fmt.Errorf("connection to %s refused", host)
+	}
+	return nil
+}
+
+func (s *Server) AvatarHandler(w http.ResponseWriter, r *http.Request) {
+	// AvatarHandler serves the avatar of a user in the size closest to ?size, or his identicon
+	userId := r.PathValue("id")
+	size := avatarSize(r.URL.Query().Get("size"))
+	avatar, err := s.db.GetAvatar(userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// Browsers keep avatars but check them again, so a new upload shows up at once
+	w.Header().Set("Cache-Control", "public, no-cache")
+	if avatar.Version != 0 {
+		s.serveBlob(w, r, avatarKey(avatar, size))
+		return
+	}
+	etag := fmt.Sprintf(`"identicon-%d"`, size)
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, imaging.Identicon(userId, size))
+}
+
+func (s *Server) PostAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	// PostAvatarHandler replaces the avatar of the user with the uploaded image
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+1024*1024)
+	err := r.ParseMultipartForm(maxAvatarSize)
+	if err != nil {
+		s.renderProfileSettings(w, r, user, "Avatar must be smaller than 5MB")
+		return
+	}
+	file, _, err := openUpload(r, "avatar", maxAvatarSize)
+	if err != nil {
+		s.renderProfileSettings(w, r, user, "Avatar: "+err.Error())
+		return
+	}
+	defer file.Close()
+	img, _, err := imaging.Decode(file)
+	if err != nil {
+		s.renderProfileSettings(w, r, user, "Avatar: "+err.Error())
+		return
+	}
+	err = s.saveAvatar(user.UserId, img)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/settings/profile", http.StatusSeeOther)
+}
+
+func (s *Server) DeleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	// DeleteAvatarHandler removes the avatar of the user, his identicon is shown again
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userId := s.getUser(r).UserId
+	avatar, err := s.db.GetAvatar(userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = s.db.DeleteAvatar(userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.removeAvatarFiles(avatar)
+	http.Redirect(w, r, "/settings/profile", http.StatusSeeOther)
+}
+
+func (s *Server) saveAvatar(userId string, img image.Image) error {
+	// Crop the image to a square, store it in every size and drop the previous avatar.
+	// Re-encoding keeps nothing but the pixels, so EXIF data like GPS positions is removed.
+	previous, err := s.db.GetAvatar(userId)
+	if err != nil {
+		return err
+	}
+	avatar := models.Avatar{UserId: userId, Version: time.Now().UnixNano(), UpdateDate: time.Now()}
+	square := imaging.CenterCrop(img)
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		err = imaging.EncodeJPEG(&buf, imaging.Resize(square, size, size), avatarBackground, 88)
+		if err != nil {
+			return err
+		}
+		err = s.blobs.Put(context.Background(), avatarKey(avatar, size), buf.Bytes(), "image/jpeg")
+		if err != nil {
+			s.removeAvatarFiles(avatar)
+			return err
+		}
+	}
+	err = s.db.SaveAvatar(avatar)
+	if err != nil {
+		s.removeAvatarFiles(avatar)
+		return err
+	}
+	s.removeAvatarFiles(previous)
+	return nil
+}
+
+func (s *Server) importAvatar(userId, pictureURL string) {
+	// Use the profile picture of a provider as avatar, failures only cost the user his picture
+	if pictureURL == "" {
+		return
+	}
+	err := s.fetchAvatar(userId, pictureURL)
+	if err != nil {
+		log.Printf("Failed to import avatar from %s: %v\n", pictureURL, err)
+	}
+}
+
+func (s *Server) fetchAvatar(userId, pictureURL string) error {
+	u, err := url.Parse(pictureURL)
+	if err != nil || u.Scheme != "https" {
+		return errors.New("picture must be an https URL")
+	}
+	resp, err := avatarClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAvatarSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxAvatarSize {
+		return errors.New("picture is too large")
+	}
+	img, _, err := imaging.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return s.saveAvatar(userId, img)
+}
+
+func avatarSize(value string) int {
+	// Smallest stored size at least as large as the one asked for
+	size, _ := strconv.Atoi(value)
+	for _, s := range avatarSizes {
+		if s >= size {
+			return s
+		}
+	}
+	return avatarSizes[len(avatarSizes)-1]
+}
+
+func avatarKey(avatar models.Avatar, size int) string {
+	return fmt.Sprintf("%s%s-%d-%d.jpg", avatarPrefix, avatar.UserId, avatar.Version, size)
+}
+
+func (s *Server) removeAvatarFiles(avatar models.Avatar) {
+	// Failures leave orphans behind, the blob collector deletes them later
+	if avatar.Version == 0 {
+		return
+	}
+	for _, size := range avatarSizes {
+		err := s.blobs.Delete(context.Background(), avatarKey(avatar, size))
+		if err != nil {
+			log.Printf("Failed to delete avatar: %v\n", err)
+		}
+	}
+}
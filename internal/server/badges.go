@@ -0,0 +1,183 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum-go/internal/models"
+)
+
+const (
+	// Likes received earning the likes badge
+	likesBadgeThreshold = 100
+	// Longest name and description of a badge
+	maxBadgeName        = 50
+	maxBadgeDescription = 200
+)
+
+// badgeRule is a badge the forum awards by itself to the users meeting its condition
+type badgeRule struct {
+	code, name, description string
+	earned                  func(user models.User, stats models.BadgeStats, now time.Time) bool
+}
+
+var badgeRules = []badgeRule{
+	{"firstPost", "First post", "Published a first post", func(user models.User, stats models.BadgeStats, now time.Time) bool {
+		return stats.Posts >= 1
+	}},
+	{"likes100", "Appreciated", "Received " + strconv.Itoa(likesBadgeThreshold) + " likes on posts and comments", func(user models.User, stats models.BadgeStats, now time.Time) bool {
+		return stats.LikesReceived >= likesBadgeThreshold
+	}},
+	{"member1y", "Veteran", "Member for one year", func(user models.User, stats models.BadgeStats, now time.Time) bool {
+		return !user.CreationDate.AddDate(1, 0, 0).After(now)
+	}},
+	{"acceptedReport", "Watchful", "Made a report the admins accepted", func(user models.User, stats models.BadgeStats, now time.Time) bool {
+		return stats.AcceptedReports >= 1
+	}},
+	{"moderator", "Moderator", "Became a moderator", func(user models.User, stats models.BadgeStats, now time.Time) bool {
+		return stats.AcceptedRequests >= 1
+	}},
+}
+
+func (s *Server) ensureBadges() error {
+	// Create the badges of the rules the database doesn't hold yet
+	for _, rule := range badgeRules {
+		err := s.db.EnsureBadge(models.NewBadge(rule.code, rule.name, rule.description))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) awardBadges(userId string) {
+	// Evaluate the rules of the badges after an event of a user, awarding the badges he now deserves
+	err := s.checkBadges(userId, time.Now())
+	if err != nil {
+		log.Printf("Failed to award badges: %v\n", err)
+	}
+}
+
+func (s *Server) checkBadges(userId string, now time.Time) error {
+	// Award the badges of the rules a user meets at a time and doesn't hold yet
+	user, err := s.db.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	stats, err := s.db.GetBadgeStats(userId)
+	if err != nil {
+		return err
+	}
+	held, err := s.db.GetUserBadges(userId)
+	if err != nil {
+		return err
+	}
+	badges, err := s.db.GetBadges()
+	if err != nil {
+		return err
+	}
+	owned := map[string]bool{}
+	for _, badge := range held {
+		owned[badge.Code] = true
+	}
+	for _, rule := range badgeRules {
+		if owned[rule.code] || !rule.earned(user, stats, now) {
+			continue
+		}
+		for _, badge := range badges {
+			if badge.Code == rule.code {
+				_, err = s.giveBadge(userId, badge, "")
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) giveBadge(userId string, badge models.Badge, awardedBy string) (bool, error) {
+	// Award a badge and tell its new holder in his activity, false when he already had it
+	awarded, err := s.db.AwardBadge(userId, badge.BadgeId, awardedBy)
+	if err != nil || !awarded {
+		return false, err
+	}
+	return true, s.db.CreateActivity(models.NewActivity(userId, userId, string(models.BADGE_AWARDED), "", "", badge.Name))
+}
+
+func (s *Server) PostBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	// PostBadgeHandler creates a badge the admins award by hand
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	description := strings.TrimSpace(r.FormValue("description"))
+	if name == "" || utf8.RuneCountInString(name) > maxBadgeName {
+		s.errorHandler(w, r, http.StatusBadRequest, "A badge name is between 1 and "+strconv.Itoa(maxBadgeName)+" characters")
+		return
+	}
+	if utf8.RuneCountInString(description) > maxBadgeDescription {
+		s.errorHandler(w, r, http.StatusBadRequest, "A badge description is at most "+strconv.Itoa(maxBadgeDescription)+" characters")
+		return
+	}
+	badges, err := s.db.GetBadges()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, badge := range badges {
+		if strings.EqualFold(badge.Name, name) {
+			s.errorHandler(w, r, http.StatusConflict, "A badge with this name already exists")
+			return
+		}
+	}
+	err = s.db.AddBadge(models.NewBadge("", name, description))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
+
+func (s *Server) AwardBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	// AwardBadgeHandler gives a badge created by the admins to a user
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	badges, err := s.db.GetBadges()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	badge := models.Badge{}
+	for _, b := range badges {
+		if b.BadgeId == r.FormValue("badge_id") && b.Code == "" {
+			badge = b
+		}
+	}
+	if badge.BadgeId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Badge not found")
+		return
+	}
+	user, err := s.db.FindUserByUsername(strings.TrimSpace(r.FormValue("username")))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+	awarded, err := s.giveBadge(user.UserId, badge, s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !awarded {
+		s.errorHandler(w, r, http.StatusConflict, user.Username+" already has this badge")
+		return
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"forum-go/internal/storage"
+)
+
+const (
+	// Blobs younger than this are never collected, their post may still be being created
+	orphanGracePeriod = time.Hour
+	// Time between two runs of the orphan collector
+	orphanCollectInterval = 6 * time.Hour
+	// Lifetime of the signed URLs showing the images of a draft to its author
+	draftImageExpiry = time.Hour
+)
+
+func (s *Server) UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	// UploadsHandler serves the public blobs, their names change with their content so they are cached for good
+	key := r.PathValue("key")
+	if strings.HasPrefix(key, storage.PrivatePrefix) {
+		s.errorHandler(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	s.serveBlob(w, r, key)
+}
+
+func (s *Server) SignedBlobHandler(w http.ResponseWriter, r *http.Request) {
+	// SignedBlobHandler serves the blobs of the local store through the URLs it signed
+	local, ok := s.blobs.(*storage.Local)
+	key := r.PathValue("key")
+	query := r.URL.Query()
+	if !ok || !local.Verify(key, query.Get("expires"), query.Get("signature"), time.Now()) {
+		s.errorHandler(w, r, http.StatusForbidden, "This link is invalid or has expired")
+		return
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	s.serveBlob(w, r, key)
+}
+
+func (s *Server) serveBlob(w http.ResponseWriter, r *http.Request, key string) {
+	// Copy a blob to the response, files of the local store also answer range and conditional requests
+	body, object, err := s.blobs.Get(r.Context(), key)
+	if err == storage.ErrNotFound || err == storage.ErrInvalidKey {
+		s.errorHandler(w, r, http.StatusNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer body.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, object.ModTime, seeker)
+		return
+	}
+	if !object.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if object.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
+	io.Copy(w, body)
+}
+
+func hideUploads(next http.Handler) http.Handler {
+	// The local store lives in the assets folder, its files are only served by UploadsHandler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(path.Clean(r.URL.Path), "/assets/img/uploads/") {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) collectOrphansPeriodically() {
+	// Run the orphan collector for the whole life of the server
+	for {
+		deleted, err := s.collectOrphans(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("Failed to collect orphaned files: %v\n", err)
+		} else if deleted > 0 {
+			log.Printf("Deleted %d orphaned files\n", deleted)
+		}
+		time.Sleep(orphanCollectInterval)
+	}
+}
+
+func (s *Server) collectOrphans(ctx context.Context, now time.Time) (int, error) {
+	// Delete the blobs no post or avatar points to anymore, left behind by
+	// deleted posts and users or by uploads whose post was never created.
+	used := map[string]bool{}
+	imageURLs, err := s.db.GetImageURLs()
+	if err != nil {
+		return 0, err
+	}
+	for _, imageURL := range imageURLs {
+		used[imageURL] = true
+		used[thumbnailName(imageURL)] = true
+	}
+	avatars, err := s.db.GetAvatars()
+	if err != nil {
+		return 0, err
+	}
+	for _, avatar := range avatars {
+		for _, size := range avatarSizes {
+			used[avatarKey(avatar, size)] = true
+		}
+	}
+	objects, err := s.blobs.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, object := range objects {
+		if used[object.Key] || now.Sub(object.ModTime) < orphanGracePeriod {
+			continue
+		}
+		err = s.blobs.Delete(ctx, object.Key)
+		if err != nil {
+			return deleted, err
+		}
+		s.thumbnails.Delete(object.Key)
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+
+	"forum-go/internal/models"
+)
+
+func (s *Server) hiddenUsers(r *http.Request) (map[string]bool, error) {
+	// The users blocked or muted by the logged in user, their content is kept out of his feeds and threads
+	hidden := map[string]bool{}
+	if !s.isLoggedIn(r) {
+		return hidden, nil
+	}
+	blocks, err := s.db.GetBlocks(s.getUser(r).UserId)
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		hidden[block.TargetId] = true
+	}
+	return hidden, nil
+}
+
+func withoutHiddenPosts(posts []models.Post, hidden map[string]bool) []models.Post {
+	// The posts whose author is not hidden
+	kept := []models.Post{}
+	for _, post := range posts {
+		if !hidden[post.UserID] {
+			kept = append(kept, post)
+		}
+	}
+	return kept
+}
+
+func withoutHiddenComments(comments []models.Comment, hidden map[string]bool) []models.Comment {
+	// The comments whose author is not hidden
+	kept := []models.Comment{}
+	for _, comment := range comments {
+		if !hidden[comment.UserID] {
+			kept = append(kept, comment)
+		}
+	}
+	return kept
+}
+
+func (s *Server) blockedByAuthor(w http.ResponseWriter, r *http.Request, postId, userId string) bool {
+	// Check the author of a post blocked a user, answering 403 when he did
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	blocked, err := s.db.IsBlocked(post.UserID, userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return true
+	}
+	if blocked {
+		s.errorHandler(w, r, http.StatusForbidden, "The author of this post has blocked you")
+		return true
+	}
+	return false
+}
+
+func (s *Server) BlocksHandler(w http.ResponseWriter, r *http.Request) {
+	// BlocksHandler handles the page listing the users blocked or muted by the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderBlocks(w, r, "")
+}
+
+func (s *Server) PostBlockHandler(w http.ResponseWriter, r *http.Request) {
+	// PostBlockHandler blocks or mutes a user for the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	kind := r.FormValue("kind")
+	if kind != models.BLOCK_BLOCK && kind != models.BLOCK_MUTE {
+		s.errorHandler(w, r, http.StatusBadRequest, "Unknown block kind")
+		return
+	}
+	target, err := s.db.FindUserByUsername(r.FormValue("username"))
+	if err == sql.ErrNoRows {
+		s.renderBlocks(w, r, "User not found")
+		return
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	user := s.getUser(r)
+	if target.UserId == user.UserId {
+		s.renderBlocks(w, r, "You can't block or mute yourself")
+		return
+	}
+	err = s.db.AddBlock(models.NewBlock(user.UserId, target.UserId, kind))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/settings/blocks"
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) DeleteBlockHandler(w http.ResponseWriter, r *http.Request) {
+	// DeleteBlockHandler unblocks or unmutes a user for the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	removed, err := s.db.RemoveBlock(s.getUser(r).UserId, r.FormValue("target_id"), r.FormValue("kind"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !removed {
+		s.errorHandler(w, r, http.StatusNotFound, "This user is not blocked or muted")
+		return
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/settings/blocks"
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) renderBlocks(w http.ResponseWriter, r *http.Request, errMsg string) {
+	// Render the blocked and muted users of the logged in user
+	blocks, err := s.db.GetBlocks(s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	blocked := []models.Block{}
+	muted := []models.Block{}
+	for _, block := range blocks {
+		if block.Kind == models.BLOCK_BLOCK {
+			blocked = append(blocked, block)
+		} else {
+			muted = append(muted, block)
+		}
+	}
+	render(w, r, "blocks", map[string]interface{}{"Blocked": blocked, "Muted": muted, "Error": errMsg})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"forum-go/internal/models"
+)
+
+// Longest name of a bookmark folder
+const maxFolderName = 50
+
+func (s *Server) ownFolder(w http.ResponseWriter, r *http.Request, folderId string) bool {
+	// Check a folder belongs to the logged in user, answering 400 when it does not. An empty id means no folder.
+	if folderId == "" {
+		return true
+	}
+	folders, err := s.db.GetBookmarkFolders(s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	for _, folder := range folders {
+		if folder.FolderId == folderId {
+			return true
+		}
+	}
+	s.errorHandler(w, r, http.StatusBadRequest, "Folder not found")
+	return false
+}
+
+func markBookmarks(posts []models.Post, bookmarks []models.Bookmark) {
+	// Flag the posts and comments a user saved
+	saved := map[string]bool{}
+	for _, bookmark := range bookmarks {
+		saved[bookmark.PostId+"/"+bookmark.CommentId] = true
+	}
+	for i := range posts {
+		posts[i].IsBookmarked = saved[posts[i].PostId+"/"]
+		for j := range posts[i].Comments {
+			posts[i].Comments[j].IsBookmarked = saved[posts[i].PostId+"/"+posts[i].Comments[j].CommentId]
+		}
+	}
+}
+
+func savedContent(posts []models.Post, bookmarks []models.Bookmark, folderId string) ([]models.Post, []models.Comment) {
+	// The posts and comments saved in a folder, or everywhere when the folder id is empty, last saved first
+	byId := map[string]models.Post{}
+	for _, post := range posts {
+		byId[post.PostId] = post
+	}
+	savedPosts := []models.Post{}
+	savedComments := []models.Comment{}
+	for _, bookmark := range bookmarks {
+		if folderId != "" && bookmark.FolderId != folderId {
+			continue
+		}
+		if bookmark.CommentId != "" {
+			savedComments = append(savedComments, bookmark.Comment)
+		} else if post, ok := byId[bookmark.PostId]; ok {
+			savedPosts = append(savedPosts, post)
+		}
+	}
+	return savedPosts, savedComments
+}
+
+func (s *Server) BookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	// BookmarkHandler saves a post or a comment for the logged in user, or unsaves it when it already was
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	postId := r.FormValue("post_id")
+	commentId := r.FormValue("comment_id")
+	folderId := r.FormValue("folder_id")
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if post.PostId == "" || !post.IsPublished() {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	}
+	if commentId != "" {
+		found := false
+		for _, comment := range post.Comments {
+			if comment.CommentId == commentId && !comment.DeletionDate.Valid {
+				found = true
+				break
+			}
+		}
+		if !found {
+			s.errorHandler(w, r, http.StatusNotFound, "Comment not found")
+			return
+		}
+	}
+	userId := s.getUser(r).UserId
+	removed, err := s.db.DeleteBookmark(userId, postId, commentId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !removed {
+		if !s.ownFolder(w, r, folderId) {
+			return
+		}
+		err = s.db.AddBookmark(models.NewBookmark(userId, postId, commentId, folderId))
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/post/" + postId
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) MoveBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	// MoveBookmarkHandler puts a saved post or comment in another folder of the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	folderId := r.FormValue("folder_id")
+	if !s.ownFolder(w, r, folderId) {
+		return
+	}
+	moved, err := s.db.MoveBookmark(s.getUser(r).UserId, r.FormValue("post_id"), r.FormValue("comment_id"), folderId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !moved {
+		s.errorHandler(w, r, http.StatusNotFound, "Bookmark not found")
+		return
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/saved"
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) PostBookmarkFolderHandler(w http.ResponseWriter, r *http.Request) {
+	// PostBookmarkFolderHandler creates a bookmark folder for the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxFolderName {
+		s.errorHandler(w, r, http.StatusBadRequest, "A folder name is between 1 and 50 characters")
+		return
+	}
+	userId := s.getUser(r).UserId
+	folders, err := s.db.GetBookmarkFolders(userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, folder := range folders {
+		if strings.EqualFold(folder.Name, name) {
+			s.errorHandler(w, r, http.StatusBadRequest, "You already have a folder with this name")
+			return
+		}
+	}
+	folder := models.NewBookmarkFolder(userId, name)
+	err = s.db.AddBookmarkFolder(folder)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/saved?folder="+folder.FolderId, http.StatusSeeOther)
+}
+
+func (s *Server) DeleteBookmarkFolderHandler(w http.ResponseWriter, r *http.Request) {
+	// DeleteBookmarkFolderHandler deletes a bookmark folder of the logged in user, what it held stays saved
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	deleted, err := s.db.DeleteBookmarkFolder(s.getUser(r).UserId, r.FormValue("folder_id"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !deleted {
+		s.errorHandler(w, r, http.StatusNotFound, "Folder not found")
+		return
+	}
+	http.Redirect(w, r, "/saved", http.StatusSeeOther)
+}
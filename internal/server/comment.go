@@ -10,6 +10,10 @@ import (
 // Implement function : retrieve form values and call AddCommet function in database/comment.go
 // Add model instance
 func (s *Server) PostCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	type CommentData struct {
 		Content string
 		UserID  string
@@ -19,6 +23,7 @@ func (s *Server) PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 	commentData := CommentData{
 		Content: r.FormValue("comment"),
+		UserID:  s.getUser(r).UserId,
 		PostID:  r.FormValue("PostId"),
 		Errors:  make(map[string]string),
 	}
@@ -26,6 +31,12 @@ func (s *Server) PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if ValidateCommentChar(commentData.Content) {
 		commentData.Errors["Comment"] = "Comments must have a maximum of 400 characters"
 	}
+	if !s.openPost(w, r, commentData.PostID) {
+		return
+	}
+	if s.blockedByAuthor(w, r, commentData.PostID, commentData.UserID) {
+		return
+	}
 	if len(commentData.Errors) > 0 {
 		post, err := s.db.GetPost(commentData.PostID)
 		if err != nil {
@@ -39,7 +50,7 @@ func (s *Server) PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 		CommentId:    shared.ParseUUID(shared.GenerateUUID()),
 		Content:      r.FormValue("comment"),
 		CreationDate: time.Now(),
-		UserID:       r.FormValue("UserId"),
+		UserID:       commentData.UserID,
 		PostID:       r.FormValue("PostId"),
 		Likes:        0,
 		Dislikes:     0,
@@ -66,6 +77,9 @@ func (s *Server) PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	newActivity := models.NewActivity(newComment.UserID, newComment.UserID, string(models.COMMENT_CREATED), newComment.PostID, newComment.CommentId, newComment.Content)
 	s.db.CreateActivity(newActivity)
+	s.notifyReferences(newComment.UserID, newComment.PostID, newComment.CommentId, newComment.Content, "")
+	s.notifySubscribers(newComment.UserID, newComment.PostID, nil, string(models.FOLLOWED_COMMENT), newComment.CommentId, newComment.Content, post.UserID)
+	s.db.Subscribe(models.NewSubscription(newComment.UserID, newComment.PostID, ""))
 	http.Redirect(w, r, "/post/"+newComment.PostID, http.StatusSeeOther)
 }
 
@@ -108,7 +122,7 @@ func (s *Server) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if !isPresent {
+	if !isPresent || SelectedComment.DeletionDate.Valid {
 		s.errorHandler(w, r, http.StatusBadRequest, "Comment not found")
 		return
 	}
@@ -116,7 +130,7 @@ func (s *Server) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		s.errorHandler(w, r, http.StatusForbidden, "You are not allowed to delete this comment")
 		return
 	}
-	err := s.db.DeleteComment(CommentID)
+	_, err := s.db.Trash(models.TRASH_COMMENT, CommentID, s.getUser(r).UserId)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -150,14 +164,44 @@ func ValidateCommentChar(content string) bool {
 
 func (s *Server) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
 	// Edit a comment
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	CommentID := r.FormValue("CommentId")
 	PostId := r.FormValue("PostId")
 	UpdatedContent := r.FormValue("UpdatedContent")
 
-	err := s.db.EditComment(CommentID, UpdatedContent)
+	post, err := s.db.GetPost(PostId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if post.Archived {
+		s.errorHandler(w, r, http.StatusForbidden, "This post is archived")
+		return
+	}
+	previous := models.Comment{}
+	for _, comment := range post.Comments {
+		if comment.CommentId == CommentID {
+			previous = comment
+			break
+		}
+	}
+	if previous.CommentId == "" || previous.DeletionDate.Valid {
+		s.errorHandler(w, r, http.StatusNotFound, "Comment not found")
+		return
+	}
+	if previous.UserID != s.getUser(r).UserId && !IsAdmin(r) {
+		s.errorHandler(w, r, http.StatusForbidden, "You are not allowed to edit this comment")
+		return
+	}
+	err = s.db.EditComment(CommentID, UpdatedContent)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.markdown.Invalidate(commentCacheKey(CommentID))
+	s.notifyReferences(previous.UserID, PostId, CommentID, UpdatedContent, previous.Content)
 	http.Redirect(w, r, "/post/"+PostId, http.StatusSeeOther)
 }
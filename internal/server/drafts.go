@@ -0,0 +1,244 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"forum-go/internal/models"
+	"forum-go/internal/shared"
+)
+
+// What the buttons of the create form ask for
+const (
+	intentPublish  = "publish"
+	intentDraft    = "draft"
+	intentSchedule = "schedule"
+)
+
+const (
+	// Furthest publish date of a scheduled post
+	maxScheduleDelay = 365 * 24 * time.Hour
+	// Time between two looks for the scheduled posts to publish
+	publishInterval = time.Minute
+	// Layout of the datetime-local input of the create form
+	publishDateLayout = "2006-01-02T15:04"
+	// Biggest autosave request, a title and a full content
+	maxAutosaveSize = 16 * 1024
+)
+
+func (s *Server) ownDraft(w http.ResponseWriter, r *http.Request, draftId string) (models.Post, bool) {
+	// Get a draft of the logged in user, answering 404 when there is none
+	draft, err := s.db.GetPost(draftId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return draft, false
+	}
+	if draft.PostId == "" || draft.IsPublished() || draft.UserID != s.getUser(r).UserId {
+		s.errorHandler(w, r, http.StatusNotFound, "Draft not found")
+		return draft, false
+	}
+	return draft, true
+}
+
+func (s *Server) saveDraft(post models.Post, isNew bool, categories []models.Category, attachments []models.Attachment, poll *models.Poll, replacePoll bool) error {
+	// Store the create form without publishing it, an invalid poll keeps the one saved before
+	if isNew {
+		post.Attachments = attachments
+		if replacePoll {
+			post.Poll = poll
+		}
+		return s.db.AddPost(post, categories)
+	}
+	err := s.db.UpdateDraft(post, categories)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		err = s.db.AddAttachment(attachment)
+		if err != nil {
+			return err
+		}
+	}
+	if replacePoll {
+		return s.db.ReplacePoll(post.PostId, poll)
+	}
+	return nil
+}
+
+func (s *Server) publishPost(post models.Post, now time.Time) error {
+	// Publish a draft, its activity and notifications are only created then. It also runs
+	// in the background for scheduled posts, so it leaves s.posts to the request handlers
+	draft, err := s.db.GetPost(post.PostId)
+	if err != nil {
+		return err
+	}
+	err = s.publishImages(draft)
+	if err != nil {
+		return err
+	}
+	published, err := s.db.PublishPost(post.PostId, now)
+	if err != nil || !published {
+		return err
+	}
+	post, err = s.db.GetPost(post.PostId)
+	if err != nil {
+		return err
+	}
+	newActivity := models.NewActivity(post.UserID, post.UserID, string(models.POST_CREATED), post.PostId, "", post.Title)
+	err = s.db.CreateActivity(newActivity)
+	if err != nil {
+		return err
+	}
+	s.notifyReferences(post.UserID, post.PostId, "", post.Content, "")
+	s.notifySubscribers(post.UserID, post.PostId, post.Categories, string(models.FOLLOWED_POST), "", post.Title)
+	s.awardBadges(post.UserID)
+	return nil
+}
+
+func (s *Server) DraftsHandler(w http.ResponseWriter, r *http.Request) {
+	// DraftsHandler lists the drafts and scheduled posts of the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	drafts, err := s.db.GetDrafts(s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "drafts", map[string]interface{}{"Drafts": drafts})
+}
+
+func (s *Server) GetDraftHandler(w http.ResponseWriter, r *http.Request) {
+	// GetDraftHandler shows the create form filled with a draft
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	draft, ok := s.ownDraft(w, r, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	formData := PostFormData{
+		DraftId: draft.PostId,
+		Title:   draft.Title,
+		Content: draft.Content,
+	}
+	for _, category := range draft.Categories {
+		formData.Categories = append(formData.Categories, category.CategoryId)
+	}
+	if draft.PublishDate.Valid {
+		formData.PublishDate = draft.PublishDate.Time.Format(publishDateLayout)
+	}
+	poll, err := s.db.GetPoll(draft.PostId, "")
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if poll != nil {
+		formData.PollQuestion = poll.Question
+		formData.PollMultiple = poll.Multiple
+		for _, option := range poll.Options {
+			formData.PollOptions = append(formData.PollOptions, option.Label)
+		}
+		if poll.CloseDate.Valid {
+			formData.PollClose = poll.CloseDate.Time.Format(pollCloseLayout)
+		}
+	}
+	for i, attachment := range draft.Attachments {
+		draft.Attachments[i].ThumbnailURL = s.draftImageURL(attachment.ImageURL)
+	}
+	render(w, r, "createPost", map[string]interface{}{
+		"FormData":    formData,
+		"Categories":  categoryChoices(s.categories, formData.Categories),
+		"Attachments": draft.Attachments,
+	})
+}
+
+func (s *Server) AutosaveDraftHandler(w http.ResponseWriter, r *http.Request) {
+	// AutosaveDraftHandler saves the text of the create form while it is written, the draft is created on the first save
+	if !s.isLoggedIn(r) {
+		s.errorHandler(w, r, http.StatusUnauthorized, "You must be logged in to save a draft")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAutosaveSize)
+	err := r.ParseForm()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusRequestEntityTooLarge, "Draft is too long")
+		return
+	}
+	title := r.FormValue("title")
+	content := r.FormValue("content")
+	if len(content) > MaxChar {
+		s.errorHandler(w, r, http.StatusRequestEntityTooLarge, "Content is too long")
+		return
+	}
+	var categories []models.Category
+	for _, categoryID := range r.Form["categories"] {
+		for _, category := range s.categories {
+			if category.CategoryId == categoryID {
+				categories = append(categories, category)
+			}
+		}
+	}
+
+	post := models.Post{
+		Title:        title,
+		Content:      content,
+		UserID:       s.getUser(r).UserId,
+		CreationDate: time.Now(),
+		Status:       models.POST_DRAFT,
+	}
+	if draftId := r.FormValue("draft_id"); draftId != "" {
+		draft, ok := s.ownDraft(w, r, draftId)
+		if !ok {
+			return
+		}
+		post.PostId = draft.PostId
+		post.Status = draft.Status
+		post.PublishDate = draft.PublishDate
+		err = s.db.UpdateDraft(post, categories)
+	} else if title != "" || content != "" {
+		post.PostId = shared.ParseUUID(shared.GenerateUUID())
+		err = s.db.AddPost(post, categories)
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"draftId": post.PostId, "savedAt": time.Now().Format("15:04")})
+}
+
+func (s *Server) publishScheduledPeriodically() {
+	// Publish the scheduled posts for the whole life of the server
+	for {
+		err := s.publishScheduled(time.Now())
+		if err != nil {
+			log.Printf("Failed to publish scheduled posts: %v\n", err)
+		}
+		time.Sleep(publishInterval)
+	}
+}
+
+func (s *Server) publishScheduled(now time.Time) error {
+	// Publish each scheduled post whose publish date has come, a failing post doesn't hold back the others
+	posts, err := s.db.GetScheduledPosts(now)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		publishDate := now
+		if post.PublishDate.Valid {
+			publishDate = post.PublishDate.Time
+		}
+		err = s.publishPost(post, publishDate)
+		if err != nil {
+			log.Printf("Failed to publish scheduled post %s: %v\n", post.PostId, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+
+	"forum-go/internal/models"
+)
+
+// Posts shown per page of the following feed
+const feedPageSize = 10
+
+func (s *Server) followingFeed(userId string, posts []models.Post) ([]models.Post, error) {
+	// The posts of the users and categories a user follows, in the order of the home page
+	followedUsers, err := s.db.GetFollowedUsers(userId)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := s.db.GetSubscriptions(userId)
+	if err != nil {
+		return nil, err
+	}
+	users := map[string]bool{}
+	for _, followedId := range followedUsers {
+		users[followedId] = true
+	}
+	categories := map[string]bool{}
+	for _, subscription := range subscriptions {
+		if subscription.PostId == "" {
+			categories[subscription.CategoryId] = true
+		}
+	}
+	feed := []models.Post{}
+	for _, post := range posts {
+		followed := users[post.UserID]
+		for _, category := range post.Categories {
+			followed = followed || categories[category.CategoryId]
+		}
+		if followed {
+			feed = append(feed, post)
+		}
+	}
+	return feed, nil
+}
+
+func (s *Server) followTarget(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	// Find the user of the profile to follow, answering 404 when he does not exist and 400 for the user himself
+	user, err := s.db.FindUserByUsername(r.PathValue("username"))
+	if err == sql.ErrNoRows {
+		s.errorHandler(w, r, http.StatusNotFound, "User not found")
+		return models.User{}, false
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return models.User{}, false
+	}
+	if user.UserId == s.getUser(r).UserId {
+		s.errorHandler(w, r, http.StatusBadRequest, "You can't follow yourself")
+		return models.User{}, false
+	}
+	return user, true
+}
+
+func (s *Server) FollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	// FollowUserHandler makes the logged in user follow the user of a profile
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user, ok := s.followTarget(w, r)
+	if !ok {
+		return
+	}
+	err := s.db.FollowUser(models.NewFollow(s.getUser(r).UserId, user.UserId))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/u/"+url.PathEscape(user.Username), http.StatusSeeOther)
+}
+
+func (s *Server) UnfollowUserHandler(w http.ResponseWriter, r *http.Request) {
+	// UnfollowUserHandler makes the logged in user stop following the user of a profile
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user, ok := s.followTarget(w, r)
+	if !ok {
+		return
+	}
+	unfollowed, err := s.db.UnfollowUser(s.getUser(r).UserId, user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !unfollowed {
+		s.errorHandler(w, r, http.StatusNotFound, "You don't follow this user")
+		return
+	}
+	http.Redirect(w, r, "/u/"+url.PathEscape(user.Username), http.StatusSeeOther)
+}
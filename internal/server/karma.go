@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	// Settings holding the karma given by each kind of vote, dislikes take it away
+	karmaPostLikeSetting       = "karmaPostLike"
+	karmaPostDislikeSetting    = "karmaPostDislike"
+	karmaCommentLikeSetting    = "karmaCommentLike"
+	karmaCommentDislikeSetting = "karmaCommentDislike"
+	// Settings holding the karma needed to dislike, to post images and to create polls
+	karmaDislikeSetting = "karmaToDislike"
+	karmaImagesSetting  = "karmaToPostImages"
+	karmaPollsSetting   = "karmaToCreatePolls"
+	// Largest weight and threshold an admin can choose
+	maxKarmaWeight    = 100
+	maxKarmaThreshold = 100000
+)
+
+// karmaSettings are the weights then the thresholds of the karma, with the value used while no admin has chosen one
+var karmaSettings = []struct {
+	key               string
+	defaultValue, max int
+}{
+	{karmaPostLikeSetting, 1, maxKarmaWeight},
+	{karmaPostDislikeSetting, 1, maxKarmaWeight},
+	{karmaCommentLikeSetting, 1, maxKarmaWeight},
+	{karmaCommentDislikeSetting, 1, maxKarmaWeight},
+	{karmaDislikeSetting, 0, maxKarmaThreshold},
+	{karmaImagesSetting, 0, maxKarmaThreshold},
+	{karmaPollsSetting, 0, maxKarmaThreshold},
+}
+
+func (s *Server) karmaSetting(key string) (int, error) {
+	// Value of a karma setting, its default while it is unset or invalid
+	for _, setting := range karmaSettings {
+		if setting.key != key {
+			continue
+		}
+		value, err := s.db.GetSetting(key)
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > setting.max {
+			return setting.defaultValue, nil
+		}
+		return n, nil
+	}
+	return 0, nil
+}
+
+func (s *Server) karmaValues() (map[string]int, error) {
+	// Every karma setting by key, as shown in the admin panel
+	values := map[string]int{}
+	for _, setting := range karmaSettings {
+		value, err := s.karmaSetting(setting.key)
+		if err != nil {
+			return nil, err
+		}
+		values[setting.key] = value
+	}
+	return values, nil
+}
+
+func (s *Server) voteKarma(isComment, isLike bool) (int, error) {
+	// Karma a like or a dislike gives to the author of a post or a comment
+	key := karmaPostLikeSetting
+	switch {
+	case isComment && isLike:
+		key = karmaCommentLikeSetting
+	case isComment:
+		key = karmaCommentDislikeSetting
+	case !isLike:
+		key = karmaPostDislikeSetting
+	}
+	weight, err := s.karmaSetting(key)
+	if !isLike {
+		weight = -weight
+	}
+	return weight, err
+}
+
+func (s *Server) hasKarma(r *http.Request, key string) (bool, int, error) {
+	// Check the logged in user has the karma a privilege needs, admins and moderators always have it
+	needed, err := s.karmaSetting(key)
+	if err != nil {
+		return false, 0, err
+	}
+	if needed == 0 || IsAdmin(r) || IsModerator(r) {
+		return true, needed, nil
+	}
+	karma, err := s.db.GetKarma(s.getUser(r).UserId)
+	if err != nil {
+		return false, needed, err
+	}
+	return karma.Total >= needed, needed, nil
+}
+
+func (s *Server) PostKarmaSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// PostKarmaSettingsHandler sets the karma given by the votes and the karma unlocking each privilege
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	values := map[string]int{}
+	for _, setting := range karmaSettings {
+		n, err := strconv.Atoi(r.FormValue(setting.key))
+		if err != nil || n < 0 || n > setting.max {
+			s.errorHandler(w, r, http.StatusBadRequest, "Karma settings must be between 0 and "+strconv.Itoa(setting.max))
+			return
+		}
+		values[setting.key] = n
+	}
+	for _, setting := range karmaSettings {
+		err := s.db.SetSetting(setting.key, strconv.Itoa(values[setting.key]))
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
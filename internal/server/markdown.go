@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"forum-go/internal/database"
+	"forum-go/internal/markdown"
+	"forum-go/internal/models"
+)
+
+// Longest content the preview renders, the biggest a post may be
+const maxPreviewLength = MaxChar
+
+func postCacheKey(postId string) string {
+	return "post:" + postId
+}
+
+func commentCacheKey(commentId string) string {
+	return "comment:" + commentId
+}
+
+// references looks up the @mentions and #post links of the contents
+type references struct {
+	db database.Service
+}
+
+func (r references) UserExists(username string) bool {
+	user, err := r.db.FindUserByUsername(username)
+	return err == nil && user.UserId != ""
+}
+
+func (r references) FindPost(ref string) (markdown.PostCard, bool) {
+	post, err := r.db.FindPostByRef(ref)
+	if err != nil {
+		return markdown.PostCard{}, false
+	}
+	return markdown.PostCard{PostId: post.PostId, Title: post.Title, Author: post.User.Username, NbOfComments: post.NbOfComments}, true
+}
+
+func (r references) FindComment(commentId string) (markdown.CommentRef, bool) {
+	comment, err := r.db.GetComment(commentId)
+	if err != nil {
+		return markdown.CommentRef{}, false
+	}
+	return markdown.CommentRef{CommentId: comment.CommentId, PostId: comment.PostID, Author: comment.Username}, true
+}
+
+func (s *Server) notifyReferences(authorId, postId, commentId, content, previous string) {
+	// Tell the users called or quoted in a content, an edit only notifies the ones it adds
+	s.notifyMentions(authorId, postId, commentId, content, previous)
+	s.notifyQuotes(authorId, postId, commentId, content, previous)
+}
+
+func (s *Server) notifyMentions(authorId, postId, commentId, content, previous string) {
+	already := map[string]bool{}
+	for _, username := range markdown.Mentions(previous) {
+		already[username] = true
+	}
+	for _, username := range markdown.Mentions(content) {
+		if already[username] {
+			continue
+		}
+		user, err := s.db.FindUserByUsername(username)
+		if err != nil || user.UserId == "" || user.UserId == authorId {
+			continue
+		}
+		s.db.CreateActivity(models.NewActivity(user.UserId, authorId, string(models.MENTIONED), postId, commentId, content))
+	}
+}
+
+func (s *Server) notifyQuotes(authorId, postId, commentId, content, previous string) {
+	already := map[string]bool{}
+	for _, quotedId := range markdown.Quotes(previous) {
+		already[quotedId] = true
+	}
+	for _, quotedId := range markdown.Quotes(content) {
+		if already[quotedId] {
+			continue
+		}
+		quoted, err := s.db.GetComment(quotedId)
+		if err != nil || quoted.UserID == authorId {
+			continue
+		}
+		s.db.CreateActivity(models.NewActivity(quoted.UserID, authorId, string(models.QUOTED), postId, commentId, content))
+	}
+}
+
+func (s *Server) PreviewMarkdownHandler(w http.ResponseWriter, r *http.Request) {
+	// PreviewMarkdownHandler renders the content of the editor, the way it will be shown once posted
+	if !s.isLoggedIn(r) {
+		s.errorHandler(w, r, http.StatusUnauthorized, "You must be logged in to preview")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 4*maxPreviewLength)
+	content := r.FormValue("content")
+	if len(content) > maxPreviewLength {
+		s.errorHandler(w, r, http.StatusRequestEntityTooLarge, "Content is too long")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	io.WriteString(w, string(markdown.Render(content, references{s.db})))
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"sync"
+
+	"forum-go/internal/models"
+)
+
+// messageHub hands the new messages to the open inboxes of their recipients
+type messageHub struct {
+	mu sync.Mutex
+	// Channels of the event streams opened by each user, a user can have several tabs open
+	streams map[string]map[chan models.Message]bool
+}
+
+func newMessageHub() *messageHub {
+	return &messageHub{streams: map[string]map[chan models.Message]bool{}}
+}
+
+func (h *messageHub) subscribe(userId string) chan models.Message {
+	// Open a stream of the messages sent to a user
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stream := make(chan models.Message, 16)
+	if h.streams[userId] == nil {
+		h.streams[userId] = map[chan models.Message]bool{}
+	}
+	h.streams[userId][stream] = true
+	return stream
+}
+
+func (h *messageHub) unsubscribe(userId string, stream chan models.Message) {
+	// Close a stream once its connection is gone
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[userId], stream)
+	if len(h.streams[userId]) == 0 {
+		delete(h.streams, userId)
+	}
+}
+
+func (h *messageHub) publish(userId string, message models.Message) {
+	// Send a message to the streams of a user, a stream too slow to keep up misses it and gets it on reload
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for stream := range h.streams[userId] {
+		select {
+		case stream <- message:
+		default:
+		}
+	}
+}
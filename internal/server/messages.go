@@ -0,0 +1,344 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum-go/internal/models"
+)
+
+const (
+	// Longest message
+	maxMessageLength = 1000
+	// Longest reason of a message report
+	maxMessageReportReason = 50
+	// Conversations a user can start per conversationWindow
+	maxNewConversations = 5
+	conversationWindow  = time.Hour
+	// Time between two comments keeping an idle event stream open
+	messageKeepAlive = 25 * time.Second
+)
+
+// messageEvent is a new message as sent to the event stream of its recipient
+type messageEvent struct {
+	ConversationId string `json:"conversationId"`
+	MessageId      string `json:"messageId"`
+	Username       string `json:"username"`
+	Content        string `json:"content"`
+	Date           string `json:"date"`
+}
+
+func (s *Server) canMessage(w http.ResponseWriter, r *http.Request, recipient models.User) bool {
+	// Check the logged in user can write to another, answering 403 when he is banned or one of them blocked the other
+	sender := s.getUser(r)
+	if sender.Role == "ban" || recipient.Role == "ban" {
+		s.errorHandler(w, r, http.StatusForbidden, "Banned users can't send or receive messages")
+		return false
+	}
+	blocked, err := s.db.IsBlocked(recipient.UserId, sender.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if blocked {
+		s.errorHandler(w, r, http.StatusForbidden, "This user has blocked you")
+		return false
+	}
+	blocked, err = s.db.IsBlocked(sender.UserId, recipient.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if blocked {
+		s.errorHandler(w, r, http.StatusForbidden, "You have blocked this user")
+		return false
+	}
+	return true
+}
+
+func ValidateMessage(content string) (string, string) {
+	// Trim a message and check its length
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return content, "A message can't be empty"
+	}
+	if utf8.RuneCountInString(content) > maxMessageLength {
+		return content, "A message must be at most " + strconv.Itoa(maxMessageLength) + " characters long"
+	}
+	return content, ""
+}
+
+func (s *Server) sendMessage(conversationId string, sender models.User, recipientId, content string) (models.Message, error) {
+	// Save a message and push it to the open streams of its recipient
+	message := models.NewMessage(conversationId, sender.UserId, content)
+	message.Username = sender.Username
+	err := s.db.AddMessage(message)
+	if err != nil {
+		return message, err
+	}
+	s.messages.publish(recipientId, message)
+	return message, nil
+}
+
+func (s *Server) InboxHandler(w http.ResponseWriter, r *http.Request) {
+	// InboxHandler lists the conversations of the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderInbox(w, r, r.URL.Query().Get("to"), "", "")
+}
+
+func (s *Server) renderInbox(w http.ResponseWriter, r *http.Request, to, content, errMsg string) {
+	// Render the inbox, with the form starting a conversation filled with what was sent
+	conversations, err := s.db.GetConversations(s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "inbox", map[string]interface{}{"Conversations": conversations, "To": to, "Content": content, "Error": errMsg})
+}
+
+func (s *Server) PostConversationHandler(w http.ResponseWriter, r *http.Request) {
+	// PostConversationHandler sends a message to a user, starting a conversation when they have none yet
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	to := strings.TrimSpace(r.FormValue("username"))
+	content, errMsg := ValidateMessage(r.FormValue("content"))
+	if errMsg != "" {
+		s.renderInbox(w, r, to, content, errMsg)
+		return
+	}
+	recipient, err := s.db.FindUserByUsername(to)
+	if err != nil || recipient.UserId == user.UserId {
+		s.renderInbox(w, r, to, content, "User not found")
+		return
+	}
+	if !s.canMessage(w, r, recipient) {
+		return
+	}
+	conversationId, err := s.db.FindConversation(user.UserId, recipient.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conversationId == "" {
+		started, err := s.db.CountConversationsSince(user.UserId, time.Now().Add(-conversationWindow))
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if started >= maxNewConversations {
+			s.errorHandler(w, r, http.StatusTooManyRequests, "You started too many conversations, try again later")
+			return
+		}
+		conversation := models.NewConversation(user.UserId)
+		err = s.db.CreateConversation(conversation, []string{user.UserId, recipient.UserId})
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		conversationId = conversation.ConversationId
+	}
+	_, err = s.sendMessage(conversationId, user, recipient.UserId, content)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/messages/"+conversationId, http.StatusSeeOther)
+}
+
+func (s *Server) ConversationHandler(w http.ResponseWriter, r *http.Request) {
+	// ConversationHandler shows a conversation of the logged in user and marks it as read
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userId := s.getUser(r).UserId
+	conversation, err := s.db.GetConversation(r.PathValue("id"), userId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conversation.ConversationId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	err = s.db.MarkConversationRead(conversation.ConversationId, userId, time.Now())
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "conversation", map[string]interface{}{"Conversation": conversation, "MaxMessageLength": maxMessageLength})
+}
+
+func (s *Server) PostMessageHandler(w http.ResponseWriter, r *http.Request) {
+	// PostMessageHandler answers in a conversation of the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	conversation, err := s.db.GetConversation(r.PathValue("id"), user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conversation.ConversationId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Conversation not found")
+		return
+	}
+	recipient, err := s.db.GetUserById(conversation.Other.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !s.canMessage(w, r, recipient) {
+		return
+	}
+	content, errMsg := ValidateMessage(r.FormValue("content"))
+	if errMsg != "" {
+		s.errorHandler(w, r, http.StatusBadRequest, errMsg)
+		return
+	}
+	_, err = s.sendMessage(conversation.ConversationId, user, recipient.UserId, content)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/messages/"+conversation.ConversationId, http.StatusSeeOther)
+}
+
+func (s *Server) MessageEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// MessageEventsHandler streams the messages sent to the logged in user as server-sent events
+	if !s.isLoggedIn(r) {
+		s.errorHandler(w, r, http.StatusUnauthorized, "You must be logged in to get your messages")
+		return
+	}
+	controller := http.NewResponseController(w)
+	// The stream stays open past the write timeout of the server
+	err := controller.SetWriteDeadline(time.Time{})
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	userId := s.getUser(r).UserId
+	stream := s.messages.subscribe(userId)
+	defer s.messages.unsubscribe(userId, stream)
+	keepAlive := time.NewTicker(messageKeepAlive)
+	defer keepAlive.Stop()
+	fmt.Fprint(w, ": connected\n\n")
+	for {
+		if controller.Flush() != nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case message := <-stream:
+			data, err := json.Marshal(messageEvent{
+				ConversationId: message.ConversationId,
+				MessageId:      message.MessageId,
+				Username:       message.Username,
+				Content:        message.Content,
+				Date:           message.FormattedCreationDate,
+			})
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		}
+	}
+}
+
+func (s *Server) ReportMessageHandler(w http.ResponseWriter, r *http.Request) {
+	// ReportMessageHandler reports to the admins a message received by the logged in user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	userId := s.getUser(r).UserId
+	message, err := s.db.GetMessage(r.FormValue("message_id"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	conversation := models.Conversation{}
+	if message.MessageId != "" && !message.DeletionDate.Valid && message.UserId != userId {
+		conversation, err = s.db.GetConversation(message.ConversationId, userId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if conversation.ConversationId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Message not found")
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" || utf8.RuneCountInString(reason) > maxMessageReportReason {
+		s.errorHandler(w, r, http.StatusBadRequest, "A reason is between 1 and "+strconv.Itoa(maxMessageReportReason)+" characters")
+		return
+	}
+	err = s.db.ReportMessage(models.NewMessageReport(message.MessageId, userId, reason))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/messages/"+conversation.ConversationId, http.StatusSeeOther)
+}
+
+func (s *Server) AcceptMessageReportHandler(w http.ResponseWriter, r *http.Request) {
+	// AcceptMessageReportHandler removes a reported message from its conversation
+	if !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	_, err := s.db.RemoveMessage(r.FormValue("messageid"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = s.db.UpdateMessageReportStatus(r.FormValue("reportid"), "accepted")
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reports, err := s.db.GetMessageReports()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, report := range reports {
+		if report.ReportId == r.FormValue("reportid") {
+			s.awardBadges(report.UserId)
+		}
+	}
+	http.Redirect(w, r, "../adminPanel/reports", http.StatusSeeOther)
+}
+
+func (s *Server) RejectMessageReportHandler(w http.ResponseWriter, r *http.Request) {
+	// RejectMessageReportHandler keeps a reported message
+	if !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	err := s.db.UpdateMessageReportStatus(r.FormValue("reportid"), "rejected")
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "../adminPanel/reports", http.StatusSeeOther)
+}
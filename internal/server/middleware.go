@@ -7,11 +7,16 @@ import (
 
 type contextKey string
 
-const contextKeyUser = contextKey("user")
+const (
+	contextKeyUser      = contextKey("user")
+	contextKeyProviders = contextKey("providers")
+)
 
 func (s *Server) authenticate(next http.Handler) http.Handler {
 	// Implement function : retrieve cookie value and call FindUserCookie function in database/user.go
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The login providers are shown on the login and register pages
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyProviders, s.providers.List()))
 		cookie, err := r.Cookie(s.SESSION_ID)
 		if err != nil {
 			next.ServeHTTP(w, r)
@@ -34,6 +39,11 @@ func (s *Server) authenticate(next http.Handler) http.Handler {
 				user.UnreadActivities++
 			}
 		}
+		user.UnreadMessages, err = s.db.CountUnreadMessages(user.UserId)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
 		// Set the user in the request context
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
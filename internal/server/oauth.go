@@ -2,439 +2,239 @@ package server
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
+	"strings"
 	"time"
+	"unicode"
 
 	"forum-go/internal/models"
+	"forum-go/internal/oauth"
 	"forum-go/internal/shared"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-//////////////////////////////////////////////////////////////////
-///////////////////////////// GOOGLE /////////////////////////////
-//////////////////////////////////////////////////////////////////
-
-// handles the Google login process by constructing a URL for Google OAuth2 authentication. It includes
-// the client ID, redirect URL, response type, scope, and state parameters in the URL. Finally, it
-// redirects the user to this URL using an HTTP temporary redirect response.
-func (s *Server) GoogleLoginHandler(w http.ResponseWriter, r *http.Request) {
-	googleClientID := shared.GetEnv("googleClientID")
-	googleRedirectURL := shared.GetEnv("googleRedirectURL")
-
-	url := "https://accounts.google.com/o/oauth2/auth?client_id=" + googleClientID +
-		"&redirect_uri=" + googleRedirectURL +
-		"&response_type=code&scope=email%20profile&state=state"
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
-}
+const (
+	// Cookie binding a provider login to the browser that started it
+	oauthStateCookie = "oauth_state"
+	// Time given to the user to log in on the provider
+	oauthStateDuration = 10 * time.Minute
+)
 
-func (s *Server) GoogleCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	googleClientID := shared.GetEnv("googleClientID")
-	googleClientSecret := shared.GetEnv("googleClientSecret")
-	googleRedirectURL := shared.GetEnv("googleRedirectURL")
-	// Gets the authorization code from the query string
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Authorization code missing", http.StatusBadRequest)
+func (s *Server) OAuthLoginHandler(w http.ResponseWriter, r *http.Request) {
+	// OAuthLoginHandler sends the user to the login page of a provider, with a random state, nonce and PKCE verifier kept server side
+	provider, ok := s.providers.Get(r.PathValue("provider"))
+	if !ok {
+		s.errorHandler(w, r, http.StatusNotFound, "Unknown login provider")
 		return
 	}
+	s.startOAuth(w, r, provider, "")
+}
 
-	// Exchange the authorization code for an access token
-	// Making an HTTP POST request to the Google OAuth2 token endpoint to exchange an
-	// authorization code for an access token. It is sending the client ID, client secret, redirect URI,
-	// grant type, and authorization code as form data in the request.
-	tokenResp, err := http.PostForm("https://oauth2.googleapis.com/token", url.Values{
-		"client_id":     {googleClientID},
-		"client_secret": {googleClientSecret},
-		"redirect_uri":  {googleRedirectURL},
-		"grant_type":    {"authorization_code"},
-		"code":          {code},
-	})
+func (s *Server) startOAuth(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, userId string) {
+	// Redirect to the provider, userId is set when the provider is linked to a logged in user
+	state, err := newOAuthState(provider.Name, userId)
 	if err != nil {
-		http.Error(w, "Exchanging the token failed : "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer tokenResp.Body.Close()
-
-	// Check the HTTP status
-	if tokenResp.StatusCode != http.StatusOK {
-		_, _ = io.ReadAll(tokenResp.Body)
-		http.Error(w, "Error exchanging token", http.StatusInternalServerError)
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-
-	// Decode the token response
-	var tokenData map[string]interface{}
-	if err := json.NewDecoder(tokenResp.Body).Decode(&tokenData); err != nil {
-		http.Error(w, "Error parsing the token : "+err.Error(), http.StatusInternalServerError)
+	authURL, err := provider.AuthCodeURL(state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		log.Printf("OAuth login with %s failed: %v\n", provider.Name, err)
+		render(w, r, "login", map[string]interface{}{"Error": "Login with " + provider.DisplayName + " is unavailable, please try again later."})
 		return
 	}
-
-	// Verify that the access token is present
-	accessToken, ok := tokenData["access_token"]
-	if !ok || accessToken == nil {
-		http.Error(w, "Access token missing or invalid", http.StatusInternalServerError)
+	err = s.db.CreateOAuthState(state)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state.State,
+		Expires:  state.ExpireDate,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true,
+		Path:     "/auth",
+	})
+	http.Redirect(w, r, authURL, http.StatusSeeOther)
+}
 
-	accessTokenStr, ok := accessToken.(string)
+func (s *Server) OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	// OAuthCallbackHandler handles the redirection back from a provider, checks the state and logs the user in
+	provider, ok := s.providers.Get(r.PathValue("provider"))
 	if !ok {
-		http.Error(w, "Access token is not a valid string", http.StatusInternalServerError)
+		s.errorHandler(w, r, http.StatusNotFound, "Unknown login provider")
 		return
 	}
-
-	// Use the access token to fetch user information creating a new HTTP GET request
-	// to the Google OAuth2 userinfo endpoint with a nil request body. It then sets the
-	// Authorization header with the access token retrieved as a string.
-
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	if err != nil {
-		http.Error(w, "Error creating user request : "+err.Error(), http.StatusInternalServerError)
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Value: "", Expires: time.Unix(0, 0), HttpOnly: true, Secure: true, Path: "/auth"})
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		render(w, r, "login", map[string]interface{}{"Error": "Login with " + provider.DisplayName + " was cancelled."})
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+accessTokenStr)
-
-	// Create an HTTP client to send requests. An HTTP client is used to send requests to a server and receive responses.
-	// It manages the connection and handles the communication over the HTTP protocol.
-	client := &http.Client{}
-	// The Do method executes the request and returns the response or an error.
-	resp, err := client.Do(req)
-	if err != nil {
-		http.Error(w, "Error fetching user information: "+err.Error(), http.StatusInternalServerError)
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || cookie.Value != query.Get("state") {
+		render(w, r, "login", map[string]interface{}{"Error": "Your login has expired, please try again."})
 		return
 	}
-	defer resp.Body.Close()
-
-	// Check the HTTP status
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		log.Printf("Error fetching user information: %s", body)
-		http.Error(w, "Error fetching user information", http.StatusInternalServerError)
+	state, err := s.db.ConsumeOAuthState(query.Get("state"))
+	if err != nil || state.Provider != provider.Name || time.Now().After(state.ExpireDate) {
+		render(w, r, "login", map[string]interface{}{"Error": "Your login has expired, please try again."})
 		return
 	}
-
-	// Decode the user information
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		http.Error(w, "Error parsing user information : "+err.Error(), http.StatusInternalServerError)
-		log.Println("JSON error when parsing the user information :", err)
+	code := query.Get("code")
+	if code == "" {
+		s.errorHandler(w, r, http.StatusBadRequest, "Authorization code missing")
 		return
 	}
-	log.Printf("User information: %+v\n", userInfo)
-
-	// Fetch the user's email and name
-	email := userInfo["email"].(string)
-	name := userInfo["name"].(string)
-
-	// Verify that the email is unique
-	IsUnique, err := s.db.FindEmailUser(email)
+	tokens, err := provider.Exchange(code, state.CodeVerifier)
 	if err != nil {
-		http.Error(w, "Error checking the user : "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if !IsUnique {
-		// Fetch the user from the database
-		user, err := s.db.FindUserByEmail(email)
-		if err != nil {
-			http.Error(w, "Error fetching the user : "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		if user.Role == "ban" {
-			render(w, r, "login", map[string]interface{}{"Error": "You are banned", "email": email})
-			return
-		}
-		if user.Provider != "google" {
-			render(w, r, "login", map[string]interface{}{"Error": "Email already used by another provider", "email": email})
-			return
-		}
-
-		userID := shared.ParseUUID(shared.GenerateUUID())
-
-		// Create a session for the user
-		expiration := time.Now().Add(time.Hour)
-		cookie := http.Cookie{
-			Name:    s.SESSION_ID,
-			Value:   userID,
-			Expires: expiration,
-			Path:    "/",
-		}
-		user.SessionId = sql.NullString{String: userID, Valid: true}
-		user.SessionExpire = sql.NullTime{Time: expiration, Valid: true}
-		err = s.db.UpdateUser(user)
-		if err != nil {
-			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-		http.SetCookie(w, &cookie)
-		// Redirect the user to the home page
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		log.Printf("OAuth token exchange with %s failed: %v\n", provider.Name, err)
+		render(w, r, "login", map[string]interface{}{"Error": "Login with " + provider.DisplayName + " failed, please try again."})
 		return
 	}
-
-	password := shared.GenerateUUID().String()
-	// Hash the password
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	identity, err := provider.Identity(tokens, state.Nonce)
 	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		log.Printf("OAuth identity from %s rejected: %v\n", provider.Name, err)
+		render(w, r, "login", map[string]interface{}{"Error": "Login with " + provider.DisplayName + " failed, please try again."})
 		return
 	}
-
-	// Create a new user
-	user := models.User{
-		Username:     name,
-		Email:        email,
-		Password:     string(passwordHash),
-		Role:         "user",
-		CreationDate: time.Now(),
-		UserId:       shared.ParseUUID(shared.GenerateUUID()),
-		Provider:     "google",
-	}
-	err = s.db.CreateUser(user)
-	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+	if state.UserId != "" {
+		s.linkIdentity(w, r, provider, identity, state.UserId)
 		return
 	}
-	s.users = append(s.users, user)
-	userID := shared.ParseUUID(shared.GenerateUUID())
+	s.oauthLogin(w, r, provider, identity)
+}
 
-	// Create a session for the user
-	expiration := time.Now().Add(time.Hour)
-	cookie := http.Cookie{
-		Name:    s.SESSION_ID,
-		Value:   userID,
-		Expires: expiration,
-		Path:    "/",
+func (s *Server) oauthLogin(w http.ResponseWriter, r *http.Request, provider *oauth.Provider, identity oauth.Identity) {
+	// Log in the user linked to the provider account. On the first login, the account is merged
+	// with the user owning the same verified email, or created if there is none. Emails of local
+	// accounts are never verified, their owner links the provider from the account settings instead.
+	var user models.User
+	linked, err := s.db.GetIdentity(provider.Name, identity.Subject)
+	switch {
+	case err == nil:
+		user, err = s.db.GetUserById(linked.UserId)
+	case err != sql.ErrNoRows:
+	case identity.Email == "" || !identity.EmailVerified:
+		render(w, r, "login", map[string]interface{}{"Error": "Your " + provider.DisplayName + " account needs a verified email address to log in."})
+		return
+	default:
+		user, err = s.db.FindUserByEmail(identity.Email)
+		if err == nil && user.Provider == "local" {
+			render(w, r, "login", map[string]interface{}{"Error": "An account already uses this email. Log in with your password, then link your " + provider.DisplayName + " account from your account settings.", "email": user.Email})
+			return
+		} else if err == nil {
+			err = s.mergeIdentity(user, provider, identity)
+		} else if err == sql.ErrNoRows {
+			user, err = s.createOAuthUser(provider, identity)
+		}
 	}
-	user.SessionId = sql.NullString{String: userID, Valid: true}
-	user.SessionExpire = sql.NullTime{Time: expiration, Valid: true}
-	err = s.db.UpdateUser(user)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	http.SetCookie(w, &cookie)
-	// Redirect the user to the home page
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
-
-//////////////////////////////////////////////////////////////////
-///////////////////////////// GITHUB /////////////////////////////
-//////////////////////////////////////////////////////////////////
-
-// GithubLoginHandler initiates the GitHub OAuth flow.
-func (s *Server) GithubLoginHandler(w http.ResponseWriter, r *http.Request) {
-	GitHubclientID := shared.GetEnv("GitHubClientID")
-	GitHubredirectURI := shared.GetEnv("GitHubredirectURI")
-	authURL := "https://github.com/login/oauth/authorize?client_id=" + GitHubclientID +
-		"&redirect_uri=" + url.QueryEscape(GitHubredirectURI) +
-		"&scope=user:email"
-	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
-}
-
-// GithubCallbackHandler handles the callback from GitHub.
-func (s *Server) GithubCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	GitHubclientID := shared.GetEnv("GitHubClientID")
-	GitHubclientSecret := shared.GetEnv("GitHubClientSecret")
-	GitHubredirectURI := shared.GetEnv("GitHubredirectURI")
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Error(w, "Authorization code is missing", http.StatusBadRequest)
+	if user.Role == "ban" {
+		render(w, r, "login", map[string]interface{}{"Error": "You are banned", "email": user.Email})
 		return
 	}
-
-	// Exchange the authorization code for an access token
-	tokenResp, err := http.PostForm("https://github.com/login/oauth/access_token", url.Values{
-		"client_id":     {GitHubclientID},
-		"client_secret": {GitHubclientSecret},
-		"redirect_uri":  {GitHubredirectURI},
-		"code":          {code},
-	})
+	// A second factor protects the account whatever the way to log in
+	pending, err := s.startSecondFactor(w, r, user)
 	if err != nil {
-		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer tokenResp.Body.Close()
-
-	if tokenResp.StatusCode != http.StatusOK {
-		http.Error(w, "Token exchange failed", http.StatusInternalServerError)
+	if pending {
 		return
 	}
-
-	body, err := io.ReadAll(tokenResp.Body)
+	err = s.createSession(w, user)
 	if err != nil {
-		http.Error(w, "Error reading token response", http.StatusInternalServerError)
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
 
-	values, err := url.ParseQuery(string(body))
+func (s *Server) createOAuthUser(provider *oauth.Provider, identity oauth.Identity) (models.User, error) {
+	// Create the account of a provider user, with a random password as it never logs in with one
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(shared.GenerateUUID().String()), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, "Error parsing token response", http.StatusInternalServerError)
-		return
-	}
-
-	accessToken := values.Get("access_token")
-	if accessToken == "" {
-		http.Redirect(w, r, "/", http.StatusTemporaryRedirect) // Restart the OAuth flow
-		return
+		return models.User{}, err
 	}
-
-	// Fetch user information
-	req, _ := http.NewRequest("GET", "https://api.github.com/user", nil)
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		http.Error(w, "Error fetching user info", http.StatusInternalServerError)
-		return
+	name := identity.Username
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
 	}
-	defer resp.Body.Close()
-
-	var userInfo map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&userInfo); err != nil {
-		http.Error(w, "Error parsing user info", http.StatusInternalServerError)
-		return
-	}
-
-	// Extract user details
-	_, emailOk := userInfo["email"].(string)
-	username, usernameOk := userInfo["login"].(string)
-
-	if !usernameOk || username == "" {
-		http.Error(w, "Failed to retrieve username", http.StatusInternalServerError)
-		return
-	}
-	email, errMail := getMail(accessToken)
-	if (errMail != nil) && !emailOk || email == "" {
-		errMsg := fmt.Sprintf("Error occured :%s %s", email, errMail)
-		render(w, r, "login", map[string]interface{}{"Error": errMsg})
-		return
-	}
-
-	// Check if the email already exists in the database
-	IsUnique, err := s.db.FindEmailUser(email)
+	username, err := s.uniqueUsername(name)
 	if err != nil {
-		http.Error(w, "Error checking user existence", http.StatusInternalServerError)
-		return
+		return models.User{}, err
 	}
-
-	if !IsUnique {
-		user, err := s.db.FindUserByEmail(email)
-		if err != nil {
-			http.Error(w, "Error fetching user", http.StatusInternalServerError)
-			return
-		}
-
-		if user.Role == "ban" {
-			render(w, r, "login", map[string]interface{}{"Error": "You are banned", "email": email})
-			return
-		}
-		if user.Provider != "github" {
-			render(w, r, "login", map[string]interface{}{"Error": "Email already used by another provider", "email": email})
-			return
-		}
-
-		// Automatically log the user in by creating a session
-		userID := shared.ParseUUID(shared.GenerateUUID())
-		expiration := time.Now().Add(time.Hour)
-		cookie := http.Cookie{
-			Name:    s.SESSION_ID,
-			Value:   userID,
-			Expires: expiration,
-			Path:    "/",
-		}
-		user.SessionId = sql.NullString{String: userID, Valid: true}
-		user.SessionExpire = sql.NullTime{Time: expiration, Valid: true}
-		err = s.db.UpdateUser(user)
-		if err != nil {
-			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
-		http.SetCookie(w, &cookie)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-
-	// Create a new user if the email is not found
-	password := shared.GenerateUUID().String()
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
 	user := models.User{
 		Username:     username,
-		Email:        email,
+		Email:        identity.Email,
 		Password:     string(passwordHash),
 		Role:         "user",
 		CreationDate: time.Now(),
 		UserId:       shared.ParseUUID(shared.GenerateUUID()),
-		Provider:     "github",
+		Provider:     provider.Name,
 	}
 	err = s.db.CreateUser(user)
 	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// Automatically log the new user in
-	userID := user.UserId
-	expiration := time.Now().Add(time.Hour)
-	cookie := http.Cookie{
-		Name:    s.SESSION_ID,
-		Value:   userID,
-		Expires: expiration,
-		Path:    "/",
-	}
-	user.SessionId = sql.NullString{String: userID, Valid: true}
-	user.SessionExpire = sql.NullTime{Time: expiration, Valid: true}
-	err = s.db.UpdateUser(user)
-	if err != nil {
-		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
-		return
+		return models.User{}, err
 	}
-	http.SetCookie(w, &cookie)
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	s.users = append(s.users, user)
+	s.importAvatar(user.UserId, identity.Picture)
+	return user, s.db.CreateIdentity(models.NewUserIdentity(user.UserId, provider.Name, identity.Subject, identity.Email))
 }
 
-// getMail retrieves the user's primary email from GitHub.
-func getMail(accessToken string) (string, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-	if err != nil {
-		return "", err
+func (s *Server) uniqueUsername(name string) (string, error) {
+	// Turn a provider name into a free username following the register rules: 3 to 20 alphanumeric characters
+	var b strings.Builder
+	for _, r := range name {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	base := b.String()
+	if len(base) > 16 {
+		base = base[:16]
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch emails")
+	if len(base) < 3 {
+		base = "user" + base
 	}
-
-	var emails []map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", err
+	username := base
+	for i := 2; ; i++ {
+		isUnique, err := s.db.FindUsername(username)
+		if err != nil {
+			return "", err
+		}
+		if isUnique {
+			return username, nil
+		}
+		username = base + fmt.Sprint(i)
 	}
+}
 
-	for _, email := range emails {
-		if primary, ok := email["primary"].(bool); ok && primary {
-			if emailAddr, ok := email["email"].(string); ok {
-				return emailAddr, nil
-			}
+func newOAuthState(provider, userId string) (models.OAuthState, error) {
+	// Generate the random values protecting a provider login
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oauth.RandomString()
+		if err != nil {
+			return models.OAuthState{}, err
 		}
-	}
-	return "", fmt.Errorf("no primary email found")
+		values[i] = value
+	}
+	return models.OAuthState{
+		State:        values[0],
+		Provider:     provider,
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		ExpireDate:   time.Now().Add(oauthStateDuration),
+		UserId:       userId,
+	}, nil
 }
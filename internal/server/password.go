@@ -0,0 +1,216 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"forum-go/internal/models"
+	"forum-go/internal/shared"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Lifetime of a password reset link
+const resetTokenDuration = time.Hour
+
+func (s *Server) GetForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// GetForgotPasswordHandler handles the forgot password page
+	if s.isLoggedIn(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	render(w, r, "forgotPassword", nil)
+}
+
+func (s *Server) PostForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// PostForgotPasswordHandler sends a reset link to the email if it belongs to a local account.
+	// The same message is rendered in every case so the form can't be used to find registered emails.
+	email := r.FormValue("email")
+	message := "If an account exists for this email, a reset link has been sent."
+	user, err := s.db.FindUserByEmail(email)
+	if err != nil || user.Provider != "local" || user.Role == "ban" {
+		render(w, r, "forgotPassword", map[string]interface{}{"Message": message})
+		return
+	}
+	token, err := generateToken()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reset := models.NewPasswordReset(user.UserId, hashToken(token), time.Now().Add(resetTokenDuration))
+	err = s.db.CreatePasswordReset(reset)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	link := baseURL() + "/password/reset?token=" + token
+	body := "Hello " + user.Username + ",\n\nTo choose a new password for your Aniverse account, open this link within the next hour:\n" + link + "\n\nIf you didn't ask for a new password, you can ignore this email."
+	err = shared.SendMail(user.Email, "Reset your Aniverse password", body)
+	if err != nil {
+		log.Printf("Failed to send reset email: %v\n", err)
+	}
+	render(w, r, "forgotPassword", map[string]interface{}{"Message": message})
+}
+
+func (s *Server) GetResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// GetResetPasswordHandler handles the reset password page reached from the email link
+	token := r.URL.Query().Get("token")
+	if _, err := s.validResetToken(token); err != "" {
+		render(w, r, "resetPassword", map[string]interface{}{"Error": err})
+		return
+	}
+	render(w, r, "resetPassword", map[string]interface{}{"Token": token})
+}
+
+func (s *Server) PostResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// PostResetPasswordHandler sets the new password and consumes the reset token
+	token := r.FormValue("token")
+	reset, errMsg := s.validResetToken(token)
+	if errMsg != "" {
+		render(w, r, "resetPassword", map[string]interface{}{"Error": errMsg})
+		return
+	}
+	password := r.FormValue("password")
+	if errMsg := ValidateNewPassword(password, r.FormValue("Confirmpassword")); errMsg != "" {
+		render(w, r, "resetPassword", map[string]interface{}{"Token": token, "Error": errMsg})
+		return
+	}
+	// Consuming the token is the check that counts, two requests racing with the same link can't both win
+	used, err := s.db.UsePasswordReset(reset.ResetId, time.Now())
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !used {
+		render(w, r, "resetPassword", map[string]interface{}{"Error": "This reset link is invalid or has expired"})
+		return
+	}
+	err = s.setPassword(reset.UserId, password)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "login", map[string]interface{}{"Success": "Your password has been changed, you can now log in."})
+}
+
+func (s *Server) GetChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// GetChangePasswordHandler handles the change password page
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if s.getUser(r).Provider != "local" {
+		s.errorHandler(w, r, http.StatusForbidden, "Your password is managed by "+s.getUser(r).Provider)
+		return
+	}
+	render(w, r, "changePassword", nil)
+}
+
+func (s *Server) PostChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	// PostChangePasswordHandler checks the old password, sets the new one and logs the user out everywhere
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	if user.Provider != "local" {
+		s.errorHandler(w, r, http.StatusForbidden, "Your password is managed by "+user.Provider)
+		return
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(r.FormValue("oldPassword")))
+	if err != nil {
+		render(w, r, "changePassword", map[string]interface{}{"Error": "Current password is incorrect"})
+		return
+	}
+	password := r.FormValue("password")
+	if errMsg := ValidateNewPassword(password, r.FormValue("Confirmpassword")); errMsg != "" {
+		render(w, r, "changePassword", map[string]interface{}{"Error": errMsg})
+		return
+	}
+	err = s.setPassword(user.UserId, password)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The session has been invalidated in database, remove the cookie too
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.SESSION_ID,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true,
+		Path:     "/",
+	})
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+func (s *Server) validResetToken(token string) (models.PasswordReset, string) {
+	// Check that a reset token exists, has not been used and has not expired
+	if token == "" {
+		return models.PasswordReset{}, "Reset link is missing"
+	}
+	reset, err := s.db.GetPasswordReset(hashToken(token))
+	if err != nil || reset.Used || time.Now().After(reset.ExpireDate) {
+		return models.PasswordReset{}, "This reset link is invalid or has expired"
+	}
+	return reset, ""
+}
+
+func (s *Server) setPassword(userId, password string) error {
+	// Hash and store a new password, then drop the sessions kept in the users cache
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	err = s.db.UpdatePassword(userId, string(passwordHash))
+	if err != nil {
+		return err
+	}
+	for i, user := range s.users {
+		if user.UserId == userId {
+			s.users[i].Password = string(passwordHash)
+			s.users[i].SessionId.Valid = false
+			s.users[i].SessionExpire.Valid = false
+			break
+		}
+	}
+	return nil
+}
+
+func ValidateNewPassword(password, confirm string) string {
+	// Validate a new password and its confirmation
+	if len(password) < 8 {
+		return "Password must be at least 8 characters long"
+	}
+	if password != confirm {
+		return "Passwords don't match"
+	}
+	return ""
+}
+
+func generateToken() (string, error) {
+	// Generate a random token to send to the user
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	// Hash a token before storing or looking it up
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func baseURL() string {
+	// Public URL of the forum used in emails
+	if url := shared.GetEnv("baseURL"); url != "" {
+		return url
+	}
+	return "https://localhost:8080"
+}
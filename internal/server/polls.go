@@ -0,0 +1,151 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"forum-go/internal/database"
+	"forum-go/internal/models"
+)
+
+const (
+	maxPollOptions        = 10
+	maxPollQuestionLength = 200
+	maxPollOptionLength   = 100
+	// Furthest close date of a poll
+	maxPollDuration = 365 * 24 * time.Hour
+	// Time between two looks for the polls that closed
+	pollCloseInterval = time.Minute
+	// Layout of the datetime-local input of the create form
+	pollCloseLayout = "2006-01-02T15:04"
+)
+
+func parsePoll(r *http.Request, postId string, now time.Time) (*models.Poll, string) {
+	// Read the optional poll of the create form, a form without question nor options has no poll
+	question := strings.TrimSpace(r.FormValue("poll_question"))
+	var labels []string
+	seen := map[string]bool{}
+	for _, label := range r.Form["poll_options"] {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+		if seen[strings.ToLower(label)] {
+			return nil, "Poll options must be different"
+		}
+		seen[strings.ToLower(label)] = true
+		labels = append(labels, label)
+	}
+	if question == "" && len(labels) == 0 {
+		return nil, ""
+	}
+	if question == "" || len(question) > maxPollQuestionLength {
+		return nil, "Poll question cannot be empty or more than 200 characters"
+	}
+	if len(labels) < 2 || len(labels) > maxPollOptions {
+		return nil, "A poll needs between 2 and 10 options"
+	}
+	for _, label := range labels {
+		if len(label) > maxPollOptionLength {
+			return nil, "Poll options cannot be more than 100 characters"
+		}
+	}
+	closeDate := sql.NullTime{}
+	if value := r.FormValue("poll_close"); value != "" {
+		date, err := time.ParseInLocation(pollCloseLayout, value, time.Local)
+		if err != nil || !date.After(now) || date.Sub(now) > maxPollDuration {
+			return nil, "Poll close date must be in the next year"
+		}
+		closeDate = sql.NullTime{Time: date, Valid: true}
+	}
+	poll := models.NewPoll(postId, question, r.FormValue("poll_multiple") != "", closeDate, labels)
+	return &poll, ""
+}
+
+func (s *Server) VotePollHandler(w http.ResponseWriter, r *http.Request) {
+	// VotePollHandler records the ballot of the logged in user in the poll of a post
+	postId := r.PathValue("id")
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if !s.openPost(w, r, postId) {
+		return
+	}
+	user := s.getUser(r)
+	poll, err := s.db.GetPoll(postId, user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if poll == nil {
+		s.errorHandler(w, r, http.StatusNotFound, "Poll not found")
+		return
+	}
+	if poll.IsClosed(time.Now()) {
+		s.errorHandler(w, r, http.StatusForbidden, "This poll is closed")
+		return
+	}
+	r.ParseForm()
+	var optionIds []string
+	chosen := map[string]bool{}
+	for _, optionId := range r.Form["option"] {
+		if !chosen[optionId] {
+			chosen[optionId] = true
+			optionIds = append(optionIds, optionId)
+		}
+	}
+	if len(optionIds) == 0 || (!poll.Multiple && len(optionIds) > 1) {
+		s.errorHandler(w, r, http.StatusBadRequest, "Choose an option to vote")
+		return
+	}
+	err = s.db.VotePoll(poll.PollId, user.UserId, optionIds)
+	if errors.Is(err, database.ErrAlreadyVoted) {
+		s.errorHandler(w, r, http.StatusConflict, "You already voted in this poll")
+		return
+	}
+	if errors.Is(err, database.ErrInvalidOption) {
+		s.errorHandler(w, r, http.StatusBadRequest, "Invalid poll option")
+		return
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/post/"+postId+"#poll", http.StatusSeeOther)
+}
+
+func (s *Server) closePollsPeriodically() {
+	// Tell the authors their polls closed for the whole life of the server
+	for {
+		err := s.closePolls(time.Now())
+		if err != nil {
+			log.Printf("Failed to close polls: %v\n", err)
+		}
+		time.Sleep(pollCloseInterval)
+	}
+}
+
+func (s *Server) closePolls(now time.Time) error {
+	// Notify the author of each poll past its close date, once
+	polls, err := s.db.GetPollsToClose(now)
+	if err != nil {
+		return err
+	}
+	for _, poll := range polls {
+		activity := models.NewActivity(poll.PostUserID, poll.PostUserID, string(models.POLL_CLOSED), poll.PostId, "", poll.Question)
+		err = s.db.CreateActivity(activity)
+		if err != nil {
+			return err
+		}
+		err = s.db.MarkPollClosed(poll.PollId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
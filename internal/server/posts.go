@@ -1,12 +1,13 @@
 package server
 
 import (
+	"database/sql"
 	"forum-go/internal/models"
 	"forum-go/internal/shared"
 	"log"
 	"net/http"
-	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,64 +28,140 @@ func (s *Server) GetPostsHandler(w http.ResponseWriter, r *http.Request) {
 	render(w, r, "../posts", map[string]interface{}{"Posts": posts})
 }
 
+// PostFormData is the create form, shown again with its errors or to edit a draft
+type PostFormData struct {
+	DraftId     string
+	Title       string
+	Content     string
+	Image       string
+	Categories  []string
+	PublishDate string
+	Errors      map[string]string
+	// Poll fields, shown again when the form has errors
+	PollQuestion string
+	PollOptions  []string
+	PollMultiple bool
+	PollClose    string
+}
+
+// categoryChoice is a category of the create form, checked when the post has it
+type categoryChoice struct {
+	models.Category
+	Checked bool
+}
+
+func categoryChoices(categories []models.Category, checked []string) []categoryChoice {
+	choices := make([]categoryChoice, len(categories))
+	for i, category := range categories {
+		choices[i] = categoryChoice{Category: category}
+		for _, categoryId := range checked {
+			if categoryId == category.CategoryId {
+				choices[i].Checked = true
+			}
+		}
+	}
+	return choices
+}
+
 func (s *Server) PostNewPostsHandler(w http.ResponseWriter, r *http.Request) {
-	type FormData struct {
-		Title      string
-		Content    string
-		Image      string
-		Categories []string
-		Errors     map[string]string
+	// PostNewPostsHandler publishes, schedules or saves as a draft the post of the create form
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
 	}
+	user := s.getUser(r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxImagesRequestSize)
 	erri := r.ParseMultipartForm(20 * 1024 * 1024) // 20MB limit
-	formData := FormData{
-		Title:      r.FormValue("title"),
-		Content:    r.FormValue("content"),
-		Categories: r.Form["categories"],
-		Errors:     make(map[string]string),
+	formData := PostFormData{
+		DraftId:     r.FormValue("draft_id"),
+		Title:       r.FormValue("title"),
+		Content:     r.FormValue("content"),
+		Categories:  r.Form["categories"],
+		PublishDate: r.FormValue("publish_date"),
+		Errors:      make(map[string]string),
+
+		PollQuestion: r.FormValue("poll_question"),
+		PollOptions:  r.Form["poll_options"],
+		PollMultiple: r.FormValue("poll_multiple") != "",
+		PollClose:    r.FormValue("poll_close"),
 	}
 	if erri != nil {
 		log.Println(erri)
 	}
+	intent := r.FormValue("intent")
+	if intent != intentDraft && intent != intentSchedule {
+		intent = intentPublish
+	}
+	now := time.Now()
 
-	// Validate title
-	if ValidateTitle(formData.Title) {
-		formData.Errors["Title"] = "Title cannot be empty"
+	// Editing a draft keeps its id, images and status
+	draft := models.Post{PostId: shared.ParseUUID(shared.GenerateUUID()), Status: models.POST_DRAFT}
+	if formData.DraftId != "" {
+		var ok bool
+		draft, ok = s.ownDraft(w, r, formData.DraftId)
+		if !ok {
+			return
+		}
 	}
+	postId := draft.PostId
 
-	// Validate content
-	if ValidatePostChar(formData.Content) {
+	// Validate content, a draft may be unfinished but not too long
+	if len(formData.Content) > MaxChar {
 		formData.Errors["Content"] = "Content cannot be empty or more than 1000 characters"
 	}
-
-	// Validate Categories
-	if ValidateCategory(formData.Categories) {
-		formData.Errors["Categories"] = "Please select at least one category"
+	if intent != intentDraft {
+		if ValidateTitle(formData.Title) {
+			formData.Errors["Title"] = "Title cannot be empty"
+		}
+		if ValidatePostChar(formData.Content) {
+			formData.Errors["Content"] = "Content cannot be empty or more than 1000 characters"
+		}
+		if ValidateCategory(formData.Categories) {
+			formData.Errors["Categories"] = "Please select at least one category"
+		}
 	}
 
-	// Handle image upload
-	var imageURL string
-	if r.MultipartForm != nil && r.MultipartForm.File["file"] != nil {
-		imageURL, erri = UploadImageHandler(w, r)
-		if erri != nil {
-			formData.Errors["Image"] = erri.Error()
+	// Validate publish date
+	publishDate := sql.NullTime{}
+	if intent == intentSchedule {
+		date, err := time.ParseInLocation(publishDateLayout, formData.PublishDate, time.Local)
+		if err != nil || !date.After(now) || date.Sub(now) > maxScheduleDelay {
+			formData.Errors["PublishDate"] = "Publish date must be in the next year"
+		} else {
+			publishDate = sql.NullTime{Time: date, Valid: true}
 		}
 	}
 
-	// Check for errors
-	if len(formData.Errors) > 0 {
-		render(w, r, "createPost", map[string]interface{}{"FormData": formData, "Categories": s.categories})
-		return
+	// Validate poll
+	poll, pollError := parsePoll(r, postId, now)
+	if pollError == "" && poll != nil && poll.CloseDate.Valid && publishDate.Valid && !poll.CloseDate.Time.After(publishDate.Time) {
+		pollError = "Poll close date must be after the publish date"
+	}
+	if pollError == "" && poll != nil {
+		allowed, needed, err := s.hasKarma(r, karmaPollsSetting)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !allowed {
+			pollError = "You need " + strconv.Itoa(needed) + " karma to create a poll"
+		}
+	}
+	if pollError != "" {
+		formData.Errors["Poll"] = pollError
 	}
 
-	// Create new post
-	newPost := models.Post{
-		PostId:                shared.ParseUUID(shared.GenerateUUID()),
-		Title:                 formData.Title,
-		Content:               formData.Content,
-		UserID:                r.FormValue("UserId"),
-		ImageURL:              imageURL,
-		CreationDate:          time.Now(),
-		FormattedCreationDate: time.Now().Format("Jan 02, 2006 - 15:04:05"),
+	// The form is saved as a draft so that nothing is lost, unless it is new, has errors and no images
+	hasImages := r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0
+	save := len(formData.Content) <= MaxChar && (len(formData.Errors) == 0 || hasImages || formData.DraftId != "")
+
+	// Handle image uploads
+	var attachments []models.Attachment
+	if save && hasImages {
+		attachments, erri = s.uploadAttachments(r, postId, len(draft.Attachments), true)
+		if erri != nil {
+			formData.Errors["Image"] = erri.Error()
+		}
 	}
 
 	categories := []models.Category{}
@@ -95,19 +172,74 @@ func (s *Server) PostNewPostsHandler(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
-	newPost.Categories = categories
-	err := s.db.AddPost(newPost, categories)
-	s.posts = append(s.posts, newPost)
-	newActivity := models.NewActivity(newPost.UserID, newPost.UserID, string(models.POST_CREATED), newPost.PostId, "", newPost.Title)
-	s.db.CreateActivity(newActivity)
+
+	newPost := models.Post{
+		PostId:       postId,
+		Title:        formData.Title,
+		Content:      formData.Content,
+		UserID:       user.UserId,
+		Categories:   categories,
+		CreationDate: now,
+		Status:       draft.Status,
+		PublishDate:  draft.PublishDate,
+	}
+	if len(formData.Errors) == 0 {
+		newPost.Status = models.POST_DRAFT
+		newPost.PublishDate = sql.NullTime{}
+		if intent == intentSchedule {
+			newPost.Status = models.POST_SCHEDULED
+			newPost.PublishDate = publishDate
+		}
+	}
+	if save {
+		err := s.saveDraft(newPost, formData.DraftId == "", categories, attachments, poll, pollError == "")
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		formData.DraftId = postId
+	}
+
+	// Check for errors
+	if len(formData.Errors) > 0 {
+		kept := append(draft.Attachments, attachments...)
+		if !save {
+			kept = nil
+		}
+		for i, attachment := range kept {
+			kept[i].ThumbnailURL = s.draftImageURL(attachment.ImageURL)
+		}
+		render(w, r, "createPost", map[string]interface{}{
+			"FormData":    formData,
+			"Categories":  categoryChoices(s.categories, formData.Categories),
+			"Attachments": kept,
+		})
+		return
+	}
+
+	if intent != intentPublish {
+		http.Redirect(w, r, "/drafts", http.StatusSeeOther)
+		return
+	}
+	err := s.publishPost(newPost, now)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	published, err := s.db.GetPost(newPost.PostId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.posts = append(s.posts, published)
 	http.Redirect(w, r, "/post/"+newPost.PostId, http.StatusSeeOther)
 }
 
 func (s *Server) DeletePostsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	PostID := r.FormValue("postId")
 	// Fetch the post to get the image path
 	post, err := s.db.GetPost(PostID)
@@ -115,34 +247,78 @@ func (s *Server) DeletePostsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch post", http.StatusInternalServerError)
 		return
 	}
+	// Posts in the trash are not found, they can only be restored or purged from there
+	if post.PostId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	}
+	// Drafts are private to their author, moderators can only remove published posts
+	isAuthor := post.UserID == s.getUser(r).UserId
+	if !isAuthor && (!post.IsPublished() || (!IsAdmin(r) && !IsModerator(r))) {
+		s.errorHandler(w, r, http.StatusForbidden, "You are not allowed to delete this post")
+		return
+	}
 
-	// Delete the image file if it exists
-	if post.ImageURL != "" {
-		err = os.Remove("assets/img/uploads/" + post.ImageURL)
-		if err != nil && !os.IsNotExist(err) { // Ignore errors if the file doesn't exist
-			log.Printf("Failed to delete image file: %v\n", err)
+	// A published post goes to the trash, its images stay until it is purged
+	if post.IsPublished() {
+		_, err = s.db.Trash(models.TRASH_POST, PostID, s.getUser(r).UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
 	}
 
-	// Delete the post from the database
+	// A draft is deleted from the database right away
 	err = s.db.DeletePost(PostID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+
+	s.markdown.Invalidate(postCacheKey(PostID))
+
+	// Delete the image files unless another post uploaded the same images
+	for _, attachment := range post.Attachments {
+		s.releaseImage(attachment.ImageURL)
+	}
+	http.Redirect(w, r, "/drafts", http.StatusSeeOther)
 }
 
 func (s *Server) EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	// Edit a post
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
 	PostId := r.FormValue("PostId")
 	UpdatedContent := r.FormValue("UpdatedContent")
 
-	err := s.db.EditPost(PostId, UpdatedContent)
+	post, err := s.db.GetPost(PostId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if post.PostId == "" {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	}
+	if post.UserID != s.getUser(r).UserId && !IsAdmin(r) {
+		s.errorHandler(w, r, http.StatusForbidden, "You are not allowed to edit this post")
+		return
+	}
+	if post.Archived {
+		s.errorHandler(w, r, http.StatusForbidden, "This post is archived")
+		return
+	}
+	err = s.db.EditPost(PostId, UpdatedContent)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
+	s.markdown.Invalidate(postCacheKey(PostId))
+	s.notifyReferences(post.UserID, PostId, "", UpdatedContent, post.Content)
 	http.Redirect(w, r, "/post/"+PostId, http.StatusSeeOther)
 }
 
@@ -157,7 +333,7 @@ func (s *Server) GetNewPostHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
-	render(w, r, "createPost", map[string]interface{}{"Categories": categories})
+	render(w, r, "createPost", map[string]interface{}{"Categories": categoryChoices(categories, nil)})
 }
 
 func (s *Server) GetPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -173,19 +349,79 @@ func (s *Server) GetPostHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if post.PostId == "" {
+	if post.PostId != "" && !post.IsPublished() && post.UserID == s.getUser(r).UserId {
+		http.Redirect(w, r, "/drafts/"+post.PostId, http.StatusSeeOther)
+		return
+	}
+	if post.PostId == "" || !post.IsPublished() {
 		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
 		return
 	}
 	post.HasVoted = GetUserVote(post, s.getUser(r).UserId)
+	post.Poll, err = s.db.GetPoll(post.PostId, s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if post.Poll != nil {
+		post.Poll.Closed = post.Poll.IsClosed(time.Now())
+	}
+	if IsAdmin(r) || IsModerator(r) {
+		post.StateChanges, err = s.db.GetPostStateChanges(post.PostId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	hidden, err := s.hiddenUsers(r)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	emojis, err := s.reactions()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	counts, err := s.db.GetReactions(post.PostId, s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	post.Reactions = reactionCounts(emojis, counts, "")
+	post.Comments = withoutHiddenComments(post.Comments, hidden)
+	post.RenderedContent = s.markdown.Render(postCacheKey(post.PostId), post.Content)
 	for i, comment := range post.Comments {
 		post.Comments[i].HasVoted = GetUserVote(comment, s.getUser(r).UserId)
+		post.Comments[i].Reactions = reactionCounts(emojis, counts, comment.CommentId)
+		post.Comments[i].RenderedContent = s.markdown.Render(commentCacheKey(comment.CommentId), comment.Content)
 	}
-	if post.ImageURL != "" {
-		render(w, r, "detailsPost", map[string]interface{}{"Post": post, "ImageURL": post.ImageURL})
-		return
+	for i, attachment := range post.Attachments {
+		post.Attachments[i].ThumbnailURL = s.thumbnailURL(attachment.ImageURL)
+	}
+	folders := []models.BookmarkFolder{}
+	followed := false
+	if s.isLoggedIn(r) {
+		followed, err = s.isFollowed(s.getUser(r).UserId, post.PostId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		bookmarks, err := s.db.GetBookmarks(s.getUser(r).UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		posts := []models.Post{post}
+		markBookmarks(posts, bookmarks)
+		post = posts[0]
+		folders, err = s.db.GetBookmarkFolders(s.getUser(r).UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 	}
-	render(w, r, "detailsPost", map[string]interface{}{"Post": post})
+	render(w, r, "detailsPost", map[string]interface{}{"Post": post, "MaxAttachments": maxAttachments, "Folders": folders, "Followed": followed})
 }
 
 func IsUniquePost(posts []models.Post, post string) bool {
@@ -0,0 +1,234 @@
+package server
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forum-go/internal/models"
+)
+
+const (
+	// Posts or comments shown per page of a profile
+	profilePageSize = 10
+	// Public actions shown on a profile
+	profileActivities = 10
+	maxBioLength      = 500
+	maxLocationLength = 100
+	maxProfileLinks   = 5
+	maxLinkLength     = 200
+)
+
+// Actions shown to the visitors of a profile, votes against someone stay private
+var publicActionTypes = []string{
+	string(models.POST_CREATED),
+	string(models.COMMENT_CREATED),
+	string(models.POST_LIKED),
+	string(models.COMMENT_LIKED),
+	string(models.BADGE_AWARDED),
+}
+
+func (s *Server) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	// ProfileHandler handles the public profile of a user with his posts or comments, karma and recent activity
+	user, err := s.db.FindUserByUsername(r.PathValue("username"))
+	if err == sql.ErrNoRows {
+		s.errorHandler(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	profile, err := s.db.GetProfile(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	karma, err := s.db.GetKarma(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	activities, err := s.db.GetPublicActivities(user.UserId, publicActionTypes, profileActivities)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	badges, err := s.db.GetUserBadges(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	nbPosts, err := s.db.CountUserPosts(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	nbComments, err := s.db.CountUserComments(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	followers, following, err := s.db.CountFollows(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	isFollowing, isBlocked, isMuted := false, false, false
+	if s.isLoggedIn(r) {
+		isFollowing, err = s.db.IsFollowing(s.getUser(r).UserId, user.UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		blocks, err := s.db.GetBlocks(s.getUser(r).UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, block := range blocks {
+			if block.TargetId == user.UserId {
+				isBlocked = isBlocked || block.Kind == models.BLOCK_BLOCK
+				isMuted = isMuted || block.Kind == models.BLOCK_MUTE
+			}
+		}
+	}
+
+	tab := r.URL.Query().Get("tab")
+	if tab != "comments" {
+		tab = "posts"
+	}
+	total := nbPosts
+	if tab == "comments" {
+		total = nbComments
+	}
+	page, lastPage := pageNumber(r, total, profilePageSize)
+	data := map[string]interface{}{
+		"Profile":      profile,
+		"Owner":        user,
+		"JoinDate":     user.CreationDate.Format("Jan 2, 2006"),
+		"Karma":        karma,
+		"Badges":       badges,
+		"Activities":   activities,
+		"NbPosts":      nbPosts,
+		"NbComments":   nbComments,
+		"NbFollowers":  followers,
+		"NbFollowing":  following,
+		"IsFollowing":  isFollowing,
+		"IsBlocked":    isBlocked,
+		"IsMuted":      isMuted,
+		"Tab":          tab,
+		"Page":         page,
+		"LastPage":     lastPage,
+		"PrevPage":     page - 1,
+		"NextPage":     page + 1,
+		"IsOwnProfile": s.getUser(r).UserId == user.UserId,
+	}
+	offset := (page - 1) * profilePageSize
+	if tab == "comments" {
+		data["Comments"], err = s.db.GetUserComments(user.UserId, profilePageSize, offset)
+	} else {
+		data["Posts"], err = s.db.GetUserPosts(user.UserId, profilePageSize, offset)
+	}
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "profile", data)
+}
+
+func (s *Server) GetProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// GetProfileSettingsHandler handles the form editing the public profile
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	s.renderProfileSettings(w, r, s.getUser(r), "")
+}
+
+func (s *Server) PostProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	// PostProfileSettingsHandler saves the bio, location and links of the user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	profile, errMsg := ValidateProfile(r.FormValue("bio"), r.FormValue("location"), r.FormValue("links"))
+	if errMsg != "" {
+		avatar, err := s.db.GetAvatar(user.UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		render(w, r, "profileSettings", map[string]interface{}{"Profile": profile, "Links": r.FormValue("links"), "HasAvatar": avatar.Version != 0, "Error": errMsg})
+		return
+	}
+	profile.UserId = user.UserId
+	profile.UpdateDate = time.Now()
+	err := s.db.SaveProfile(profile)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/u/"+url.PathEscape(user.Username), http.StatusSeeOther)
+}
+
+func (s *Server) renderProfileSettings(w http.ResponseWriter, r *http.Request, user models.User, errMsg string) {
+	// Render the profile settings with the saved profile
+	profile, err := s.db.GetProfile(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	avatar, err := s.db.GetAvatar(user.UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "profileSettings", map[string]interface{}{
+		"Profile":   profile,
+		"Links":     strings.Join(profile.Links, "\n"),
+		"HasAvatar": avatar.Version != 0,
+		"Error":     errMsg,
+	})
+}
+
+func ValidateProfile(bio, location, links string) (models.Profile, string) {
+	// Validate the fields of a profile, links are given one per line and must be web addresses
+	profile := models.Profile{Bio: strings.TrimSpace(bio), Location: strings.TrimSpace(location)}
+	if utf8.RuneCountInString(profile.Bio) > maxBioLength {
+		return profile, "Bio must be at most " + strconv.Itoa(maxBioLength) + " characters long"
+	}
+	if utf8.RuneCountInString(profile.Location) > maxLocationLength {
+		return profile, "Location must be at most " + strconv.Itoa(maxLocationLength) + " characters long"
+	}
+	for _, link := range strings.Split(links, "\n") {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			continue
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(link) > maxLinkLength {
+			return profile, "Invalid link: " + link
+		}
+		profile.Links = append(profile.Links, link)
+	}
+	if len(profile.Links) > maxProfileLinks {
+		return profile, "You can add at most " + strconv.Itoa(maxProfileLinks) + " links"
+	}
+	return profile, ""
+}
+
+func pageNumber(r *http.Request, total, pageSize int) (int, int) {
+	// Current page from the "page" query parameter, kept between 1 and the last page
+	lastPage := max((total+pageSize-1)/pageSize, 1)
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	return min(page, lastPage), lastPage
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"forum-go/internal/models"
+)
+
+const (
+	// Setting holding the emojis users can react with, separated by spaces
+	reactionsSetting = "reactions"
+	// Emojis used while no admin has chosen any
+	defaultReactions = "❤️ 😂 😮 😢 🔥"
+	// Most emojis an admin can choose
+	maxReactions = 10
+	// Longest emoji in bytes, as stored in the database
+	maxReactionLength = 32
+)
+
+func parseReactions(value string) []string {
+	// Emojis of a reactions setting, nil when one of them is not an emoji or there are too many
+	emojis := []string{}
+	for _, emoji := range strings.Fields(value) {
+		if len(emoji) > maxReactionLength || !utf8.ValidString(emoji) {
+			return nil
+		}
+		for _, char := range emoji {
+			if char < utf8.RuneSelf {
+				return nil
+			}
+		}
+		duplicate := false
+		for _, other := range emojis {
+			duplicate = duplicate || other == emoji
+		}
+		if !duplicate {
+			emojis = append(emojis, emoji)
+		}
+	}
+	if len(emojis) == 0 || len(emojis) > maxReactions {
+		return nil
+	}
+	return emojis
+}
+
+func (s *Server) reactions() ([]string, error) {
+	// Emojis users can react with, the default ones while the setting is unset or invalid
+	value, err := s.db.GetSetting(reactionsSetting)
+	if err != nil {
+		return nil, err
+	}
+	emojis := parseReactions(value)
+	if emojis == nil {
+		emojis = parseReactions(defaultReactions)
+	}
+	return emojis, nil
+}
+
+func reactionCounts(emojis []string, counts []models.ReactionCount, commentId string) []models.ReactionCount {
+	// Counts of a post, or of one of its comments, for every emoji in the order of the setting
+	reactions := make([]models.ReactionCount, 0, len(emojis))
+	for _, emoji := range emojis {
+		reaction := models.ReactionCount{CommentId: commentId, Emoji: emoji}
+		for _, count := range counts {
+			if count.CommentId == commentId && count.Emoji == emoji {
+				reaction = count
+			}
+		}
+		reactions = append(reactions, reaction)
+	}
+	return reactions
+}
+
+func (s *Server) ReactHandler(w http.ResponseWriter, r *http.Request) {
+	// ReactHandler adds an emoji reaction to a post or a comment, or takes it back
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	postID := r.FormValue("post_id")
+	commentID := r.FormValue("comment_id")
+	emoji := r.FormValue("emoji")
+	if !s.openPost(w, r, postID) {
+		return
+	}
+	emojis, err := s.reactions()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	allowed := false
+	for _, e := range emojis {
+		allowed = allowed || e == emoji
+	}
+	if !allowed {
+		s.errorHandler(w, r, http.StatusBadRequest, "Unknown reaction")
+		return
+	}
+	post, err := s.db.GetPost(postID)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	author, details := post.UserID, post.Title
+	if commentID != "" {
+		author = ""
+		for _, comment := range post.Comments {
+			if comment.CommentId == commentID && !comment.DeletionDate.Valid {
+				author, details = comment.UserID, comment.Content
+			}
+		}
+		if author == "" {
+			s.errorHandler(w, r, http.StatusNotFound, "Comment not found")
+			return
+		}
+	}
+	userID := s.getUser(r).UserId
+	added, err := s.db.React(models.NewReaction(userID, postID, commentID, emoji))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if added && author != userID {
+		// Taking a reaction back and adding it again doesn't notify the author twice
+		notified, err := s.db.HasReactionActivity(userID, postID, commentID, emoji)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !notified {
+			newActivity := models.NewActivity(author, userID, string(models.GET_REACTION), postID, commentID, emoji+" "+details)
+			err = s.db.CreateActivity(newActivity)
+			if err != nil {
+				s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+	}
+	referer := r.Header.Get("Referer")
+	if referer != "" {
+		http.Redirect(w, r, referer, http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/post/"+postID, http.StatusSeeOther)
+}
+
+func (s *Server) PostReactionsSettingHandler(w http.ResponseWriter, r *http.Request) {
+	// PostReactionsSettingHandler sets the emojis users can react with
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	emojis := parseReactions(r.FormValue("reactions"))
+	if emojis == nil {
+		s.errorHandler(w, r, http.StatusBadRequest, "Reactions are between 1 and "+strconv.Itoa(maxReactions)+" emojis separated by spaces")
+		return
+	}
+	err := s.db.SetSetting(reactionsSetting, strings.Join(emojis, " "))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
@@ -7,13 +7,17 @@ import (
 	"forum-go/security"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func (s *Server) RegisterRoutes() http.Handler {
 
 	mux := http.NewServeMux()
 
-	mux.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets"))))
+	mux.Handle("/assets/", hideUploads(http.StripPrefix("/assets/", http.FileServer(http.Dir("./assets")))))
+	mux.HandleFunc("GET /uploads/{key...}", s.UploadsHandler)
+	mux.HandleFunc("GET /blobs/{key...}", s.SignedBlobHandler)
 
 	mux.HandleFunc("/", security.RateLimitedHandler(s.HomePageHandler))
 
@@ -22,12 +26,28 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.HandleFunc("/activity", security.RateLimitedHandler(s.ActivityPageHandler))
 
 	mux.HandleFunc("GET /login", security.RateLimitedHandler(s.GetLoginHandler))
-	mux.HandleFunc("POST /login", s.PostLoginHandler)
+	mux.HandleFunc("POST /login", security.RateLimitedHandler(s.PostLoginHandler))
 
 	mux.HandleFunc("POST /logout", s.LogoutHandler)
 
 	mux.HandleFunc("GET /register", security.RateLimitedHandler(s.GetRegisterHandler))
-	mux.HandleFunc("POST /register", s.PostRegisterHandler)
+	mux.HandleFunc("POST /register", security.RateLimitedHandler(s.PostRegisterHandler))
+
+	mux.HandleFunc("GET /password/forgot", security.RateLimitedHandler(s.GetForgotPasswordHandler))
+	mux.HandleFunc("POST /password/forgot", security.RateLimitedHandler(s.PostForgotPasswordHandler))
+	mux.HandleFunc("GET /password/reset", security.RateLimitedHandler(s.GetResetPasswordHandler))
+	mux.HandleFunc("POST /password/reset", s.PostResetPasswordHandler)
+	mux.HandleFunc("GET /password/change", security.RateLimitedHandler(s.GetChangePasswordHandler))
+	mux.HandleFunc("POST /password/change", s.PostChangePasswordHandler)
+
+	mux.HandleFunc("GET /login/2fa", security.RateLimitedHandler(s.GetLoginTwoFactorHandler))
+	mux.HandleFunc("POST /login/2fa", security.RateLimitedHandler(s.PostLoginTwoFactorHandler))
+	mux.HandleFunc("GET /login/2fa/setup", security.RateLimitedHandler(s.GetLoginTwoFactorSetupHandler))
+	mux.HandleFunc("POST /login/2fa/setup", security.RateLimitedHandler(s.PostLoginTwoFactorSetupHandler))
+	mux.HandleFunc("GET /settings/2fa", security.RateLimitedHandler(s.GetTwoFactorHandler))
+	mux.HandleFunc("POST /settings/2fa/enable", s.PostEnableTwoFactorHandler)
+	mux.HandleFunc("POST /settings/2fa/disable", s.PostDisableTwoFactorHandler)
+	mux.HandleFunc("POST /settings/2fa/recovery", s.PostRecoveryCodesHandler)
 
 	mux.HandleFunc("GET /delete/users/{id}", security.RateLimitedHandler(s.DeleteUsersHandler))
 	mux.HandleFunc("GET /ban/users/{id}", security.RateLimitedHandler(s.BanUserHandler))
@@ -38,6 +58,13 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.HandleFunc("POST /posts/create", s.PostNewPostsHandler)
 	mux.HandleFunc("POST /posts/delete/{id}", s.DeletePostsHandler)
 	mux.HandleFunc("POST /posts/edit/{id}", s.EditPostHandler)
+	mux.HandleFunc("POST /post/{id}/attachments", s.PostAttachmentsHandler)
+	mux.HandleFunc("POST /post/{id}/attachments/{attachmentId}", s.EditAttachmentHandler)
+	mux.HandleFunc("POST /post/{id}/poll", s.VotePollHandler)
+	mux.HandleFunc("POST /post/{id}/state", s.PostStateHandler)
+	mux.HandleFunc("GET /drafts", security.RateLimitedHandler(s.DraftsHandler))
+	mux.HandleFunc("GET /drafts/{id}", security.RateLimitedHandler(s.GetDraftHandler))
+	mux.HandleFunc("POST /drafts/autosave", s.AutosaveDraftHandler)
 
 	mux.HandleFunc("GET /categories", security.RateLimitedHandler(s.GetCategoriesHandler))
 	mux.HandleFunc("POST /categories/add", s.PostCategoriesHandler)
@@ -48,13 +75,38 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.HandleFunc("POST /comment/delete/{id}", s.DeleteCommentHandler)
 	mux.HandleFunc("POST /comment/edit/{id}", s.EditCommentHandler)
 	mux.HandleFunc("POST /post/comment", s.PostCommentHandler)
+	mux.HandleFunc("POST /markdown/preview", security.RateLimitedHandler(s.PreviewMarkdownHandler))
 
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("GET /adminPanel", security.RateLimitedHandler(s.AdminPanelHandler))
+	mux.HandleFunc("POST /adminPanel/2fa", s.PostTwoFactorPolicyHandler)
+	mux.HandleFunc("POST /adminPanel/trash", s.PostTrashRetentionHandler)
+	mux.HandleFunc("POST /adminPanel/karma", s.PostKarmaSettingsHandler)
+	mux.HandleFunc("POST /adminPanel/badges", s.PostBadgeHandler)
+	mux.HandleFunc("POST /adminPanel/badges/award", s.AwardBadgeHandler)
+	mux.HandleFunc("POST /adminPanel/reactions", s.PostReactionsSettingHandler)
+	mux.HandleFunc("GET /trash", security.RateLimitedHandler(s.TrashHandler))
+	mux.HandleFunc("POST /trash/restore", s.RestoreTrashHandler)
+	mux.HandleFunc("GET /adminPanel/locked", security.RateLimitedHandler(s.LockedAccountsHandler))
+	mux.HandleFunc("POST /adminPanel/unlock", s.UnlockAccountHandler)
 	mux.HandleFunc("GET /report/{id}", security.RateLimitedHandler(s.GetReportHandler))
 	mux.HandleFunc("POST /report", s.PostReportHandler)
 	mux.HandleFunc("GET /adminPanel/modrequests", security.RateLimitedHandler(s.ModRequestsHandler))
 	mux.HandleFunc("POST /vote", s.VoteHandler)
+	mux.HandleFunc("POST /react", s.ReactHandler)
+	mux.HandleFunc("POST /bookmark", s.BookmarkHandler)
+	mux.HandleFunc("POST /saved/move", s.MoveBookmarkHandler)
+	mux.HandleFunc("POST /saved/folders", s.PostBookmarkFolderHandler)
+	mux.HandleFunc("POST /saved/folders/delete", s.DeleteBookmarkFolderHandler)
+	mux.HandleFunc("GET /messages", security.RateLimitedHandler(s.InboxHandler))
+	mux.HandleFunc("POST /messages", s.PostConversationHandler)
+	mux.HandleFunc("GET /messages/events", s.MessageEventsHandler)
+	mux.HandleFunc("POST /messages/report", s.ReportMessageHandler)
+	mux.HandleFunc("GET /messages/{id}", security.RateLimitedHandler(s.ConversationHandler))
+	mux.HandleFunc("POST /messages/{id}", s.PostMessageHandler)
+	mux.HandleFunc("POST /subscribe", s.SubscribeHandler)
+	mux.HandleFunc("POST /unsubscribe", s.UnsubscribeHandler)
+	mux.HandleFunc("GET /subscriptions", security.RateLimitedHandler(s.SubscriptionsHandler))
 
 	mux.HandleFunc("POST /modRequest", s.PostModRequestHandler)
 	mux.HandleFunc("GET /modRequest", security.RateLimitedHandler(s.GetModRequestHandler))
@@ -64,16 +116,26 @@ func (s *Server) RegisterRoutes() http.Handler {
 	mux.HandleFunc("GET /adminPanel/reports", security.RateLimitedHandler(s.GetReportsHandler))
 	mux.HandleFunc("POST /reports/accepted", s.AcceptReportHandler)
 	mux.HandleFunc("POST /reports/rejected", s.RejectReportHandler)
+	mux.HandleFunc("POST /messagereports/accepted", s.AcceptMessageReportHandler)
+	mux.HandleFunc("POST /messagereports/rejected", s.RejectMessageReportHandler)
 
 	// AUTH ROUTES
-	mux.HandleFunc("/auth/google", security.RateLimitedHandler(s.GoogleLoginHandler))
-	mux.HandleFunc("/auth/google/callback", security.RateLimitedHandler(s.GoogleCallbackHandler))
-
-	mux.HandleFunc("/auth/github", security.RateLimitedHandler(s.GithubLoginHandler))
-	mux.HandleFunc("/auth/github/callback", security.RateLimitedHandler(s.GithubCallbackHandler))
-
-	mux.HandleFunc("/auth/discord", security.RateLimitedHandler(s.DiscordLoginHandler))
-	mux.HandleFunc("/auth/discord/callback", security.RateLimitedHandler(s.DiscordCallbackHandler))
+	mux.HandleFunc("GET /auth/{provider}", security.RateLimitedHandler(s.OAuthLoginHandler))
+	mux.HandleFunc("GET /auth/{provider}/callback", security.RateLimitedHandler(s.OAuthCallbackHandler))
+	mux.HandleFunc("GET /u/{username}", security.RateLimitedHandler(s.ProfileHandler))
+	mux.HandleFunc("POST /u/{username}/follow", s.FollowUserHandler)
+	mux.HandleFunc("POST /u/{username}/unfollow", s.UnfollowUserHandler)
+	mux.HandleFunc("GET /settings/profile", security.RateLimitedHandler(s.GetProfileSettingsHandler))
+	mux.HandleFunc("POST /settings/profile", s.PostProfileSettingsHandler)
+	mux.HandleFunc("POST /settings/avatar", s.PostAvatarHandler)
+	mux.HandleFunc("POST /settings/avatar/delete", s.DeleteAvatarHandler)
+	mux.HandleFunc("GET /settings/blocks", security.RateLimitedHandler(s.BlocksHandler))
+	mux.HandleFunc("POST /settings/blocks", s.PostBlockHandler)
+	mux.HandleFunc("POST /settings/blocks/delete", s.DeleteBlockHandler)
+	mux.HandleFunc("GET /avatars/{id}", s.AvatarHandler)
+	mux.HandleFunc("GET /settings/accounts", security.RateLimitedHandler(s.GetAccountsHandler))
+	mux.HandleFunc("POST /settings/accounts/link", security.RateLimitedHandler(s.PostLinkAccountHandler))
+	mux.HandleFunc("POST /settings/accounts/unlink", security.RateLimitedHandler(s.PostUnlinkAccountHandler))
 
 	return s.authenticate(mux)
 }
@@ -85,17 +147,36 @@ func (s *Server) VoteHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	postID := r.FormValue("post_id")
-	userID := r.FormValue("user_id")
+	userID := s.getUser(r).UserId
 	vote := r.FormValue("vote")
 	commentID := r.FormValue("comment_id")
+	if !s.openPost(w, r, postID) {
+		return
+	}
 	var isLike bool
 	if vote == "like" {
 		isLike = true
 	} else {
 		isLike = false
 	}
+	if !isLike {
+		allowed, needed, err := s.hasKarma(r, karmaDislikeSetting)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !allowed {
+			s.errorHandler(w, r, http.StatusForbidden, "You need "+strconv.Itoa(needed)+" karma to dislike")
+			return
+		}
+	}
+	karma, err := s.voteKarma(commentID != "", isLike)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	err := s.db.Vote(postID, commentID, userID, isLike)
+	err = s.db.Vote(postID, commentID, userID, isLike, karma)
 	if err != nil {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -118,6 +199,7 @@ func (s *Server) VoteHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 			}
+			s.awardBadges(post.UserID)
 		} else {
 			if post.UserID != s.getUser(r).UserId {
 				newActivity := models.NewActivity(post.UserID, userID, string(models.GET_POST_DISLIKED), postID, "", post.Title)
@@ -152,6 +234,9 @@ func (s *Server) VoteHandler(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 			}
+			if ActualComment.UserID != "" {
+				s.awardBadges(ActualComment.UserID)
+			}
 		} else {
 			if ActualComment.UserID != s.getUser(r).UserId {
 				newActivity := models.NewActivity(ActualComment.UserID, userID, string(models.GET_COMMENT_DISLIKED), postID, ActualComment.CommentId, ActualComment.Content)
@@ -228,16 +313,43 @@ func (s *Server) AdminPanelHandler(w http.ResponseWriter, r *http.Request) {
 		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	render(w, r, "admin/adminPanel", map[string]interface{}{"users": users})
+	require2FA, err := s.db.GetSetting(require2FASetting)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	retention, err := s.trashRetention()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	karma, err := s.karmaValues()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	badges, err := s.db.GetBadges()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	reactions, err := s.reactions()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "admin/adminPanel", map[string]interface{}{"users": users, "Require2FA": require2FA == "true", "TrashRetention": retention, "MaxTrashRetention": maxTrashRetention,
+		"Karma": karma, "MaxKarmaWeight": maxKarmaWeight, "MaxKarmaThreshold": maxKarmaThreshold, "Badges": badges,
+		"Reactions": strings.Join(reactions, " "), "MaxReactions": maxReactions})
 }
 
 func (s *Server) HomePageHandler(w http.ResponseWriter, r *http.Request) {
 	// HomePageHandler handles the home page
-	if r.URL.Path != "/" && r.URL.Path != "/created" && r.URL.Path != "/liked" {
+	if r.URL.Path != "/" && r.URL.Path != "/created" && r.URL.Path != "/liked" && r.URL.Path != "/saved" && r.URL.Path != "/following" {
 		s.errorHandler(w, r, http.StatusNotFound, "Page not found")
 		return
 	}
-	if !s.isLoggedIn(r) && (r.URL.Path == "/created" || r.URL.Path == "/liked") {
+	if !s.isLoggedIn(r) && r.URL.Path != "/" {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
@@ -254,7 +366,29 @@ func (s *Server) HomePageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	for i, post := range s.posts {
 		s.posts[i].HasVoted = GetUserVote(post, s.getUser(r).UserId)
+		s.posts[i].ThumbnailURL = s.thumbnailURL(post.ImageURL)
 	}
+	bookmarks := []models.Bookmark{}
+	if s.isLoggedIn(r) {
+		bookmarks, err = s.db.GetBookmarks(s.getUser(r).UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		markBookmarks(s.posts, bookmarks)
+	}
+	// Posts of muted and blocked users are left out everywhere but in the user's own lists
+	hidden := map[string]bool{}
+	if r.URL.Path != "/created" && r.URL.Path != "/saved" {
+		hidden, err = s.hiddenUsers(r)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	// Categories picked in the filters, the posts pinned in them come first on the home page and the following feed
+	selected := selectedCategories(s.categories, r.URL.Query()["category"])
+	data := map[string]interface{}{"Categories": s.categories, "SelectedCategories": selected}
 	postsToRender := []models.Post{}
 	if r.URL.Path == "/created" {
 		for _, post := range s.posts {
@@ -264,15 +398,45 @@ func (s *Server) HomePageHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	} else if r.URL.Path == "/liked" {
 		for _, post := range s.posts {
-			if post.HasVoted == 1 {
+			if post.HasVoted == 1 && !hidden[post.UserID] {
 				postsToRender = append(postsToRender, post)
 			}
 		}
+	} else if r.URL.Path == "/saved" {
+		folderId := r.URL.Query().Get("folder")
+		folders, err := s.db.GetBookmarkFolders(s.getUser(r).UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		postsToRender, data["SavedComments"] = savedContent(s.posts, bookmarks, folderId)
+		data["Saved"] = true
+		data["Folders"] = folders
+		data["Folder"] = folderId
+	} else if r.URL.Path == "/following" {
+		feed, err := s.followingFeed(s.getUser(r).UserId, s.posts)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Filtered before paging so every page is full
+		feed = pinnedFirst(withCategories(withoutHiddenPosts(feed, hidden), selected), selected)
+		page, lastPage := pageNumber(r, len(feed), feedPageSize)
+		postsToRender = feed[min((page-1)*feedPageSize, len(feed)):min(page*feedPageSize, len(feed))]
+		data["Following"] = true
+		data["Page"] = page
+		data["LastPage"] = lastPage
+		data["PrevPage"] = page - 1
+		data["NextPage"] = page + 1
 	} else {
-		postsToRender = s.posts
+		postsToRender = pinnedFirst(withoutHiddenPosts(s.posts, hidden), selected)
+	}
+	if r.URL.Path != "/following" {
+		postsToRender = withCategories(postsToRender, selected)
 	}
+	data["Posts"] = postsToRender
 
-	render(w, r, "home", map[string]interface{}{"Categories": s.categories, "Posts": postsToRender})
+	render(w, r, "home", data)
 }
 func (s *Server) AboutPageHandler(w http.ResponseWriter, r *http.Request) {
 	render(w, r, "about", nil)
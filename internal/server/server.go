@@ -3,11 +3,16 @@ package server
 import (
 	"crypto/tls"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"forum-go/internal/database"
+	"forum-go/internal/markdown"
 	"forum-go/internal/models"
+	"forum-go/internal/oauth"
+	"forum-go/internal/storage"
 )
 
 type Server struct {
@@ -16,6 +21,14 @@ type Server struct {
 	users      []models.User
 	categories []models.Category
 	posts      []models.Post
+	providers  *oauth.Registry
+	blobs      storage.BlobStore
+	// Thumbnail of each image already looked up in the blob store
+	thumbnails sync.Map
+	// HTML of the posts and comments recently shown
+	markdown *markdown.Cache
+	// Streams of the users waiting for new messages
+	messages   *messageHub
 	SESSION_ID string
 }
 
@@ -41,14 +54,29 @@ func NewServer() *http.Server {
 	NewServer := &Server{
 		port:       8080,
 		db:         database.New(),
+		providers:  oauth.LoadProviders(),
+		messages:   newMessageHub(),
 		SESSION_ID: "sRpyIJS9Zmerlpcpqhc1B0xxG7w6Gk1b",
 	}
+	NewServer.blobs, err = storage.New()
+	if err != nil {
+		log.Fatal("Error opening blob storage: ", err)
+	}
+	go NewServer.collectOrphansPeriodically()
+	go NewServer.closePollsPeriodically()
+	go NewServer.publishScheduledPeriodically()
+	go NewServer.purgeTrashPeriodically()
+	NewServer.markdown = markdown.NewCache(1000, references{NewServer.db})
 	users, err := NewServer.db.GetUsers()
 	if err != nil {
 		fmt.Println("Error getting users: ", err)
 	} else {
 		NewServer.users = users
 	}
+	err = NewServer.ensureBadges()
+	if err != nil {
+		fmt.Println("Error creating badges: ", err)
+	}
 	categories, err := NewServer.db.GetCategories()
 	if err != nil {
 		fmt.Println("Error getting categories: ", err)
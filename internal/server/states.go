@@ -0,0 +1,148 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"forum-go/internal/models"
+)
+
+// Longest reason a moderator gives for a state change
+const maxStateReasonLength = 200
+
+func (s *Server) openPost(w http.ResponseWriter, r *http.Request, postId string) bool {
+	// Only published posts that are neither locked nor archived take new comments and votes
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if post.PostId == "" || !post.IsPublished() {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return false
+	}
+	if post.Archived {
+		s.errorHandler(w, r, http.StatusForbidden, "This post is archived")
+		return false
+	}
+	if post.Locked {
+		s.errorHandler(w, r, http.StatusForbidden, "This post is locked")
+		return false
+	}
+	return true
+}
+
+func selectedCategories(categories []models.Category, categoryIds []string) []models.Category {
+	// The existing categories among the ones picked in the filters
+	selected := []models.Category{}
+	for _, category := range categories {
+		for _, categoryId := range categoryIds {
+			if category.CategoryId == categoryId {
+				selected = append(selected, category)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+func withCategories(posts []models.Post, selected []models.Category) []models.Post {
+	// The posts in every one of the categories picked in the filters
+	kept := []models.Post{}
+	for _, post := range posts {
+		matches := 0
+		for _, picked := range selected {
+			for _, category := range post.Categories {
+				if category.CategoryId == picked.CategoryId {
+					matches++
+					break
+				}
+			}
+		}
+		if matches == len(selected) {
+			kept = append(kept, post)
+		}
+	}
+	return kept
+}
+
+func pinnedFirst(posts []models.Post, selected []models.Category) []models.Post {
+	// Keep the posts pinned everywhere first, as GetPosts orders them, then the ones pinned
+	// in a category picked in the filters, the others stay in their order
+	rank := func(post models.Post) int {
+		switch {
+		case post.Pinned && post.PinnedCategoryId == "":
+			return 0
+		case post.Pinned:
+			for _, picked := range selected {
+				if post.PinnedCategoryId == picked.CategoryId {
+					return 1
+				}
+			}
+		}
+		return 2
+	}
+	sorted := append([]models.Post{}, posts...)
+	sort.SliceStable(sorted, func(i, j int) bool { return rank(sorted[i]) < rank(sorted[j]) })
+	return sorted
+}
+
+func (s *Server) PostStateHandler(w http.ResponseWriter, r *http.Request) {
+	// PostStateHandler pins, locks or archives a post, or undoes it, for the moderators and the admins
+	if !s.isLoggedIn(r) || (!IsAdmin(r) && !IsModerator(r)) {
+		s.errorHandler(w, r, http.StatusForbidden, "Only moderators can change the state of a post")
+		return
+	}
+	post, err := s.db.GetPost(r.PathValue("id"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if post.PostId == "" || !post.IsPublished() {
+		s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if utf8.RuneCountInString(reason) > maxStateReasonLength {
+		s.errorHandler(w, r, http.StatusBadRequest, "Reason must be at most 200 characters long")
+		return
+	}
+
+	// A change to the state the post already has is not recorded
+	state := r.FormValue("state")
+	categoryId := ""
+	unchanged := false
+	switch state {
+	case models.POST_PINNED:
+		categoryId = r.FormValue("category_id")
+		found := categoryId == ""
+		for _, category := range post.Categories {
+			found = found || category.CategoryId == categoryId
+		}
+		if !found {
+			s.errorHandler(w, r, http.StatusBadRequest, "A post can only be pinned in one of its categories")
+			return
+		}
+		unchanged = post.Pinned && post.PinnedCategoryId == categoryId
+	case models.POST_UNPINNED:
+		unchanged = !post.Pinned
+	case models.POST_LOCKED, models.POST_UNLOCKED:
+		unchanged = post.Locked == (state == models.POST_LOCKED)
+	case models.POST_ARCHIVED, models.POST_UNARCHIVED:
+		unchanged = post.Archived == (state == models.POST_ARCHIVED)
+	default:
+		s.errorHandler(w, r, http.StatusBadRequest, "Unknown post state")
+		return
+	}
+	if !unchanged {
+		change := models.NewPostStateChange(post.PostId, s.getUser(r).UserId, state, categoryId, reason)
+		err = s.db.ChangePostState(change)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	http.Redirect(w, r, "/post/"+post.PostId+"#moderation", http.StatusSeeOther)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"net/http"
+
+	"forum-go/internal/models"
+)
+
+// categoryFollow is a category of the subscriptions page, followed when the user gets its new posts
+type categoryFollow struct {
+	models.Category
+	Followed bool
+}
+
+func (s *Server) notifySubscribers(authorId, postId string, categories []models.Category, actionType, commentId, details string, skip ...string) {
+	// Tell the followers of a thread or of its categories, the author and the skipped users are already told otherwise
+	categoryIds := make([]string, len(categories))
+	for i, category := range categories {
+		categoryIds[i] = category.CategoryId
+	}
+	subscribers, err := s.db.GetSubscribers(postId, categoryIds)
+	if err != nil {
+		return
+	}
+	skipped := map[string]bool{authorId: true}
+	for _, userId := range skip {
+		skipped[userId] = true
+	}
+	for _, userId := range subscribers {
+		if skipped[userId] {
+			continue
+		}
+		s.db.CreateActivity(models.NewActivity(userId, authorId, actionType, postId, commentId, details))
+	}
+}
+
+func (s *Server) isFollowed(userId, postId string) (bool, error) {
+	// Check a user follows a thread
+	subscriptions, err := s.db.GetSubscriptions(userId)
+	if err != nil {
+		return false, err
+	}
+	for _, subscription := range subscriptions {
+		if subscription.PostId == postId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Server) subscriptionTarget(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	// Read the thread or the category of a follow form, answering 400 or 404 when it is not one of them
+	postId := r.FormValue("post_id")
+	categoryId := r.FormValue("category_id")
+	if (postId == "") == (categoryId == "") {
+		s.errorHandler(w, r, http.StatusBadRequest, "Follow either a post or a category")
+		return "", "", false
+	}
+	if postId != "" {
+		post, err := s.db.GetPost(postId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return "", "", false
+		}
+		if post.PostId == "" || !post.IsPublished() {
+			s.errorHandler(w, r, http.StatusNotFound, "Post not found")
+			return "", "", false
+		}
+		return postId, "", true
+	}
+	categories, err := s.db.GetCategories()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return "", "", false
+	}
+	for _, category := range categories {
+		if category.CategoryId == categoryId {
+			return "", categoryId, true
+		}
+	}
+	s.errorHandler(w, r, http.StatusNotFound, "Category not found")
+	return "", "", false
+}
+
+func (s *Server) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	// SubscribeHandler makes the logged in user follow a thread or a category
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	postId, categoryId, ok := s.subscriptionTarget(w, r)
+	if !ok {
+		return
+	}
+	err := s.db.Subscribe(models.NewSubscription(s.getUser(r).UserId, postId, categoryId))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/subscriptions"
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) UnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	// UnsubscribeHandler makes the logged in user stop following a thread or a category
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	unsubscribed, err := s.db.Unsubscribe(s.getUser(r).UserId, r.FormValue("post_id"), r.FormValue("category_id"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !unsubscribed {
+		s.errorHandler(w, r, http.StatusNotFound, "Subscription not found")
+		return
+	}
+	referer := r.Header.Get("Referer")
+	if referer == "" {
+		referer = "/subscriptions"
+	}
+	http.Redirect(w, r, referer, http.StatusSeeOther)
+}
+
+func (s *Server) SubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	// SubscriptionsHandler lists the threads the logged in user follows and lets them pick the categories to follow
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	subscriptions, err := s.db.GetSubscriptions(s.getUser(r).UserId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	categories, err := s.db.GetCategories()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	followed := map[string]bool{}
+	threads := []models.Subscription{}
+	for _, subscription := range subscriptions {
+		if subscription.PostId != "" {
+			threads = append(threads, subscription)
+		} else {
+			followed[subscription.CategoryId] = true
+		}
+	}
+	follows := make([]categoryFollow, len(categories))
+	for i, category := range categories {
+		follows[i] = categoryFollow{Category: category, Followed: followed[category.CategoryId]}
+	}
+	render(w, r, "subscriptions", map[string]interface{}{"Threads": threads, "Categories": follows})
+}
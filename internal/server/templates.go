@@ -2,6 +2,7 @@ package server
 
 import (
 	"forum-go/internal/models"
+	"forum-go/internal/oauth"
 	"html/template"
 	"net/http"
 )
@@ -20,5 +21,8 @@ func render(w http.ResponseWriter, r *http.Request, page string, data map[string
 	if ok {
 		data["User"] = user
 	}
+	if providers, ok := r.Context().Value(contextKeyProviders).([]*oauth.Provider); ok {
+		data["Providers"] = providers
+	}
 	t.Execute(w, data)
 }
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"forum-go/internal/models"
+	"forum-go/internal/shared"
+	"forum-go/security"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// Failed logins allowed before the backoff starts
+	freeLoginAttempts = 3
+	// First delay of the backoff, doubled after each new failure
+	loginBackoffBase = 2 * time.Second
+	// Longest delay of the backoff
+	loginBackoffMax = 15 * time.Minute
+	// Failed logins on an account before it is locked
+	lockoutThreshold = 10
+	// Duration of an account lock
+	lockoutDuration = 30 * time.Minute
+	// Failed logins older than this are forgotten
+	failureWindow = 24 * time.Hour
+)
+
+func (s *Server) LockedAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	// LockedAccountsHandler lists the accounts locked after too many failed logins
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	locked, err := s.db.GetLockedAccounts()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "admin/locked", map[string]interface{}{"Locked": locked})
+}
+
+func (s *Server) UnlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+	// UnlockAccountHandler lifts the lock of an account
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	err := s.db.ResetLoginThrottle(accountThrottleKey(r.FormValue("userid")))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/adminPanel/locked", http.StatusSeeOther)
+}
+
+func (s *Server) loginWait(r *http.Request, email string) (time.Duration, error) {
+	// Time the client has to wait before trying to log in again, for its IP and the targeted account
+	keys := []string{ipThrottleKey(r)}
+	if user, err := s.db.FindUserByEmail(email); err == nil {
+		keys = append(keys, accountThrottleKey(user.UserId))
+	}
+	var wait time.Duration
+	for _, key := range keys {
+		throttle, err := s.db.GetLoginThrottle(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := throttleWait(throttle, time.Now()); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+func (s *Server) recordLoginFailure(r *http.Request, email string) error {
+	// Count a failed login for the IP and the targeted account, and lock the account past the threshold
+	since := time.Now().Add(-failureWindow)
+	_, err := s.db.RecordLoginFailure(ipThrottleKey(r), since)
+	if err != nil {
+		return err
+	}
+	user, err := s.db.FindUserByEmail(email)
+	if err != nil {
+		// Unknown email, only the IP is throttled
+		return nil
+	}
+	throttle, err := s.db.RecordLoginFailure(accountThrottleKey(user.UserId), since)
+	if err != nil {
+		return err
+	}
+	if !throttle.LockDue(lockoutThreshold) {
+		return nil
+	}
+	until := time.Now().Add(lockoutDuration)
+	err = s.db.LockLoginThrottle(throttle.Key, until)
+	if err != nil {
+		return err
+	}
+	body := "Hello " + user.Username + ",\n\nWe noticed " + fmt.Sprint(lockoutThreshold) + " failed login attempts on your Aniverse account, the last one from " + security.ClientIP(r) + ".\n" +
+		"To protect it, logging in is disabled until " + until.Format("2006-01-02 15:04") + ".\n\n" +
+		"If it wasn't you, we recommend changing your password: " + baseURL() + "/password/forgot"
+	err = shared.SendMail(user.Email, "Your Aniverse account has been locked", body)
+	if err != nil {
+		log.Printf("Failed to send lockout email: %v\n", err)
+	}
+	return nil
+}
+
+func (s *Server) resetLoginFailures(r *http.Request, userId string) error {
+	// Forget the failed logins after a successful one
+	err := s.db.ResetLoginThrottle(ipThrottleKey(r))
+	if err != nil {
+		return err
+	}
+	return s.db.ResetLoginThrottle(accountThrottleKey(userId))
+}
+
+func throttleWait(throttle models.LoginThrottle, now time.Time) time.Duration {
+	// Remaining lock or backoff of a throttle
+	if throttle.LockedUntil.Valid && throttle.LockedUntil.Time.After(now) {
+		return throttle.LockedUntil.Time.Sub(now)
+	}
+	if throttle.Failures < freeLoginAttempts {
+		return 0
+	}
+	delay := loginBackoffMax
+	if shift := throttle.Failures - freeLoginAttempts; shift < 20 {
+		delay = min(loginBackoffBase<<shift, loginBackoffMax)
+	}
+	return max(throttle.LastFailure.Add(delay).Sub(now), 0)
+}
+
+func formatWait(wait time.Duration) string {
+	// Human readable waiting time
+	if wait < time.Minute {
+		return fmt.Sprintf("%d seconds", int(wait.Seconds())+1)
+	}
+	return fmt.Sprintf("%d minutes", int(wait.Minutes())+1)
+}
+
+func ipThrottleKey(r *http.Request) string {
+	return "ip:" + security.ClientIP(r)
+}
+
+func accountThrottleKey(userId string) string {
+	return "user:" + userId
+}
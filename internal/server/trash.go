@@ -0,0 +1,134 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"forum-go/internal/models"
+)
+
+const (
+	// Setting holding the number of days a deleted row stays in the trash
+	trashRetentionSetting = "trashRetentionDays"
+	// Retention used while no admin has chosen one
+	defaultTrashRetention = 30
+	// Longest retention an admin can choose
+	maxTrashRetention = 365
+	// Time between two purges of the trash
+	purgeInterval = time.Hour
+)
+
+func (s *Server) trashRetention() (int, error) {
+	// Number of days a deleted row stays in the trash before being purged
+	value, err := s.db.GetSetting(trashRetentionSetting)
+	if err != nil {
+		return 0, err
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		return defaultTrashRetention, nil
+	}
+	return days, nil
+}
+
+func (s *Server) TrashHandler(w http.ResponseWriter, r *http.Request) {
+	// TrashHandler lists the deleted posts, comments and users until they are purged
+	if !IsAdmin(r) && !IsModerator(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	items, err := s.db.GetTrash()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	retention, err := s.trashRetention()
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	render(w, r, "trash", map[string]interface{}{"Items": items, "Retention": retention})
+}
+
+func (s *Server) RestoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	// RestoreTrashHandler takes a post, a comment or a user out of the trash, users are restored by admins only
+	if !IsAdmin(r) && !IsModerator(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	kind := r.FormValue("kind")
+	id := r.FormValue("id")
+	switch kind {
+	case models.TRASH_POST, models.TRASH_COMMENT:
+	case models.TRASH_USER:
+		if !IsAdmin(r) {
+			s.errorHandler(w, r, http.StatusForbidden, "Only admins can restore users")
+			return
+		}
+	default:
+		s.errorHandler(w, r, http.StatusBadRequest, "Unknown trash kind")
+		return
+	}
+	restored, err := s.db.Restore(kind, id)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !restored {
+		s.errorHandler(w, r, http.StatusNotFound, "Not in the trash")
+		return
+	}
+	if kind == models.TRASH_USER {
+		user, err := s.db.GetUserById(id)
+		if err == nil {
+			s.users = append(s.users, user)
+		}
+	}
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+func (s *Server) PostTrashRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	// PostTrashRetentionHandler sets how many days the deleted rows are kept before being purged
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("retention"))
+	if err != nil || days < 1 || days > maxTrashRetention {
+		s.errorHandler(w, r, http.StatusBadRequest, "Retention must be between 1 and "+strconv.Itoa(maxTrashRetention)+" days")
+		return
+	}
+	err = s.db.SetSetting(trashRetentionSetting, strconv.Itoa(days))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
+
+func (s *Server) purgeTrashPeriodically() {
+	// Purge the trash for the whole life of the server
+	for {
+		err := s.purgeTrash(time.Now())
+		if err != nil {
+			log.Printf("Failed to purge the trash: %v\n", err)
+		}
+		time.Sleep(purgeInterval)
+	}
+}
+
+func (s *Server) purgeTrash(now time.Time) error {
+	// Delete for good what has been in the trash longer than the retention,
+	// the images left unused are then removed by the orphan collector
+	retention, err := s.trashRetention()
+	if err != nil {
+		return err
+	}
+	purged, err := s.db.PurgeTrash(now.AddDate(0, 0, -retention))
+	if purged > 0 {
+		log.Printf("Purged %d rows from the trash\n", purged)
+	}
+	return err
+}
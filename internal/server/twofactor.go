@@ -0,0 +1,451 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"forum-go/internal/models"
+	"forum-go/internal/shared"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// Name of the cookie holding a login waiting for its second factor
+	challengeCookie = "login_challenge"
+	// Time given to type the code after the password
+	challengeDuration = 5 * time.Minute
+	// Wrong codes allowed before the pending login is dropped
+	maxChallengeAttempts = 5
+	// Number of recovery codes given when two factor authentication is enabled
+	recoveryCodesCount = 10
+	// Setting enabling the two factor requirement for admins and moderators
+	require2FASetting = "require2FA"
+)
+
+func (s *Server) GetTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// GetTwoFactorHandler handles the two factor settings page
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	if user.Provider != "local" {
+		s.errorHandler(w, r, http.StatusForbidden, "Two factor authentication is only available for local accounts")
+		return
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/settings/2fa"
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) PostEnableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// PostEnableTwoFactorHandler confirms the enrollment with a first code
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	if user.Provider != "local" {
+		s.errorHandler(w, r, http.StatusForbidden, "Two factor authentication is only available for local accounts")
+		return
+	}
+	codes, errMsg, err := s.enableTwoFactor(user.UserId, r.FormValue("code"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/settings/2fa"
+	data["Error"] = errMsg
+	data["RecoveryCodes"] = codes
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) PostDisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// PostDisableTwoFactorHandler removes the second factor after checking the password and a code
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	errMsg, err := s.confirmIdentity(user, r.FormValue("password"), r.FormValue("code"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errMsg == "" && s.twoFactorRequired(user) {
+		errMsg = "Two factor authentication is mandatory for your role"
+	}
+	if errMsg == "" {
+		err = s.db.DeleteTotp(user.UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/settings/2fa"
+	data["Error"] = errMsg
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) PostRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	// PostRecoveryCodesHandler replaces the recovery codes of the user
+	if !s.isLoggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	user := s.getUser(r)
+	errMsg, err := s.confirmIdentity(user, r.FormValue("password"), r.FormValue("code"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var codes []string
+	if errMsg == "" {
+		codes, err = s.newRecoveryCodes(user.UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/settings/2fa"
+	data["Error"] = errMsg
+	data["RecoveryCodes"] = codes
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) GetLoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// GetLoginTwoFactorHandler asks for the code of a pending login
+	if _, _, ok := s.getChallenge(r); !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	render(w, r, "loginTwoFactor", nil)
+}
+
+func (s *Server) PostLoginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	// PostLoginTwoFactorHandler checks the code of a pending login and creates the session
+	challenge, user, ok := s.getChallenge(r)
+	if !ok {
+		render(w, r, "login", map[string]interface{}{"Error": "Your login has expired, please try again."})
+		return
+	}
+	valid, err := s.checkSecondFactor(user.UserId, r.FormValue("code"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !valid {
+		err = s.db.IncrementChallengeAttempts(challenge.ChallengeId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = s.recordLoginFailure(r, user.Email)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		render(w, r, "loginTwoFactor", map[string]interface{}{"Error": "Invalid code. Please try again."})
+		return
+	}
+	s.finishChallenge(w, r, challenge, user)
+}
+
+func (s *Server) GetLoginTwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	// GetLoginTwoFactorSetupHandler makes a user enroll before logging in when their role requires it
+	_, user, ok := s.getChallenge(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/login/2fa/setup"
+	data["Login"] = true
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) PostLoginTwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	// PostLoginTwoFactorSetupHandler confirms the enrollment of a pending login
+	challenge, user, ok := s.getChallenge(r)
+	if !ok {
+		render(w, r, "login", map[string]interface{}{"Error": "Your login has expired, please try again."})
+		return
+	}
+	// Once the recovery codes have been shown, the user can continue to the forum
+	if r.FormValue("continue") != "" {
+		totp, err := s.db.GetTotp(user.UserId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !totp.Enabled {
+			http.Redirect(w, r, "/login/2fa/setup", http.StatusSeeOther)
+			return
+		}
+		s.finishChallenge(w, r, challenge, user)
+		return
+	}
+	codes, errMsg, err := s.enableTwoFactor(user.UserId, r.FormValue("code"))
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errMsg != "" {
+		err = s.db.IncrementChallengeAttempts(challenge.ChallengeId)
+		if err != nil {
+			s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	data, err := s.twoFactorData(user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	data["Action"] = "/login/2fa/setup"
+	data["Login"] = true
+	data["Error"] = errMsg
+	data["RecoveryCodes"] = codes
+	render(w, r, "twoFactor", data)
+}
+
+func (s *Server) PostTwoFactorPolicyHandler(w http.ResponseWriter, r *http.Request) {
+	// PostTwoFactorPolicyHandler turns the two factor requirement for admins and moderators on or off
+	if !s.isLoggedIn(r) || !IsAdmin(r) {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	value := "false"
+	if r.FormValue("require2FA") == "on" {
+		value = "true"
+	}
+	err := s.db.SetSetting(require2FASetting, value)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/adminPanel", http.StatusSeeOther)
+}
+
+func (s *Server) startSecondFactor(w http.ResponseWriter, r *http.Request, user models.User) (bool, error) {
+	// Stop the login after the password if a second factor is enabled or required.
+	// Returns true when the user has been redirected to the second step.
+	totp, err := s.db.GetTotp(user.UserId)
+	if err != nil {
+		return false, err
+	}
+	next := ""
+	if totp.Enabled {
+		next = "/login/2fa"
+	} else if s.twoFactorRequired(user) {
+		next = "/login/2fa/setup"
+	}
+	if next == "" {
+		return false, nil
+	}
+	challenge := models.NewLoginChallenge(user.UserId, time.Now().Add(challengeDuration))
+	err = s.db.CreateLoginChallenge(challenge)
+	if err != nil {
+		return false, err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     challengeCookie,
+		Value:    challenge.ChallengeId,
+		Expires:  challenge.ExpireDate,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true,
+		Path:     "/login",
+	})
+	http.Redirect(w, r, next, http.StatusSeeOther)
+	return true, nil
+}
+
+func (s *Server) getChallenge(r *http.Request) (models.LoginChallenge, models.User, bool) {
+	// Get the pending login of the request if it is still usable
+	cookie, err := r.Cookie(challengeCookie)
+	if err != nil {
+		return models.LoginChallenge{}, models.User{}, false
+	}
+	challenge, err := s.db.GetLoginChallenge(cookie.Value)
+	if err != nil {
+		return models.LoginChallenge{}, models.User{}, false
+	}
+	if time.Now().After(challenge.ExpireDate) || challenge.Attempts >= maxChallengeAttempts {
+		s.db.DeleteLoginChallenge(challenge.ChallengeId)
+		return models.LoginChallenge{}, models.User{}, false
+	}
+	user, err := s.db.GetUserById(challenge.UserId)
+	if err != nil || user.Role == "ban" {
+		return models.LoginChallenge{}, models.User{}, false
+	}
+	return challenge, user, true
+}
+
+func (s *Server) finishChallenge(w http.ResponseWriter, r *http.Request, challenge models.LoginChallenge, user models.User) {
+	// Drop the pending login and create the real session
+	err := s.db.DeleteLoginChallenge(challenge.ChallengeId)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     challengeCookie,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   true,
+		Path:     "/login",
+	})
+	err = s.createSession(w, user)
+	if err != nil {
+		s.errorHandler(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) twoFactorData(user models.User) (map[string]interface{}, error) {
+	// Data of the two factor page, a new secret is prepared while the user is not enrolled
+	totp, err := s.db.GetTotp(user.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled {
+		remaining, err := s.db.CountRecoveryCodes(user.UserId)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"Enabled": true, "RemainingCodes": remaining, "Required": s.twoFactorRequired(user)}, nil
+	}
+	if totp.Secret == "" {
+		secret, err := shared.GenerateTOTPSecret()
+		if err != nil {
+			return nil, err
+		}
+		totp = models.UserTotp{UserId: user.UserId, Secret: secret, CreationDate: time.Now()}
+		err = s.db.SaveTotp(totp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{
+		"Enabled":  false,
+		"Secret":   totp.Secret,
+		"URI":      template.URL(shared.TOTPURI("Aniverse", user.Email, totp.Secret)),
+		"Required": s.twoFactorRequired(user),
+	}, nil
+}
+
+func (s *Server) enableTwoFactor(userId, code string) ([]string, string, error) {
+	// Enable the pending secret if the code is valid and return new recovery codes
+	totp, err := s.db.GetTotp(userId)
+	if err != nil {
+		return nil, "", err
+	}
+	if totp.Secret == "" || totp.Enabled {
+		return nil, "Two factor authentication can't be enabled", nil
+	}
+	step, ok := shared.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, "Invalid code, check the time of your device and try again", nil
+	}
+	totp.Enabled = true
+	totp.LastStep = step
+	err = s.db.SaveTotp(totp)
+	if err != nil {
+		return nil, "", err
+	}
+	codes, err := s.newRecoveryCodes(userId)
+	return codes, "", err
+}
+
+func (s *Server) checkSecondFactor(userId, code string) (bool, error) {
+	// Check a TOTP code or, failing that, consume a recovery code
+	totp, err := s.db.GetTotp(userId)
+	if err != nil || !totp.Enabled {
+		return false, err
+	}
+	step, ok := shared.ValidateTOTP(totp.Secret, code, time.Now())
+	if ok && step > totp.LastStep {
+		return true, s.db.UpdateTotpStep(userId, step)
+	}
+	return s.db.UseRecoveryCode(userId, hashToken(normalizeRecoveryCode(code)))
+}
+
+func (s *Server) confirmIdentity(user models.User, password, code string) (string, error) {
+	// Re-authenticate a logged in user with his password and second factor
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "Password is incorrect", nil
+	}
+	valid, err := s.checkSecondFactor(user.UserId, code)
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return "Invalid code", nil
+	}
+	return "", nil
+}
+
+func (s *Server) newRecoveryCodes(userId string) ([]string, error) {
+	// Generate recovery codes, only their hashes are stored
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+	for i := 0; i < recoveryCodesCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(b)
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashToken(code))
+	}
+	err := s.db.ReplaceRecoveryCodes(userId, hashes)
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *Server) twoFactorRequired(user models.User) bool {
+	// Check if the admin policy forces two factor authentication on the user
+	if user.Provider != "local" || (user.Role != "admin" && user.Role != "moderator") {
+		return false
+	}
+	value, err := s.db.GetSetting(require2FASetting)
+	return err == nil && value == "true"
+}
+
+func normalizeRecoveryCode(code string) string {
+	// Recovery codes are accepted with or without the dash and in any case
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -1,61 +1,220 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"forum-go/internal/imaging"
+	"forum-go/internal/models"
+	"forum-go/internal/storage"
 	"io"
+	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
-	"time"
+	"strings"
 )
 
-const uploadDir = "assets/img/uploads/"
+// Largest file accepted by the upload forms
+const maxUploadSize = 20 * 1024 * 1024
 
-func UploadImageHandler(w http.ResponseWriter, r *http.Request) (string, error) {
-	// Parse multipart form data
-	err := r.ParseMultipartForm(20 * 1024 * 1024) // 20MB limit
+// Longest side of a stored image, larger ones are scaled down
+const maxImageSide = 2048
+
+// Longest side of the thumbnails shown on the home page
+const thumbnailSide = 480
+
+var allowedExtensions = []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+
+func (s *Server) storeImages(r *http.Request, files []*multipart.FileHeader, prefix string) ([]string, error) {
+	// Check, re-encode and store uploaded images under a key prefix, the content decides what a file is
+	var images []string
+	for _, header := range files {
+		file, err := openFile(header, maxUploadSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Filename, err)
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxUploadSize))
+		file.Close()
+		if err != nil {
+			return nil, errors.New("invalid file upload")
+		}
+		encoded, err := imaging.Reencode(data, maxImageSide)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", header.Filename, err)
+		}
+		image, err := s.saveImage(r.Context(), encoded, prefix)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+func (s *Server) saveImage(ctx context.Context, encoded imaging.Encoded, prefix string) (string, error) {
+	// Store an image under the hash of its content, an identical upload reuses the same blobs
+	sum := sha256.Sum256(encoded.Data)
+	name := prefix + hex.EncodeToString(sum[:16]) + encoded.Ext
+	err := s.putNewBlob(ctx, name, encoded.Data, mime.TypeByExtension(encoded.Ext))
 	if err != nil {
-		http.Error(w, "File size exceeds limit", http.StatusBadRequest)
 		return "", err
 	}
-	file, header, err := r.FormFile("file")
+	var buf bytes.Buffer
+	err = imaging.EncodeJPEG(&buf, imaging.Fit(encoded.Image, thumbnailSide), avatarBackground, 80)
 	if err != nil {
-		http.Error(w, "Invalid file upload", http.StatusBadRequest)
 		return "", err
 	}
-	defer file.Close()
-	if header.Size > 20*1024*1024 {
-		err := errors.New("file size exceeds limit")
+	err = s.putNewBlob(ctx, thumbnailName(name), buf.Bytes(), "image/jpeg")
+	if err != nil {
 		return "", err
 	}
-	// Check file extension
-	ext := filepath.Ext(header.Filename)
-	allowedExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".JPG", ".JPEG", ".PNG", ".GIF"}
-	if !contains(allowedExtensions, ext) {
-		err := errors.New("invalid file type")
-		return "", err
+	s.thumbnails.Store(name, thumbnailName(name))
+	return name, nil
+}
+
+func (s *Server) putNewBlob(ctx context.Context, key string, data []byte, contentType string) error {
+	// Nothing is written when the blob already exists
+	exists, err := s.blobs.Exists(ctx, key)
+	if err != nil || exists {
+		return err
 	}
+	return s.blobs.Put(ctx, key, data, contentType)
+}
 
-	// Create destination file
-	newFileName := fmt.Sprintf("%d%s", time.Now().Unix(), ext)
-	destPath := filepath.Join(uploadDir, newFileName)
+func (s *Server) copyBlob(ctx context.Context, key, newKey string) error {
+	// Copy a blob under another key, nothing is written when it already exists
+	body, _, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	return s.putNewBlob(ctx, newKey, data, mime.TypeByExtension(path.Ext(newKey)))
+}
 
-	out, err := os.Create(destPath)
+func thumbnailName(imageURL string) string {
+	// Name of the thumbnail shown on the home page for an uploaded image
+	return strings.TrimSuffix(imageURL, path.Ext(imageURL)) + "_thumb.jpg"
+}
+
+func (s *Server) thumbnailURL(imageURL string) string {
+	// Thumbnail of an image, images uploaded before thumbnails existed are shown whole.
+	// The answer is remembered, the home page would otherwise ask the store for every post.
+	if imageURL == "" {
+		return ""
+	}
+	if known, ok := s.thumbnails.Load(imageURL); ok {
+		return known.(string)
+	}
+	thumbnail := thumbnailName(imageURL)
+	exists, err := s.blobs.Exists(context.Background(), thumbnail)
 	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
-		return "", err
+		return imageURL
+	}
+	if !exists {
+		thumbnail = imageURL
+	}
+	s.thumbnails.Store(imageURL, thumbnail)
+	return thumbnail
+}
+
+func (s *Server) draftImageURL(imageURL string) string {
+	// Where the author of a draft sees one of its images, private ones through a signed URL
+	thumbnail := s.thumbnailURL(imageURL)
+	if !strings.HasPrefix(thumbnail, storage.PrivatePrefix) {
+		return "/uploads/" + thumbnail
+	}
+	signed, err := s.blobs.SignedURL(thumbnail, draftImageExpiry)
+	if err != nil {
+		log.Printf("Failed to sign image URL: %v\n", err)
+		return ""
+	}
+	return signed
+}
+
+func (s *Server) publishImages(post models.Post) error {
+	// Move the private images of a draft to public keys before it is published
+	moved := map[string]bool{}
+	for _, attachment := range post.Attachments {
+		imageURL := attachment.ImageURL
+		if !strings.HasPrefix(imageURL, storage.PrivatePrefix) || moved[imageURL] {
+			continue
+		}
+		moved[imageURL] = true
+		publicURL := strings.TrimPrefix(imageURL, storage.PrivatePrefix)
+		err := s.copyBlob(context.Background(), imageURL, publicURL)
+		if err != nil {
+			return err
+		}
+		err = s.copyBlob(context.Background(), thumbnailName(imageURL), thumbnailName(publicURL))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+		err = s.db.MoveAttachmentImage(post.PostId, imageURL, publicURL)
+		if err != nil {
+			return err
+		}
+		s.releaseImage(imageURL)
 	}
-	defer out.Close()
+	return nil
+}
 
-	// Write to the destination
-	_, err = io.Copy(out, file)
+func (s *Server) releaseImage(imageURL string) {
+	// Delete an uploaded image once no post shows it anymore
+	uses, err := s.db.CountImageUses(imageURL)
 	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
-		return "", err
+		log.Printf("Failed to count image uses: %v\n", err)
+		return
+	}
+	if uses == 0 {
+		s.removeImage(imageURL)
 	}
+}
 
-	return newFileName, nil
+func (s *Server) removeImage(imageURL string) {
+	// Delete an uploaded image and its thumbnail
+	s.thumbnails.Delete(imageURL)
+	for _, key := range []string{imageURL, thumbnailName(imageURL)} {
+		err := s.blobs.Delete(context.Background(), key)
+		if err != nil {
+			log.Printf("Failed to delete image file: %v\n", err)
+		}
+	}
+}
+
+func openUpload(r *http.Request, field string, maxSize int64) (multipart.File, *multipart.FileHeader, error) {
+	// Open an uploaded image after checking its size and extension
+	file, header, err := r.FormFile(field)
+	if err != nil {
+		return nil, nil, errors.New("invalid file upload")
+	}
+	file.Close()
+	file, err = openFile(header, maxSize)
+	return file, header, err
+}
+
+func openFile(header *multipart.FileHeader, maxSize int64) (multipart.File, error) {
+	// Open one file of a multiple upload after checking its size and extension
+	if header.Size > maxSize {
+		return nil, errors.New("file size exceeds limit")
+	}
+	if !contains(allowedExtensions, strings.ToLower(filepath.Ext(header.Filename))) {
+		return nil, errors.New("invalid file type")
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, errors.New("invalid file upload")
+	}
+	return file, nil
 }
 
 func contains(slice []string, item string) bool {
@@ -0,0 +1,26 @@
+package shared
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+)
+
+// SendMail sends a plain text email using the SMTP settings of the .env file.
+// When no SMTP host is configured the message is only logged, which is enough
+// for local development.
+func SendMail(to, subject, body string) error {
+	host := GetEnv("smtpHost")
+	if host == "" {
+		log.Printf("SMTP not configured, mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+	port := GetEnv("smtpPort")
+	if port == "" {
+		port = "587"
+	}
+	from := GetEnv("smtpFrom")
+	auth := smtp.PlainAuth("", GetEnv("smtpUser"), GetEnv("smtpPassword"), host)
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n", from, to, subject, body)
+	return smtp.SendMail(host+":"+port, auth, from, []string{to}, []byte(msg))
+}
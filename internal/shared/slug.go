@@ -0,0 +1,36 @@
+package shared
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Titles are cut at the first word boundary past this length, and in the
+// middle of a word past 80 bytes
+const maxSlugLength = 60
+
+// Slugify turns a title into the readable part of a post address: lowercase
+// letters and digits separated by single dashes.
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if b.Len()+utf8.RuneLen(r) > maxSlugLength+20 {
+				break
+			}
+			if dash && b.Len() > 0 {
+				if b.Len() >= maxSlugLength {
+					break
+				}
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package shared
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors of RFC 6238 (SHA1), truncated to 6 digits
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, expected := range vectors {
+		code, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("error computing code. Err: %v", err)
+		}
+		if code != expected {
+			t.Errorf("at %d expected code %s; got %s", unix, expected, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("error generating secret. Err: %v", err)
+	}
+	now := time.Now()
+	code, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	if _, ok := ValidateTOTP(secret, code, now); !ok {
+		t.Errorf("expected code of the previous period to be accepted")
+	}
+	code, _ = TOTPCode(secret, now.Add(-5*time.Minute))
+	if _, ok := ValidateTOTP(secret, code, now); ok {
+		t.Errorf("expected old code to be refused")
+	}
+}
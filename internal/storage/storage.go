@@ -0,0 +1,90 @@
+// Package storage keeps the files uploaded to the forum, on the local disk or
+// in an S3 compatible bucket such as MinIO, behind the BlobStore interface.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"forum-go/internal/shared"
+)
+
+// ErrNotFound is returned when a blob doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that could escape the store.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Object describes a stored blob.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores blobs under slash separated keys like "avatars/id-1-32.jpg".
+type BlobStore interface {
+	// Put writes a blob, replacing any blob with the same key.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens a blob, the reader must be closed. It returns ErrNotFound
+	// when the key doesn't exist.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Exists reports whether a blob is stored under the key.
+	Exists(ctx context.Context, key string) (bool, error)
+	// Delete removes a blob, deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns every blob whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// SignedURL returns a URL giving read access to a blob until it expires,
+	// for content that is not served publicly.
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// Keys under this prefix are only readable through a signed URL
+const PrivatePrefix = "private/"
+
+// New creates the store described in the .env file. storageDriver selects
+// "local" (the default) or "s3".
+func New() (BlobStore, error) {
+	switch driver := shared.GetEnv("storageDriver"); driver {
+	case "", "local":
+		dir := shared.GetEnv("storageDir")
+		if dir == "" {
+			dir = "assets/img/uploads"
+		}
+		return NewLocal(dir, shared.GetEnv("storageSecret"))
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  shared.GetEnv("s3Endpoint"),
+			Region:    shared.GetEnv("s3Region"),
+			Bucket:    shared.GetEnv("s3Bucket"),
+			AccessKey: shared.GetEnv("s3AccessKey"),
+			SecretKey: shared.GetEnv("s3SecretKey"),
+			PathStyle: shared.GetEnv("s3PathStyle") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", driver)
+	}
+}
+
+// ValidKey reports whether a key is safe to use as a path on every store.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 512 || strings.HasPrefix(key, "/") || strings.HasSuffix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_./", c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -8,16 +8,31 @@ CREATE TABLE IF NOT EXISTS User (
   creation_date DATETIME NOT NULL,
   session_id CHAR(32),
   session_expire DATETIME,
-  provider VARCHAR(50)
+  provider VARCHAR(50),
+  deletion_date DATETIME,
+  -- A deleted row stays in the trash until it is purged
+  deleted_by CHAR(32)
 );
 CREATE TABLE IF NOT EXISTS Post (
   post_id CHAR(32) PRIMARY KEY,
   title VARCHAR(50) NOT NULL,
+  slug VARCHAR(100),
   content TEXT NOT NULL,
   image_url VARCHAR(255),
   user_id CHAR(32) NOT NULL,
   creation_date DATETIME NOT NULL,
   update_date DATETIME,
+  status VARCHAR(20) NOT NULL DEFAULT 'published',
+  -- draft, scheduled or published, only published posts are shown
+  publish_date DATETIME,
+  -- When a scheduled post is published
+  pinned BOOLEAN NOT NULL DEFAULT 0,
+  pinned_category_id CHAR(32),
+  -- A pinned post without category is pinned everywhere
+  locked BOOLEAN NOT NULL DEFAULT 0,
+  archived BOOLEAN NOT NULL DEFAULT 0,
+  deletion_date DATETIME,
+  deleted_by CHAR(32),
   FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
 );
 CREATE TABLE IF NOT EXISTS Comment (
@@ -27,6 +42,8 @@ CREATE TABLE IF NOT EXISTS Comment (
   update_date DATETIME,
   user_id CHAR(32) NOT NULL,
   post_id CHAR(32) NOT NULL,
+  deletion_date DATETIME,
+  deleted_by CHAR(32),
   FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE,
   FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
 );
@@ -42,6 +59,8 @@ CREATE TABLE IF NOT EXISTS User_Like (
   -- If the user likes a post
   comment_id CHAR(32),
   -- If the user likes a comment
+  karma INTEGER NOT NULL DEFAULT 0,
+  -- Karma the vote gave to the author, with the weights of its time, 0 on his own content
   FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE -- FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE,
   -- FOREIGN KEY (comment_id) REFERENCES Comment(comment_id) ON DELETE CASCADE
 );
@@ -95,4 +114,298 @@ CREATE TABLE IF NOT EXISTS Report(
   reason VARCHAR(50) NOT NULL,
   FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
 );
+CREATE TABLE IF NOT EXISTS Password_Reset(
+  reset_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  token_hash CHAR(64) NOT NULL UNIQUE,
+  -- SHA-256 of the token sent by email, the raw token is never stored
+  expire_date DATETIME NOT NULL,
+  used BOOLEAN NOT NULL DEFAULT 0,
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS User_Totp(
+  user_id CHAR(32) PRIMARY KEY,
+  secret VARCHAR(64) NOT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT 0,
+  -- Last accepted TOTP period, a code can't be used twice
+  last_step INTEGER NOT NULL DEFAULT 0,
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Recovery_Code(
+  code_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  code_hash CHAR(64) NOT NULL,
+  used BOOLEAN NOT NULL DEFAULT 0,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Login_Challenge(
+  challenge_id CHAR(32) PRIMARY KEY,
+  -- Pending login waiting for the second factor
+  user_id CHAR(32) NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expire_date DATETIME NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Setting(
+  setting_key VARCHAR(50) PRIMARY KEY,
+  value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS Login_Throttle(
+  throttle_key VARCHAR(100) PRIMARY KEY,
+  -- "user:<user_id>" or "ip:<address>"
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failure DATETIME NOT NULL,
+  locked_until DATETIME
+);
+CREATE TABLE IF NOT EXISTS OAuth_State(
+  state VARCHAR(64) PRIMARY KEY,
+  -- Pending login on an OAuth provider, consumed by the callback
+  provider VARCHAR(50) NOT NULL,
+  nonce VARCHAR(64) NOT NULL,
+  code_verifier VARCHAR(64) NOT NULL,
+  expire_date DATETIME NOT NULL,
+  -- Set when a logged in user links the provider to his account
+  user_id CHAR(32)
+);
+CREATE TABLE IF NOT EXISTS User_Identity(
+  identity_id CHAR(32) PRIMARY KEY,
+  -- Account of a login provider linked to a user
+  user_id CHAR(32) NOT NULL,
+  provider VARCHAR(50) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  email VARCHAR(255),
+  creation_date DATETIME NOT NULL,
+  UNIQUE (provider, subject),
+  UNIQUE (user_id, provider),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS User_Profile(
+  user_id CHAR(32) PRIMARY KEY,
+  bio TEXT NOT NULL DEFAULT '',
+  location VARCHAR(100) NOT NULL DEFAULT '',
+  links TEXT NOT NULL DEFAULT '',
+  -- One URL per line
+  update_date DATETIME NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS User_Avatar(
+  user_id CHAR(32) PRIMARY KEY,
+  -- Uploaded avatar, users without one get an identicon
+  version INTEGER NOT NULL,
+  -- Part of the file names, changed on every upload
+  update_date DATETIME NOT NULL,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Attachment(
+  attachment_id CHAR(32) PRIMARY KEY,
+  -- Image of a post, a post shows its attachments as a gallery
+  post_id CHAR(32) NOT NULL,
+  image_url VARCHAR(255) NOT NULL,
+  caption VARCHAR(200) NOT NULL DEFAULT '',
+  position INTEGER NOT NULL,
+  -- Order in the gallery, the first one is the cover on the home page
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Attachment_post ON Attachment(post_id, position);
+CREATE TABLE IF NOT EXISTS Poll(
+  poll_id CHAR(32) PRIMARY KEY,
+  -- Poll of a post, a post has at most one
+  post_id CHAR(32) NOT NULL UNIQUE,
+  question VARCHAR(200) NOT NULL,
+  multiple BOOLEAN NOT NULL DEFAULT 0,
+  -- Voters may choose several options
+  close_date DATETIME,
+  -- No vote is taken after it, NULL when the poll never closes
+  closed_notified BOOLEAN NOT NULL DEFAULT 0,
+  -- The author was told the poll closed
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Poll_Option(
+  option_id CHAR(32) PRIMARY KEY,
+  poll_id CHAR(32) NOT NULL,
+  label VARCHAR(100) NOT NULL,
+  position INTEGER NOT NULL,
+  FOREIGN KEY (poll_id) REFERENCES Poll(poll_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Poll_Ballot(
+  poll_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  creation_date DATETIME NOT NULL,
+  -- A user votes once per poll, his choices are in Poll_Vote
+  PRIMARY KEY (poll_id, user_id),
+  FOREIGN KEY (poll_id) REFERENCES Poll(poll_id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Poll_Vote(
+  poll_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  option_id CHAR(32) NOT NULL,
+  PRIMARY KEY (poll_id, user_id, option_id),
+  FOREIGN KEY (poll_id, user_id) REFERENCES Poll_Ballot(poll_id, user_id) ON DELETE CASCADE,
+  FOREIGN KEY (option_id) REFERENCES Poll_Option(option_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Poll_Vote_option ON Poll_Vote(option_id);
+-- A single choice poll takes one option per ballot
+CREATE TRIGGER IF NOT EXISTS Poll_Vote_single BEFORE INSERT ON Poll_Vote
+WHEN (SELECT multiple FROM Poll WHERE poll_id = NEW.poll_id) = 0
+  AND EXISTS (SELECT 1 FROM Poll_Vote WHERE poll_id = NEW.poll_id AND user_id = NEW.user_id)
+BEGIN
+  SELECT RAISE(ABORT, 'single choice poll');
+END;
+CREATE TABLE IF NOT EXISTS Post_State_Change(
+  change_id CHAR(32) PRIMARY KEY,
+  post_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  -- The moderator who changed the state
+  state VARCHAR(20) NOT NULL,
+  category_id CHAR(32),
+  reason TEXT NOT NULL DEFAULT '',
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Post_State_Change_post ON Post_State_Change(post_id, creation_date);
+CREATE TABLE IF NOT EXISTS Bookmark_Folder(
+  folder_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  name VARCHAR(50) NOT NULL,
+  creation_date DATETIME NOT NULL,
+  UNIQUE (user_id, name),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Bookmark(
+  bookmark_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  post_id CHAR(32) NOT NULL,
+  comment_id CHAR(32) NOT NULL DEFAULT '',
+  -- Empty when the post itself is saved
+  folder_id CHAR(32),
+  creation_date DATETIME NOT NULL,
+  UNIQUE (user_id, post_id, comment_id),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE,
+  FOREIGN KEY (folder_id) REFERENCES Bookmark_Folder(folder_id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS Bookmark_post ON Bookmark(post_id, comment_id);
+CREATE TABLE IF NOT EXISTS Subscription(
+  subscription_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  post_id CHAR(32) NOT NULL DEFAULT '',
+  -- A followed thread, empty when a category is followed
+  category_id CHAR(32) NOT NULL DEFAULT '',
+  -- A followed category, empty when a thread is followed
+  creation_date DATETIME NOT NULL,
+  UNIQUE (user_id, post_id, category_id),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Subscription_post ON Subscription(post_id);
+CREATE INDEX IF NOT EXISTS Subscription_category ON Subscription(category_id);
+CREATE TABLE IF NOT EXISTS Follow(
+  follow_id CHAR(32) PRIMARY KEY,
+  follower_id CHAR(32) NOT NULL,
+  followed_id CHAR(32) NOT NULL,
+  -- The user whose posts the follower gets in his feed
+  creation_date DATETIME NOT NULL,
+  UNIQUE (follower_id, followed_id),
+  FOREIGN KEY (follower_id) REFERENCES User(user_id) ON DELETE CASCADE,
+  FOREIGN KEY (followed_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Follow_followed ON Follow(followed_id);
+CREATE TABLE IF NOT EXISTS User_Block(
+  block_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  target_id CHAR(32) NOT NULL,
+  kind VARCHAR(10) NOT NULL,
+  -- block or mute, a user can both block and mute another
+  creation_date DATETIME NOT NULL,
+  UNIQUE (user_id, target_id, kind),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE,
+  FOREIGN KEY (target_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS User_Block_target ON User_Block(target_id);
+CREATE TABLE IF NOT EXISTS Conversation(
+  conversation_id CHAR(32) PRIMARY KEY,
+  creator_id CHAR(32) NOT NULL,
+  creation_date DATETIME NOT NULL,
+  update_date DATETIME NOT NULL,
+  -- Date of the last message, the inbox shows the latest conversations first
+  FOREIGN KEY (creator_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Conversation_creator ON Conversation(creator_id, creation_date);
+CREATE TABLE IF NOT EXISTS Participant(
+  conversation_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  last_read_date DATETIME,
+  -- The messages sent after it are unread
+  PRIMARY KEY (conversation_id, user_id),
+  FOREIGN KEY (conversation_id) REFERENCES Conversation(conversation_id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Participant_user ON Participant(user_id);
+CREATE TABLE IF NOT EXISTS Message(
+  message_id CHAR(32) PRIMARY KEY,
+  conversation_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  content TEXT NOT NULL,
+  creation_date DATETIME NOT NULL,
+  deletion_date DATETIME,
+  -- Set when an admin removes the message after a report
+  FOREIGN KEY (conversation_id) REFERENCES Conversation(conversation_id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Message_conversation ON Message(conversation_id, creation_date);
+CREATE TABLE IF NOT EXISTS Message_Report(
+  report_id CHAR(32) PRIMARY KEY,
+  message_id CHAR(32) NOT NULL,
+  user_id CHAR(32) NOT NULL,
+  -- The participant who reported the message
+  reason VARCHAR(50) NOT NULL,
+  status VARCHAR(50) NOT NULL,
+  creation_date DATETIME NOT NULL,
+  FOREIGN KEY (message_id) REFERENCES Message(message_id) ON DELETE CASCADE,
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS User_Karma(
+  user_id CHAR(32) PRIMARY KEY,
+  post_karma INTEGER NOT NULL DEFAULT 0,
+  -- Sum of the karma of the votes on the posts of the user outside the trash
+  comment_karma INTEGER NOT NULL DEFAULT 0,
+  -- Same for his comments
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Badge(
+  badge_id CHAR(32) PRIMARY KEY,
+  code VARCHAR(50) NOT NULL,
+  -- Rule awarding the badge, empty for the badges admins award by hand
+  name VARCHAR(50) NOT NULL UNIQUE,
+  description VARCHAR(200) NOT NULL,
+  creation_date DATETIME NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS Badge_code ON Badge(code) WHERE code != '';
+CREATE TABLE IF NOT EXISTS User_Badge(
+  user_id CHAR(32) NOT NULL,
+  badge_id CHAR(32) NOT NULL,
+  awarded_by CHAR(32) NOT NULL,
+  -- Admin who awarded the badge, empty when a rule did
+  creation_date DATETIME NOT NULL,
+  PRIMARY KEY (user_id, badge_id),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE,
+  FOREIGN KEY (badge_id) REFERENCES Badge(badge_id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS Reaction(
+  reaction_id CHAR(32) PRIMARY KEY,
+  user_id CHAR(32) NOT NULL,
+  post_id CHAR(32) NOT NULL,
+  comment_id CHAR(32) NOT NULL,
+  -- Empty for a reaction to the post itself
+  emoji VARCHAR(32) NOT NULL,
+  creation_date DATETIME NOT NULL,
+  UNIQUE(user_id, post_id, comment_id, emoji),
+  FOREIGN KEY (user_id) REFERENCES User(user_id) ON DELETE CASCADE,
+  FOREIGN KEY (post_id) REFERENCES Post(post_id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS Reaction_post ON Reaction(post_id);
 PRAGMA foreign_keys = ON;
\ No newline at end of file
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"net"
 	"net/http"
 	"sync"
 	"time"
@@ -22,7 +23,7 @@ const timeWindow = 10 * time.Second // Time interval to limit requests
 // Main function to handle requests with rate limiting
 func RateLimitedHandler(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip := r.RemoteAddr // Identify the client by its IP
+		ip := ClientIP(r) // Identify the client by its IP
 
 		// Lock access to the clients map
 		mu.Lock()
@@ -58,6 +59,15 @@ func RateLimitedHandler(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// ClientIP returns the IP of the client without the port of the connection
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // Periodic cleanup of inactive clients
 func CleanupInactiveClients() {
 	for {